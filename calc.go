@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"tfccalc/cli"
+)
+
+// runCalc implements "tfccalc calc": it prints the breakdown of an alloy and its
+// base metals, and exits with a non-zero code if the calculation fails.
+func runCalc(args []string) {
+	fs := flag.NewFlagSet("calc", flag.ExitOnError)
+	opts := cli.AddCalcFlags(fs)
+	cfg := loadConfig(fs, cli.FlagsFirst(fs, args))
+	opts.Mode = cfg.UI.Mode
+
+	store, closeStore, err := openStore(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize DB: %v", err)
+	}
+	code := opts.Run(context.Background(), store, fs.Args(), os.Stdout, os.Stderr)
+	closeStore()
+	os.Exit(code)
+}
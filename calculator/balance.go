@@ -0,0 +1,103 @@
+package calculator
+
+import (
+	"context"
+	"math"
+	"strings"
+	"tfccalc/data"
+)
+
+// BalancePercentages completes a partial set of percentages for alloyID. The
+// ingredients in pinned keep their values; the rest of 100% is spread over the
+// other ingredients, each within its Min/Max range. Starting from the defaults,
+// each free ingredient takes a share of the difference in proportion to how far it
+// can still move in that direction, so all of them reach their limits together.
+// With nothing pinned it returns the defaults. If no valid map exists, the
+// *ValidationError says why, e.g. that the pinned values leave too little for the
+// others.
+func (c *Calculator) BalancePercentages(ctx context.Context, alloyID string, pinned map[string]float64) (map[string]float64, error) {
+	alloy, err := c.store.GetAlloyByID(ctx, alloyID)
+	if err != nil {
+		return nil, err
+	}
+	defaults, err := c.GetDefaultPercentages(ctx, alloyID)
+	if err != nil {
+		return nil, err
+	}
+	if len(pinned) == 0 {
+		return defaults, nil
+	}
+
+	const eps = 0.001
+	ingredients := make(map[string]data.IngredientInfo, len(alloy.Ingredients))
+	for _, ing := range alloy.Ingredients {
+		ingredients[ing.IngredientID] = ing
+	}
+	result := make(map[string]float64, len(alloy.Ingredients))
+	var pinnedNames []string
+	remainder := 100.0
+	for id, pct := range pinned {
+		ing, ok := ingredients[id]
+		if !ok {
+			return nil, invalid(alloyID, "%s is not an ingredient of %s", data.GetAlloyNameByID(ctx, c.store, id), alloy.Name)
+		}
+		if math.IsNaN(pct) || pct < ing.Min-eps || pct > ing.Max+eps {
+			return nil, invalid(alloyID, "percentage for %s (%.2f%%) outside [%.2f–%.2f] for %s",
+				data.GetAlloyNameByID(ctx, c.store, id), pct, ing.Min, ing.Max, alloy.Name)
+		}
+		result[id] = pct
+		remainder -= pct
+	}
+
+	var free []data.IngredientInfo
+	var freeNames []string
+	minSum, maxSum, midSum := 0.0, 0.0, 0.0
+	for _, ing := range alloy.Ingredients {
+		name := data.GetAlloyNameByID(ctx, c.store, ing.IngredientID)
+		if _, ok := pinned[ing.IngredientID]; ok {
+			pinnedNames = append(pinnedNames, name)
+			continue
+		}
+		free = append(free, ing)
+		freeNames = append(freeNames, name)
+		minSum += ing.Min
+		maxSum += ing.Max
+		midSum += defaults[ing.IngredientID]
+	}
+
+	if len(free) == 0 {
+		if math.Abs(remainder) > 0.01 {
+			return nil, invalid(alloyID, "all ingredients of %s are set and add up to %.2f%% (should be 100%%)", alloy.Name, 100-remainder)
+		}
+		return result, nil
+	}
+	switch {
+	case remainder < minSum-eps:
+		return nil, invalid(alloyID, "%s set to %.2f%% leaves %.2f%% for %s, less than their minimum of %.2f%%",
+			strings.Join(pinnedNames, " + "), 100-remainder, remainder, strings.Join(freeNames, " + "), minSum)
+	case remainder > maxSum+eps:
+		return nil, invalid(alloyID, "%s set to %.2f%% leaves %.2f%% for %s, more than their maximum of %.2f%%",
+			strings.Join(pinnedNames, " + "), 100-remainder, remainder, strings.Join(freeNames, " + "), maxSum)
+	}
+
+	// Move every free ingredient from its default towards Min or Max by the same
+	// fraction of its room, which always stays within the ranges.
+	delta := remainder - midSum
+	room := maxSum - midSum
+	if delta < 0 {
+		room = midSum - minSum
+	}
+	for _, ing := range free {
+		mid := defaults[ing.IngredientID]
+		pct := mid
+		if room > 0 {
+			if delta < 0 {
+				pct += delta * (mid - ing.Min) / room
+			} else {
+				pct += delta * (ing.Max - mid) / room
+			}
+		}
+		result[ing.IngredientID] = math.Min(math.Max(pct, ing.Min), ing.Max)
+	}
+	return result, nil
+}
@@ -0,0 +1,109 @@
+package calculator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"tfccalc/data"
+)
+
+// BatchTarget is one entry of a batch: an alloy, how much of it, and the user's
+// percentage overrides for it (in the form CalculateRequirements takes; nil means
+// defaults).
+type BatchTarget struct {
+	AlloyID     string
+	Amount      float64
+	Mode        string // "mB" or "Ingots"
+	Percentages map[string]map[string]float64
+}
+
+// TargetRequirements is the calculation of one BatchTarget.
+type TargetRequirements struct {
+	Target BatchTarget
+	Result *Result
+}
+
+// IntermediateUse is one place an intermediate material goes into: the parent it
+// is melted into (or combined with, for final steels) while making Targets[Target].
+// ParentID is "" when the material is Targets[Target] itself.
+type IntermediateUse struct {
+	Target   int
+	ParentID string
+	AmountMB float64
+}
+
+// SharedIntermediate is an intermediate material (steel, black steel, black bronze,
+// …) that the batch makes for more than one use, so it can be made in one go.
+type SharedIntermediate struct {
+	ID      string
+	TotalMB float64
+	Uses    []IntermediateUse
+}
+
+// BatchPlan is the result of CalculateBatch.
+type BatchPlan struct {
+	Targets     []TargetRequirements
+	TotalMB     map[string]float64 // base ID → mB for the whole batch
+	TotalIngots map[string]float64 // base ID → Ingots for the whole batch
+	Shared      []SharedIntermediate
+}
+
+// CalculateBatch works out the requirements of several targets at once. Each
+// target is calculated like CalculateRequirements does, the base materials are
+// added up, and every intermediate the batch needs in more than one place is
+// listed in Shared, sorted by ID. A target counts as a use of its own material, so
+// steel made as a target and inside blue steel is shared too. An error names the target it belongs to and
+// wraps the underlying error, so a *ValidationError can still be detected.
+func (c *Calculator) CalculateBatch(ctx context.Context, targets []BatchTarget) (*BatchPlan, error) {
+	if len(targets) == 0 {
+		return nil, errors.New("batch has no targets")
+	}
+	plan := &BatchPlan{
+		TotalMB:     make(map[string]float64),
+		TotalIngots: make(map[string]float64),
+	}
+	uses := make(map[string][]IntermediateUse)
+	for i, target := range targets {
+		res, err := c.Calculate(ctx, target.AlloyID, target.Amount, target.Mode, target.Percentages)
+		if err != nil {
+			return nil, fmt.Errorf("target %d (%s): %w", i+1, data.GetAlloyNameByID(ctx, c.store, target.AlloyID), err)
+		}
+		plan.Targets = append(plan.Targets, TargetRequirements{Target: target, Result: res})
+		plan.TotalMB = sumMaterials(plan.TotalMB, res.TotalMB)
+
+		res.Root.Walk(func(node, parent *Node, _ int) {
+			if node.Type == "base" {
+				return
+			}
+			parentID := ""
+			if parent != nil {
+				parentID = parent.MaterialID
+			}
+			list := uses[node.MaterialID]
+			for k := range list {
+				if list[k].Target == i && list[k].ParentID == parentID {
+					list[k].AmountMB += node.AmountMB
+					return
+				}
+			}
+			uses[node.MaterialID] = append(list, IntermediateUse{Target: i, ParentID: parentID, AmountMB: node.AmountMB})
+		})
+	}
+	for id, mB := range plan.TotalMB {
+		plan.TotalIngots[id] = mB / 100.0
+	}
+
+	for id, list := range uses {
+		if len(list) < 2 {
+			continue
+		}
+		shared := SharedIntermediate{ID: id, Uses: list}
+		for _, u := range list {
+			shared.TotalMB += u.AmountMB
+		}
+		plan.Shared = append(plan.Shared, shared)
+	}
+	sort.Slice(plan.Shared, func(i, j int) bool { return plan.Shared[i].ID < plan.Shared[j].ID })
+	return plan, nil
+}
@@ -1,25 +1,29 @@
 package calculator
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
+	"math/big"
 	"math/rand"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"tfccalc/data"
 	"time"
 )
 
-// TestMain sets up the shared DB connection for all tests.
+// calc is the Calculator shared by all tests. It runs on the in-memory
+// default catalog, so the suite does not need a database.
+var calc *Calculator
+
+var ctx = context.Background()
+
+// TestMain sets up the shared Calculator for all tests.
 func TestMain(m *testing.M) {
-	dsn := fmt.Sprintf(
-		"%s:%s@tcp(%s:%d)/%s?parseTime=true&charset=utf8mb4",
-		"tfccalc_user", "tfccalc_pass", "127.0.0.1", 3405, "tfccalc_db",
-	)
-	if err := data.InitDB(dsn); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to initialize DB: %v\n", err)
-		os.Exit(1)
-	}
+	calc = New(data.NewMemoryStore(data.DefaultAlloys()))
 	os.Exit(m.Run())
 }
 
@@ -47,7 +51,7 @@ func TestGetDefaultPercentages_Brass(t *testing.T) {
 		"copper": 90.0,
 		"zinc":   10.0,
 	}
-	got, err := GetDefaultPercentages("brass")
+	got, err := calc.GetDefaultPercentages(ctx, "brass")
 	if err != nil {
 		t.Fatalf("GetDefaultPercentages(brass) returned error: %v", err)
 	}
@@ -59,28 +63,28 @@ func TestGetDefaultPercentages_Brass(t *testing.T) {
 func TestValidatePercentages_ValidAndInvalid(t *testing.T) {
 	// Valid percentages: copper=90, zinc=10
 	valid := map[string]float64{"copper": 90.0, "zinc": 10.0}
-	ok, err := ValidatePercentages("brass", valid)
+	ok, err := calc.ValidatePercentages(ctx, "brass", valid)
 	if !ok || err != nil {
 		t.Errorf("ValidatePercentages(valid) = (%v,%v), want (true,nil)", ok, err)
 	}
 
 	// Missing key: only copper
 	missing := map[string]float64{"copper": 90.0}
-	ok2, _ := ValidatePercentages("brass", missing)
+	ok2, _ := calc.ValidatePercentages(ctx, "brass", missing)
 	if ok2 {
 		t.Errorf("ValidatePercentages(missing) = true, want false")
 	}
 
 	// Out of range: copper=95, zinc=5
 	outOfRange := map[string]float64{"copper": 95.0, "zinc": 5.0}
-	ok3, _ := ValidatePercentages("brass", outOfRange)
+	ok3, _ := calc.ValidatePercentages(ctx, "brass", outOfRange)
 	if ok3 {
 		t.Errorf("ValidatePercentages(outOfRange) = true, want false")
 	}
 
 	// Sum not equal to 100: copper=80, zinc=10
 	sumWrong := map[string]float64{"copper": 80.0, "zinc": 10.0}
-	ok4, _ := ValidatePercentages("brass", sumWrong)
+	ok4, _ := calc.ValidatePercentages(ctx, "brass", sumWrong)
 	if ok4 {
 		t.Errorf("ValidatePercentages(sumWrong) = true, want false")
 	}
@@ -88,7 +92,7 @@ func TestValidatePercentages_ValidAndInvalid(t *testing.T) {
 
 func TestResolvePercentagesForAlloy_CustomAndDefaults(t *testing.T) {
 	// Case A: empty userPerc → defaults
-	gotA, errA := ResolvePercentagesForAlloy("brass", nil)
+	gotA, errA := calc.ResolvePercentagesForAlloy(ctx, "brass", nil)
 	if errA != nil {
 		t.Fatalf("ResolvePercentagesForAlloy(empty) returned error: %v", errA)
 	}
@@ -99,7 +103,7 @@ func TestResolvePercentagesForAlloy_CustomAndDefaults(t *testing.T) {
 
 	// Case B: partial user map → sum 102 → invalid → defaults
 	userB := map[string]float64{"copper": 92.0}
-	gotB, errB := ResolvePercentagesForAlloy("brass", userB)
+	gotB, errB := calc.ResolvePercentagesForAlloy(ctx, "brass", userB)
 	if errB != nil {
 		t.Fatalf("ResolvePercentagesForAlloy(partial) returned error: %v", errB)
 	}
@@ -109,7 +113,7 @@ func TestResolvePercentagesForAlloy_CustomAndDefaults(t *testing.T) {
 
 	// Case C: out of range → invalid → defaults
 	userC := map[string]float64{"copper": 200.0, "zinc": 0.0}
-	gotC, errC := ResolvePercentagesForAlloy("brass", userC)
+	gotC, errC := calc.ResolvePercentagesForAlloy(ctx, "brass", userC)
 	if errC != nil {
 		t.Fatalf("ResolvePercentagesForAlloy(invalid) returned error: %v", errC)
 	}
@@ -130,7 +134,7 @@ func TestSumMaterials(t *testing.T) {
 
 func TestGetBaseMaterialBreakdown_SimpleAndNested(t *testing.T) {
 	// Base: "copper" → itself
-	baseRes, errBase := getBaseMaterialBreakdown("copper", 50.0, nil, 0)
+	baseRes, errBase := calc.getBaseMaterialBreakdown(ctx, "copper", 50.0, nil, 0)
 	if errBase != nil {
 		t.Fatalf("getBaseMaterialBreakdown(base) error: %v", errBase)
 	}
@@ -140,7 +144,7 @@ func TestGetBaseMaterialBreakdown_SimpleAndNested(t *testing.T) {
 	}
 
 	// Alloy: "brass" 100mB → 90 copper, 10 zinc
-	alloyRes, errAlloy := getBaseMaterialBreakdown("brass", 100.0, nil, 0)
+	alloyRes, errAlloy := calc.getBaseMaterialBreakdown(ctx, "brass", 100.0, nil, 0)
 	if errAlloy != nil {
 		t.Fatalf("getBaseMaterialBreakdown(brass) error: %v", errAlloy)
 	}
@@ -152,7 +156,7 @@ func TestGetBaseMaterialBreakdown_SimpleAndNested(t *testing.T) {
 	// Nested: "black_steel" 100mB
 	// raw_black_steel breakdown: steel=60→pig_iron=60, nickel=20, black_bronze=20→copper=12,zinc=4,nickel=4
 	// totals: pig_iron=60, nickel=24, copper=12, zinc=4; extra pig_iron=100 → pig_iron=160
-	res, errNested := getBaseMaterialBreakdown("black_steel", 100.0, nil, 0)
+	res, errNested := calc.getBaseMaterialBreakdown(ctx, "black_steel", 100.0, nil, 0)
 	if errNested != nil {
 		t.Fatalf("getBaseMaterialBreakdown(black_steel) error: %v", errNested)
 	}
@@ -169,7 +173,7 @@ func TestGetBaseMaterialBreakdown_SimpleAndNested(t *testing.T) {
 
 func TestCalculateRequirements_Brass_And_BlackSteel(t *testing.T) {
 	// Brass, 100 Ingots → 100*100mB=10000mB → 9000 copper, 1000 zinc
-	mbMap, ingMap, err := CalculateRequirements("brass", 100.0, "Ingots", nil)
+	mbMap, ingMap, err := calc.CalculateRequirements(ctx, "brass", 100.0, "Ingots", nil)
 	if err != nil {
 		t.Fatalf("CalculateRequirements(brass) error: %v", err)
 	}
@@ -185,7 +189,7 @@ func TestCalculateRequirements_Brass_And_BlackSteel(t *testing.T) {
 	// Black steel, 50mB
 	// raw_black_steel(50): steel=30→pig_iron=30, nickel=10, black_bronze=10→copper=6,zinc=2,nickel=2
 	// totals: pig_iron=30, nickel=12, copper=6, zinc=2; extra pig_iron=50→pig_iron=80
-	mbMap2, ingMap2, err2 := CalculateRequirements("black_steel", 50.0, "mB", nil)
+	mbMap2, ingMap2, err2 := calc.CalculateRequirements(ctx, "black_steel", 50.0, "mB", nil)
 	if err2 != nil {
 		t.Fatalf("CalculateRequirements(black_steel) error: %v", err2)
 	}
@@ -212,49 +216,100 @@ func TestCalculateRequirements_Brass_And_BlackSteel(t *testing.T) {
 // Test for invalid inputs to CalculateRequirements.
 func TestCalculateRequirements_ErrorCases(t *testing.T) {
 	// Amount ≤ 0 should return an error.
-	_, _, err1 := CalculateRequirements("brass", 0, "mB", nil)
+	_, _, err1 := calc.CalculateRequirements(ctx, "brass", 0, "mB", nil)
 	if err1 == nil || err1.Error() != "amount must be positive" {
 		t.Errorf("CalculateRequirements(brass, 0, …) error = %v, want \"amount must be positive\"", err1)
 	}
-	_, _, err2 := CalculateRequirements("brass", -5, "mB", nil)
+	_, _, err2 := calc.CalculateRequirements(ctx, "brass", -5, "mB", nil)
 	if err2 == nil || err2.Error() != "amount must be positive" {
 		t.Errorf("CalculateRequirements(brass, -5, …) error = %v, want \"amount must be positive\"", err2)
 	}
 
 	// Invalid mode should return an error.
-	_, _, err3 := CalculateRequirements("brass", 10, "WrongMode", nil)
+	_, _, err3 := calc.CalculateRequirements(ctx, "brass", 10, "WrongMode", nil)
 	expectedModeErr := `invalid mode; only "mB" or "Ingots"`
 	if err3 == nil || err3.Error() != expectedModeErr {
 		t.Errorf("CalculateRequirements(brass, 10, WrongMode) error = %v, want %q", err3, expectedModeErr)
 	}
 
 	// Nonexistent alloy ID should return an error.
-	_, _, err4 := CalculateRequirements("nonexistent", 10, "mB", nil)
+	_, _, err4 := calc.CalculateRequirements(ctx, "nonexistent", 10, "mB", nil)
 	expectedAlloyErr := "alloy nonexistent not found"
 	if err4 == nil || err4.Error() != expectedAlloyErr {
 		t.Errorf("CalculateRequirements(nonexistent, 10, mB) error = %v, want %q", err4, expectedAlloyErr)
 	}
+	if !errors.Is(err4, data.ErrNotFound) {
+		t.Errorf("CalculateRequirements(nonexistent) error %v does not wrap data.ErrNotFound", err4)
+	}
+}
+
+// failingStore answers lookups of "brass" and fails every other lookup, like a
+// database that goes away in the middle of a calculation.
+type failingStore struct {
+	data.RecipeStore
+	err error
+}
+
+func (s failingStore) GetAlloyByID(ctx context.Context, id string) (data.AlloyInfo, error) {
+	if id == "brass" {
+		return s.RecipeStore.GetAlloyByID(ctx, id)
+	}
+	return data.AlloyInfo{}, s.err
+}
+
+// Store failures must reach the caller instead of being reported as a missing
+// alloy or replaced by default percentages.
+func TestCalculateRequirements_StoreError(t *testing.T) {
+	outage := errors.New("connection refused")
+	c := New(failingStore{RecipeStore: data.NewMemoryStore(data.DefaultAlloys()), err: outage})
+
+	_, _, err := c.CalculateRequirements(ctx, "brass", 100, "mB", nil)
+	if !errors.Is(err, outage) {
+		t.Errorf("CalculateRequirements error = %v, want it to wrap %v", err, outage)
+	}
+	if errors.Is(err, data.ErrNotFound) {
+		t.Errorf("CalculateRequirements error %v wraps ErrNotFound for a store outage", err)
+	}
+
+	// Out-of-range percentages still fall back to defaults; the failed lookup of
+	// zinc's display name only changes the warning text.
+	_, err = c.ResolvePercentagesForAlloy(ctx, "brass", map[string]float64{"copper": 80, "zinc": 20})
+	if err != nil {
+		t.Errorf("ResolvePercentagesForAlloy(out of range) error = %v, want defaults", err)
+	}
+}
+
+func TestValidatePercentages_ValidationError(t *testing.T) {
+	_, err := calc.ValidatePercentages(ctx, "brass", map[string]float64{"copper": 80, "zinc": 20})
+	var valErr *ValidationError
+	if !errors.As(err, &valErr) || valErr.AlloyID != "brass" {
+		t.Errorf("ValidatePercentages(out of range) error = %#v, want a *ValidationError for brass", err)
+	}
+	_, err = calc.ValidatePercentages(ctx, "nonexistent", nil)
+	if errors.As(err, &valErr) || !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("ValidatePercentages(nonexistent) error = %v, want ErrNotFound", err)
+	}
 }
 
 // Test boundary conditions for ValidatePercentages.
 func TestValidatePercentages_Boundaries(t *testing.T) {
 	// Exact minimum values.
 	validMin := map[string]float64{"copper": 88.0, "zinc": 12.0}
-	ok1, err1 := ValidatePercentages("brass", validMin)
+	ok1, err1 := calc.ValidatePercentages(ctx, "brass", validMin)
 	if !ok1 || err1 != nil {
 		t.Errorf("ValidatePercentages(boundary min) = (%v,%v), want (true,nil)", ok1, err1)
 	}
 
 	// Exact maximum values.
 	validMax := map[string]float64{"copper": 92.0, "zinc": 8.0}
-	ok2, err2 := ValidatePercentages("brass", validMax)
+	ok2, err2 := calc.ValidatePercentages(ctx, "brass", validMax)
 	if !ok2 || err2 != nil {
 		t.Errorf("ValidatePercentages(boundary max) = (%v,%v), want (true,nil)", ok2, err2)
 	}
 
 	// Sum within EPS: 89.999 + 10.001 = 100.000
 	almost := map[string]float64{"copper": 89.999, "zinc": 10.001}
-	ok3, err3 := ValidatePercentages("brass", almost)
+	ok3, err3 := calc.ValidatePercentages(ctx, "brass", almost)
 	if !ok3 || err3 != nil {
 		t.Errorf("ValidatePercentages(almost sum 100) = (%v,%v), want (true,nil)", ok3, err3)
 	}
@@ -263,7 +318,7 @@ func TestValidatePercentages_Boundaries(t *testing.T) {
 // Test that an exact user map is returned unchanged.
 func TestResolvePercentagesForAlloy_ExactUserMap(t *testing.T) {
 	user := map[string]float64{"copper": 90.0, "zinc": 10.0}
-	got, err := ResolvePercentagesForAlloy("brass", user)
+	got, err := calc.ResolvePercentagesForAlloy(ctx, "brass", user)
 	if err != nil {
 		t.Fatalf("ResolvePercentagesForAlloy(exact) returned error: %v", err)
 	}
@@ -274,7 +329,7 @@ func TestResolvePercentagesForAlloy_ExactUserMap(t *testing.T) {
 
 // Test that an empty (non-nil) user map falls back to defaults.
 func TestResolvePercentagesForAlloy_EmptyMap(t *testing.T) {
-	got, err := ResolvePercentagesForAlloy("brass", map[string]float64{})
+	got, err := calc.ResolvePercentagesForAlloy(ctx, "brass", map[string]float64{})
 	if err != nil {
 		t.Fatalf("ResolvePercentagesForAlloy(empty map) returned error: %v", err)
 	}
@@ -287,7 +342,7 @@ func TestResolvePercentagesForAlloy_EmptyMap(t *testing.T) {
 // Test that “steel” is handled inside getBaseMaterialBreakdown.
 func TestGetBaseMaterialBreakdown_SteelInsideAlloy(t *testing.T) {
 	// raw_black_steel(100): steel=60→pig_iron=60, nickel=20, black_bronze=20→copper=12,zinc=4,nickel=4
-	res, err := getBaseMaterialBreakdown("raw_black_steel", 100.0, nil, 0)
+	res, err := calc.getBaseMaterialBreakdown(ctx, "raw_black_steel", 100.0, nil, 0)
 	if err != nil {
 		t.Fatalf("getBaseMaterialBreakdown(raw_black_steel) returned error: %v", err)
 	}
@@ -309,25 +364,25 @@ func TestRandomValidatePercentages(t *testing.T) {
 		cu := rand.Float64() * 100.0 // 0..100
 		zn := 100.0 - cu             // so they always sum exactly 100
 		m := map[string]float64{"copper": cu, "zinc": zn}
-		ok, _ := ValidatePercentages("brass", m)
+		ok, _ := calc.ValidatePercentages(ctx, "brass", m)
 
 		// The only way it should pass is if cu∈[88,92] and zn∈[8,12] (and they sum=100).
 		inside := (cu >= 88.0 && cu <= 92.0) && (zn >= 8.0 && zn <= 12.0)
 		if ok != inside {
-			t.Errorf("iter %d: ValidatePercentages(brass, %#v) = %v, want %v", i, m, ok, inside)
+			t.Errorf("iter %d: calc.ValidatePercentages(brass, %#v) = %v, want %v", i, m, ok, inside)
 		}
 	}
 }
 
 // TestRandomCalculateBreakdown picks a random positive amount (0 < amt ≤ 1000),
-// calls getBaseMaterialBreakdown("brass", amt, nil, 0), and then checks that
+// calls calc.getBaseMaterialBreakdown("brass", amt, nil, 0), and then checks that
 // the returned base‐metal totals sum exactly to amt and that no negative values appear.
 func TestRandomCalculateBreakdown(t *testing.T) {
 	rand.Seed(time.Now().UnixNano())
 	const iterations = 200
 	for i := 0; i < iterations; i++ {
 		amt := rand.Float64()*999.0 + 1.0 // 1…1000 mB
-		m, err := getBaseMaterialBreakdown("brass", amt, nil, 0)
+		m, err := calc.getBaseMaterialBreakdown(ctx, "brass", amt, nil, 0)
 		if err != nil {
 			t.Fatalf("iteration %d: unexpected error: %v", i, err)
 		}
@@ -344,3 +399,806 @@ func TestRandomCalculateBreakdown(t *testing.T) {
 		}
 	}
 }
+
+// checkUnitMix verifies that a UnitMix adds up and stays within the recipe ranges.
+func checkUnitMix(t *testing.T, mix *UnitMix) {
+	t.Helper()
+	alloy, err := calc.Store().GetAlloyByID(ctx, mix.AlloyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0
+	for i, part := range mix.Ingredients {
+		ing := alloy.Ingredients[i]
+		melted := 0
+		for _, uc := range part.Units {
+			melted += uc.Unit.MB * uc.Count
+			if uc.Unit.Max > 0 && uc.Count > uc.Unit.Max {
+				t.Errorf("%s: %d × %s exceeds the stock of %d", ing.IngredientID, uc.Count, uc.Unit.Name, uc.Unit.Max)
+			}
+		}
+		if melted != part.AmountMB {
+			t.Errorf("%s: units melt to %d mB, want %d", ing.IngredientID, melted, part.AmountMB)
+		}
+		if part.Percent < ing.Min-0.001 || part.Percent > ing.Max+0.001 {
+			t.Errorf("%s: %.3f%% outside [%v–%v]", ing.IngredientID, part.Percent, ing.Min, ing.Max)
+		}
+		total += part.AmountMB
+	}
+	if total != mix.AmountMB {
+		t.Errorf("ingredients add up to %d mB, want %d", total, mix.AmountMB)
+	}
+	if mix.Exact != (mix.AmountMB == mix.TargetMB) {
+		t.Errorf("Exact = %v for %d of %d mB", mix.Exact, mix.AmountMB, mix.TargetMB)
+	}
+}
+
+func TestSolveUnits_Exact(t *testing.T) {
+	mix, err := calc.SolveUnits(ctx, "brass", 1000, nil)
+	if err != nil {
+		t.Fatalf("SolveUnits(brass, 1000) error: %v", err)
+	}
+	checkUnitMix(t, mix)
+	if !mix.Exact {
+		t.Fatalf("SolveUnits(brass, 1000) = %d mB, want an exact mix", mix.AmountMB)
+	}
+	// The midpoints are reachable, and whole ingots are the fewest pieces.
+	want := []IngredientUnits{
+		{IngredientID: "copper", AmountMB: 900, Percent: 90, Units: []UnitCount{{Ingot, 9}}},
+		{IngredientID: "zinc", AmountMB: 100, Percent: 10, Units: []UnitCount{{Ingot, 1}}},
+	}
+	if !reflect.DeepEqual(mix.Ingredients, want) {
+		t.Errorf("SolveUnits(brass, 1000) = %+v, want %+v", mix.Ingredients, want)
+	}
+}
+
+func TestSolveUnits_OrePieces(t *testing.T) {
+	for _, target := range []int{70, 144, 250, 432, 1000, 2015} {
+		mix, err := calc.SolveUnits(ctx, "bismuth_bronze", target, nil)
+		if err != nil {
+			t.Fatalf("SolveUnits(bismuth_bronze, %d) error: %v", target, err)
+		}
+		checkUnitMix(t, mix)
+		// Every piece is a multiple of 5 mB, so only those targets can be exact.
+		if mix.Exact != (target%5 == 0) {
+			t.Errorf("SolveUnits(bismuth_bronze, %d) = %d mB, exact %v", target, mix.AmountMB, mix.Exact)
+		}
+		if d := mix.AmountMB - target; d < -2 || d > 2 {
+			t.Errorf("SolveUnits(bismuth_bronze, %d) = %d mB, want the nearest multiple of 5", target, mix.AmountMB)
+		}
+	}
+}
+
+func TestSolveUnits_Nearest(t *testing.T) {
+	// With ingots only, brass needs 8–9 copper per zinc, so 500 mB cannot be hit.
+	ingots := map[string][]Unit{"copper": {Ingot}, "zinc": {Ingot}}
+	mix, err := calc.SolveUnits(ctx, "brass", 500, ingots)
+	if err != nil {
+		t.Fatalf("SolveUnits(brass, 500, ingots) error: %v", err)
+	}
+	checkUnitMix(t, mix)
+	if mix.Exact || mix.AmountMB != 900 {
+		t.Errorf("SolveUnits(brass, 500, ingots) = %d mB (exact %v), want the nearest mix of 900 mB", mix.AmountMB, mix.Exact)
+	}
+
+	// Two copper ingots are all there is, so the mix stays small.
+	stock := Ingot
+	stock.Max = 2
+	mix, err = calc.SolveUnits(ctx, "brass", 1000, map[string][]Unit{"copper": {stock}})
+	if err != nil {
+		t.Fatalf("SolveUnits(brass, 1000, 2 ingots) error: %v", err)
+	}
+	checkUnitMix(t, mix)
+	if mix.Exact || mix.AmountMB > 230 {
+		t.Errorf("SolveUnits(brass, 1000, 2 ingots) = %d mB, want at most 230", mix.AmountMB)
+	}
+}
+
+func TestSolveUnits_Errors(t *testing.T) {
+	rich := RichOre
+	rich.Max = 1
+	_, err := calc.SolveUnits(ctx, "brass", 100, map[string][]Unit{"copper": {rich}, "zinc": {Ingot}})
+	if !errors.Is(err, ErrNoUnitMix) {
+		t.Errorf("SolveUnits with one rich copper ore error = %v, want ErrNoUnitMix", err)
+	}
+
+	for _, tc := range []struct {
+		id     string
+		amount int
+	}{{"brass", 0}, {"copper", 100}, {"black_steel", 100}} {
+		_, err := calc.SolveUnits(ctx, tc.id, tc.amount, nil)
+		var vErr *ValidationError
+		if !errors.As(err, &vErr) {
+			t.Errorf("SolveUnits(%s, %d) error = %v, want a *ValidationError", tc.id, tc.amount, err)
+		}
+	}
+}
+
+func TestMaxProducible_Brass(t *testing.T) {
+	// Copper runs out first: at the 88% minimum, 900 mB of copper makes 1022.7 mB.
+	inv := map[string]float64{"copper": 900, "zinc": 200}
+	y, err := calc.MaxProducible(ctx, "brass", inv)
+	if err != nil {
+		t.Fatalf("MaxProducible(brass) error: %v", err)
+	}
+	if math.Abs(y.AmountMB-900/0.88) > 0.001 {
+		t.Errorf("MaxProducible(brass) = %.3f mB, want %.3f", y.AmountMB, 900/0.88)
+	}
+	if want := map[string]float64{"copper": 88, "zinc": 12}; !floatMapEqual(y.Percentages["brass"], want, 0.0001) {
+		t.Errorf("MaxProducible(brass) percentages = %v, want %v", y.Percentages["brass"], want)
+	}
+	if want := map[string]float64{"copper": 0, "zinc": 200 - 900/0.88*0.12}; !floatMapEqual(y.LeftoverMB, want, 0.001) {
+		t.Errorf("MaxProducible(brass) leftover = %v, want %v", y.LeftoverMB, want)
+	}
+}
+
+func TestMaxProducible_FinalSteels(t *testing.T) {
+	inv := map[string]float64{
+		"pig_iron": 5000, "nickel": 1200, "copper": 2000, "zinc": 400,
+		"bismuth": 300, "silver": 900,
+	}
+	for _, id := range []string{"black_steel", "blue_steel"} {
+		y, err := calc.MaxProducible(ctx, id, inv)
+		if err != nil {
+			t.Fatalf("MaxProducible(%s) error: %v", id, err)
+		}
+		if y.AmountMB <= 0 {
+			t.Fatalf("MaxProducible(%s) = %v mB, want a positive amount", id, y.AmountMB)
+		}
+		// The returned percentages reproduce the plan, and it fits the inventory.
+		need, _, err := calc.CalculateRequirements(ctx, id, y.AmountMB, "mB", y.Percentages)
+		if err != nil {
+			t.Fatalf("CalculateRequirements(%s) with the returned percentages: %v", id, err)
+		}
+		if !floatMapEqual(need, y.UsedMB, 0.001) {
+			t.Errorf("%s: CalculateRequirements = %v, want UsedMB %v", id, need, y.UsedMB)
+		}
+		exhausted := false
+		for base, mB := range need {
+			if mB > inv[base]+0.001 {
+				t.Errorf("%s: needs %.3f mB of %s, only %.0f in stock", id, mB, base, inv[base])
+			}
+			if y.LeftoverMB[base] < 0.001 {
+				exhausted = true
+			}
+		}
+		if !exhausted {
+			t.Errorf("%s: leftover %v, want some metal to run out at the maximum", id, y.LeftoverMB)
+		}
+		// Making a little more with any mix must not fit: with the default mix it
+		// certainly does not.
+		more, _, err := calc.CalculateRequirements(ctx, id, y.AmountMB*1.01, "mB", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fits := true
+		for base, mB := range more {
+			fits = fits && mB <= inv[base]
+		}
+		if fits {
+			t.Errorf("%s: %.1f mB with default percentages fits the inventory, want %.1f to be the maximum", id, y.AmountMB*1.01, y.AmountMB)
+		}
+	}
+}
+
+func TestMaxProducible_EmptyAndInvalid(t *testing.T) {
+	y, err := calc.MaxProducible(ctx, "black_bronze", map[string]float64{"copper": 1000})
+	if err != nil {
+		t.Fatalf("MaxProducible without zinc or nickel error: %v", err)
+	}
+	if y.AmountMB != 0 || y.LeftoverMB["copper"] != 1000 {
+		t.Errorf("MaxProducible without zinc or nickel = %+v, want nothing made", y)
+	}
+
+	for _, inv := range []map[string]float64{{"copper": -1}, {"brass": 100}} {
+		_, err := calc.MaxProducible(ctx, "brass", inv)
+		var vErr *ValidationError
+		if !errors.As(err, &vErr) {
+			t.Errorf("MaxProducible(brass, %v) error = %v, want a *ValidationError", inv, err)
+		}
+	}
+	if _, err := calc.MaxProducible(ctx, "brass", map[string]float64{"bronze": 100}); !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("MaxProducible with unknown metal error = %v, want ErrNotFound", err)
+	}
+	if _, err := calc.MaxProducible(ctx, "bronze", nil); !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("MaxProducible(bronze) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestCalculateBatch(t *testing.T) {
+	targets := []BatchTarget{
+		{AlloyID: "blue_steel", Amount: 4, Mode: "Ingots"},
+		{AlloyID: "bismuth_bronze", Amount: 10, Mode: "Ingots"},
+		{AlloyID: "black_steel", Amount: 250, Mode: "mB",
+			Percentages: map[string]map[string]float64{"black_bronze": {"copper": 50, "zinc": 25, "nickel": 25}}},
+	}
+	plan, err := calc.CalculateBatch(ctx, targets)
+	if err != nil {
+		t.Fatalf("CalculateBatch error: %v", err)
+	}
+
+	// Per-target figures match single calculations, and the totals add them up.
+	total := make(map[string]float64)
+	for i, target := range targets {
+		want, _, err := calc.CalculateRequirements(ctx, target.AlloyID, target.Amount, target.Mode, target.Percentages)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !floatMapEqual(plan.Targets[i].Result.TotalMB, want, 0.0001) {
+			t.Errorf("target %s = %v, want %v", target.AlloyID, plan.Targets[i].Result.TotalMB, want)
+		}
+		total = sumMaterials(total, want)
+	}
+	if !floatMapEqual(plan.TotalMB, total, 0.0001) {
+		t.Errorf("TotalMB = %v, want %v", plan.TotalMB, total)
+	}
+	if plan.TotalIngots["pig_iron"] != plan.TotalMB["pig_iron"]/100 {
+		t.Errorf("TotalIngots[pig_iron] = %v, want %v", plan.TotalIngots["pig_iron"], plan.TotalMB["pig_iron"]/100)
+	}
+
+	shared := make(map[string]SharedIntermediate)
+	for _, s := range plan.Shared {
+		shared[s.ID] = s
+	}
+	// Blue steel uses black steel twice (in its raw form and as the extra
+	// ingredient); steel goes into raw black steel and raw blue steel. Bismuth
+	// bronze is a target and also goes into raw blue steel.
+	for _, id := range []string{"black_steel", "steel", "black_bronze", "raw_black_steel", "bismuth_bronze"} {
+		if _, ok := shared[id]; !ok {
+			t.Errorf("Shared = %v, want %s listed", plan.Shared, id)
+		}
+	}
+	// Blue steel is only made as a target: not shared.
+	if _, ok := shared["blue_steel"]; ok {
+		t.Errorf("blue_steel listed as shared: %+v", shared["blue_steel"])
+	}
+	// 400 mB of blue steel needs 400 mB black steel as the extra ingredient and
+	// 52.5% of 400 mB in its raw form; target 2 is 250 mB of black steel itself.
+	if bs := shared["black_steel"]; math.Abs(bs.TotalMB-(400+400*0.525+250)) > 0.0001 || len(bs.Uses) != 3 {
+		t.Errorf("black_steel = %+v, want 860 mB in 3 uses", bs)
+	}
+	// Black bronze shows up in both steel targets.
+	targetsUsing := make(map[int]bool)
+	for _, u := range shared["black_bronze"].Uses {
+		targetsUsing[u.Target] = true
+	}
+	if !targetsUsing[0] || !targetsUsing[2] {
+		t.Errorf("black_bronze uses = %+v, want targets 0 and 2", shared["black_bronze"].Uses)
+	}
+}
+
+// A target that another target also needs is a shared intermediate.
+func TestCalculateBatch_TargetInsideTarget(t *testing.T) {
+	plan, err := calc.CalculateBatch(ctx, []BatchTarget{
+		{AlloyID: "steel", Amount: 100, Mode: "mB"},
+		{AlloyID: "blue_steel", Amount: 100, Mode: "mB"},
+	})
+	if err != nil {
+		t.Fatalf("CalculateBatch error: %v", err)
+	}
+	var steel *SharedIntermediate
+	for i := range plan.Shared {
+		if plan.Shared[i].ID == "steel" {
+			steel = &plan.Shared[i]
+		}
+	}
+	if steel == nil {
+		t.Fatalf("Shared = %+v, want steel listed", plan.Shared)
+	}
+	own := IntermediateUse{Target: 0, ParentID: "", AmountMB: 100}
+	if steel.Uses[0] != own {
+		t.Errorf("first steel use = %+v, want %+v", steel.Uses[0], own)
+	}
+	for _, u := range steel.Uses[1:] {
+		if u.Target != 1 || u.ParentID == "" {
+			t.Errorf("steel use %+v, want one inside blue steel", u)
+		}
+	}
+}
+
+func TestCalculateBatch_Errors(t *testing.T) {
+	if _, err := calc.CalculateBatch(ctx, nil); err == nil {
+		t.Errorf("CalculateBatch(nil) succeeded, want an error")
+	}
+	_, err := calc.CalculateBatch(ctx, []BatchTarget{
+		{AlloyID: "brass", Amount: 1, Mode: "Ingots"},
+		{AlloyID: "bronze", Amount: 1, Mode: "Ingots"},
+	})
+	if !errors.Is(err, data.ErrNotFound) || !strings.Contains(err.Error(), "target 2") {
+		t.Errorf("CalculateBatch with an unknown alloy error = %v, want ErrNotFound for target 2", err)
+	}
+}
+
+func TestPlanMelts_BlackBronze(t *testing.T) {
+	plan, err := calc.PlanMelts(ctx, "black_bronze", 40, "Ingots", nil, Crucible)
+	if err != nil {
+		t.Fatalf("PlanMelts(black_bronze) error: %v", err)
+	}
+	want := []Melt{{
+		AlloyID: "black_bronze", TotalMB: 4000, Runs: 2, RunMB: 2000,
+		LoadMB: map[string]float64{"copper": 1200, "zinc": 400, "nickel": 400},
+	}}
+	if !reflect.DeepEqual(plan.Melts, want) {
+		t.Errorf("PlanMelts(black_bronze, crucible) = %+v, want %+v", plan.Melts, want)
+	}
+
+	plan, err = calc.PlanMelts(ctx, "black_bronze", 40, "Ingots", nil, SmallVessel)
+	if err != nil {
+		t.Fatalf("PlanMelts(black_bronze, vessel) error: %v", err)
+	}
+	if m := plan.Melts[0]; m.Runs != 8 || m.RunMB != 500 {
+		t.Errorf("PlanMelts(black_bronze, vessel) = %d runs of %v mB, want 8 of 500", m.Runs, m.RunMB)
+	}
+}
+
+func TestPlanMelts_BlueSteelOrder(t *testing.T) {
+	plan, err := calc.PlanMelts(ctx, "blue_steel", 50, "Ingots", nil, Crucible)
+	if err != nil {
+		t.Fatalf("PlanMelts(blue_steel) error: %v", err)
+	}
+	pos := make(map[string]int)
+	for i, m := range plan.Melts {
+		pos[m.AlloyID] = i
+		if m.RunMB > Crucible.CapacityMB || math.Abs(m.RunMB*float64(m.Runs)-m.TotalMB) > 0.0001 {
+			t.Errorf("%s: %d runs of %v mB for %v mB", m.AlloyID, m.Runs, m.RunMB, m.TotalMB)
+		}
+		load := 0.0
+		for _, mB := range m.LoadMB {
+			load += mB
+		}
+		if math.Abs(load-m.RunMB) > 0.0001 {
+			t.Errorf("%s: load adds up to %v mB, want %v", m.AlloyID, load, m.RunMB)
+		}
+	}
+	// Steel and the final steels are not melted; everything else is, in build order.
+	for _, id := range []string{"steel", "black_steel", "blue_steel"} {
+		if _, ok := pos[id]; ok {
+			t.Errorf("%s is in the melt plan", id)
+		}
+	}
+	for _, order := range [][2]string{
+		{"black_bronze", "raw_black_steel"},
+		{"raw_black_steel", "raw_blue_steel"},
+		{"bismuth_bronze", "raw_blue_steel"},
+		{"sterling_silver", "raw_blue_steel"},
+	} {
+		before, ok1 := pos[order[0]]
+		after, ok2 := pos[order[1]]
+		if !ok1 || !ok2 || before > after {
+			t.Errorf("melt order %v: want %s before %s", plan.Melts, order[0], order[1])
+		}
+	}
+	// 5000 mB of raw blue steel fits in two runs.
+	if m := plan.Melts[pos["raw_blue_steel"]]; m.TotalMB != 5000 || m.Runs != 2 {
+		t.Errorf("raw_blue_steel = %+v, want 5000 mB in 2 runs", m)
+	}
+}
+
+func TestPlanMelts_Invalid(t *testing.T) {
+	_, err := calc.PlanMelts(ctx, "brass", 10, "Ingots", nil, Container{Name: "Bucket"})
+	var vErr *ValidationError
+	if !errors.As(err, &vErr) {
+		t.Errorf("PlanMelts with a zero capacity error = %v, want a *ValidationError", err)
+	}
+	if _, err := calc.PlanMelts(ctx, "brass", -1, "Ingots", nil, Crucible); err == nil {
+		t.Errorf("PlanMelts with a negative amount succeeded, want an error")
+	}
+}
+
+func TestProcessingSteps_BlackSteel(t *testing.T) {
+	steps, err := calc.ProcessingSteps(ctx, "black_steel", 100, "mB", nil)
+	if err != nil {
+		t.Fatalf("ProcessingSteps(black_steel) error: %v", err)
+	}
+	type summary struct {
+		material string
+		station  Station
+		action   string
+		output   string
+		mB       float64
+	}
+	want := []summary{
+		// 60 mB of pig iron for the steel in raw black steel, 100 mB for the weld.
+		{"pig_iron", StationBlastFurnace, "smelt", "pig_iron", 160},
+		{"black_bronze", StationCrucible, "melt", "black_bronze", 20},
+		{"steel", StationAnvil, "work", "high_carbon_steel", 60},
+		{"steel", StationAnvil, "work", "steel", 60},
+		{"raw_black_steel", StationCrucible, "melt", "raw_black_steel", 100},
+		{"black_steel", StationAnvil, "weld", "weak_black_steel", 100},
+		{"black_steel", StationWaterBarrel, "quench", "black_steel", 100},
+	}
+	var got []summary
+	for _, s := range steps {
+		got = append(got, summary{s.MaterialID, s.Station, s.Action, s.Output.ID, s.Output.AmountMB})
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ProcessingSteps(black_steel) =\n%v\nwant\n%v", got, want)
+	}
+
+	// Only the pig iron of the blast furnace has an amount.
+	for _, item := range steps[0].Inputs {
+		if item.AmountMB != 0 {
+			t.Errorf("blast furnace input %s has %v mB, want no amount", item.ID, item.AmountMB)
+		}
+	}
+
+	// The weld takes the raw form and the extra ingredient; the crucible the mix.
+	weld := steps[5]
+	if len(weld.Inputs) != 2 || weld.Inputs[0].ID != "raw_black_steel" || weld.Inputs[1].ID != "pig_iron" {
+		t.Errorf("weld inputs = %+v, want raw black steel and pig iron", weld.Inputs)
+	}
+	melt := steps[4]
+	in := make(map[string]float64)
+	for _, item := range melt.Inputs {
+		in[item.ID] = item.AmountMB
+	}
+	if want := map[string]float64{"steel": 60, "nickel": 20, "black_bronze": 20}; !floatMapEqual(in, want, 0.0001) {
+		t.Errorf("raw black steel melt inputs = %v, want %v", in, want)
+	}
+}
+
+func TestProcessingSteps_Simple(t *testing.T) {
+	steps, err := calc.ProcessingSteps(ctx, "brass", 2, "Ingots", nil)
+	if err != nil {
+		t.Fatalf("ProcessingSteps(brass) error: %v", err)
+	}
+	if len(steps) != 1 || steps[0].Station != StationCrucible || steps[0].Output.AmountMB != 200 {
+		t.Errorf("ProcessingSteps(brass) = %+v, want one 200 mB crucible melt", steps)
+	}
+	if _, err := calc.ProcessingSteps(ctx, "bronze", 1, "Ingots", nil); !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("ProcessingSteps(bronze) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestCalculate_Result(t *testing.T) {
+	userPerc := map[string]map[string]float64{
+		"black_bronze":    {"copper": 10, "zinc": 45, "nickel": 45}, // invalid → defaults
+		"rose_gold":       {"gold": 80, "silver": 20},               // not part of blue steel
+		"sterling_silver": {"silver": 92.5, "copper": 7.5},
+	}
+	res, err := calc.Calculate(ctx, "blue_steel", 1, "Ingots", userPerc)
+	if err != nil {
+		t.Fatalf("Calculate(blue_steel) error: %v", err)
+	}
+	if _, ok := userPerc["black_bronze"]["copper"]; !ok || userPerc["black_bronze"]["copper"] != 10 {
+		t.Errorf("Calculate modified the caller's percentages: %v", userPerc)
+	}
+
+	// Same totals as CalculateRequirements, and as the sum of the tree's leaves.
+	mb, ingots, err := calc.CalculateRequirements(ctx, "blue_steel", 1, "Ingots", userPerc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !floatMapEqual(res.TotalMB, mb, 0.0001) || !floatMapEqual(res.TotalIngots, ingots, 0.0001) {
+		t.Errorf("Calculate totals = %v / %v, want %v / %v", res.TotalMB, res.TotalIngots, mb, ingots)
+	}
+
+	root := res.Root
+	if root.MaterialID != "blue_steel" || root.AmountMB != 100 || len(root.Children) != 2 ||
+		root.Children[0].MaterialID != "raw_blue_steel" || root.Children[1].MaterialID != "black_steel" {
+		t.Fatalf("root = %+v, want blue steel made of raw blue steel and black steel", root)
+	}
+	raw := root.Children[0]
+	if want := map[string]float64{"black_steel": 52.5, "steel": 22.5, "bismuth_bronze": 12.5, "sterling_silver": 12.5}; !floatMapEqual(raw.Percentages, want, 0.0001) {
+		t.Errorf("raw blue steel percentages = %v, want %v", raw.Percentages, want)
+	}
+	// Nested deeper than the UI's old limit of five levels: blue steel → raw blue
+	// steel → black steel → raw black steel → black bronze → copper.
+	deepest := 0
+	root.Walk(func(_, _ *Node, level int) { deepest = max(deepest, level) })
+	if deepest < 5 {
+		t.Errorf("tree depth = %d, want at least 5", deepest)
+	}
+
+	if want := map[string]float64{"copper": 60, "zinc": 20, "nickel": 20}; !floatMapEqual(res.Percentages["black_bronze"], want, 0.0001) {
+		t.Errorf("black bronze percentages = %v, want the defaults %v", res.Percentages["black_bronze"], want)
+	}
+	if want := map[string]float64{"silver": 92.5, "copper": 7.5}; !floatMapEqual(res.Percentages["sterling_silver"], want, 0.0001) {
+		t.Errorf("sterling silver percentages = %v, want %v", res.Percentages["sterling_silver"], want)
+	}
+	joined := strings.Join(res.Warnings, "\n")
+	if len(res.Warnings) != 2 || !strings.Contains(joined, "invalid user percentages for black_bronze") || !strings.Contains(joined, "Rose Gold are not used") {
+		t.Errorf("Warnings = %q, want one for black bronze and one for rose gold", res.Warnings)
+	}
+	if len(res.Steps) == 0 || res.Steps[len(res.Steps)-1].Output.ID != "blue_steel" {
+		t.Errorf("Steps = %+v, want them to end with blue steel", res.Steps)
+	}
+}
+
+func TestTreeLines(t *testing.T) {
+	res, err := calc.Calculate(ctx, "black_bronze", 1, "Ingots", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := res.Root.Lines()
+	var got []string
+	for _, l := range lines {
+		got = append(got, fmt.Sprintf("%d %v %s", l.Depth(), l.IsLast(), l.Node.Label()))
+	}
+	want := []string{
+		"0 true Black Bronze (100.00mB | 1.000Ing)",
+		"1 false Copper (60.00mB | 0.600Ing)",
+		"1 false Zinc (20.00mB | 0.200Ing)",
+		"1 true Nickel (20.00mB | 0.200Ing)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Lines() = %q, want %q", got, want)
+	}
+
+	// Several roots are siblings, and every line knows which of its ancestors were last.
+	lines = TreeLines(res.Root, res.Root)
+	if len(lines) != 8 || lines[0].IsLast() || !reflect.DeepEqual(lines[3].Last, []bool{false, true}) || !lines[4].IsLast() {
+		t.Errorf("TreeLines of two roots = %+v", lines)
+	}
+}
+
+func TestCalculate_Exact(t *testing.T) {
+	exact := NewExact(calc.Store())
+	if !exact.Exact() || calc.Exact() {
+		t.Fatalf("Exact() = %v / %v, want true for NewExact and false for New", exact.Exact(), calc.Exact())
+	}
+
+	// 0.3 ingots of sterling silver are exactly 27.75 mB silver and 2.25 mB copper.
+	res, err := exact.Calculate(ctx, "sterling_silver", 0.3, "Ingots", nil)
+	if err != nil {
+		t.Fatalf("Calculate(sterling_silver) error: %v", err)
+	}
+	if res.ExactMB["silver"].Cmp(big.NewRat(111, 4)) != 0 || res.ExactMB["copper"].Cmp(big.NewRat(9, 4)) != 0 {
+		t.Errorf("ExactMB = %v, want silver 111/4 and copper 9/4", res.ExactMB)
+	}
+
+	// Awkward amounts and percentages several levels deep still add up exactly.
+	userPerc := map[string]map[string]float64{
+		"raw_blue_steel": {"black_steel": 53.3, "steel": 21.7, "bismuth_bronze": 12.5, "sterling_silver": 12.5},
+		"black_bronze":   {"copper": 55.55, "zinc": 22.22, "nickel": 22.23},
+	}
+	for _, amount := range []float64{7, 0.1, 1234.567} {
+		res, err := exact.Calculate(ctx, "raw_blue_steel", amount, "mB", userPerc)
+		if err != nil {
+			t.Fatalf("Calculate(raw_blue_steel, %v) error: %v", amount, err)
+		}
+		// Raw blue steel contains black steel, which needs its amount again in pig iron.
+		total := new(big.Rat)
+		for _, mB := range res.ExactMB {
+			total.Add(total, mB)
+		}
+		want, _ := ratFromFloat(amount)
+		want.Add(want, res.Root.Children[0].ExactMB)
+		if total.Cmp(want) != 0 {
+			t.Errorf("amount %v: exact total = %s, want %s", amount, total.RatString(), want.RatString())
+		}
+
+		// The float path drops parts under 0.001 mB, so compare only the larger amounts.
+		floats, err := calc.Calculate(ctx, "raw_blue_steel", amount, "mB", userPerc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if amount >= 1 && !floatMapEqual(res.TotalMB, floats.TotalMB, 0.0001) {
+			t.Errorf("amount %v: exact TotalMB = %v, float TotalMB = %v", amount, res.TotalMB, floats.TotalMB)
+		}
+		if floats.ExactMB != nil || floats.Root.ExactMB != nil {
+			t.Errorf("float calculation filled in exact amounts")
+		}
+	}
+}
+
+func TestBalancePercentages(t *testing.T) {
+	// Copper pinned above its default: zinc and nickel give up the difference evenly.
+	got, err := calc.BalancePercentages(ctx, "black_bronze", map[string]float64{"copper": 66})
+	if err != nil {
+		t.Fatalf("BalancePercentages(black_bronze) error: %v", err)
+	}
+	if want := map[string]float64{"copper": 66, "zinc": 17, "nickel": 17}; !floatMapEqual(got, want, 0.0001) {
+		t.Errorf("black bronze = %v, want %v", got, want)
+	}
+
+	// Raw blue steel with black steel at its maximum: steel, bismuth bronze and
+	// sterling silver each have 2.5% of room down from their defaults, so they share
+	// the 2.5% that black steel took equally.
+	got, err = calc.BalancePercentages(ctx, "raw_blue_steel", map[string]float64{"black_steel": 55})
+	if err != nil {
+		t.Fatalf("BalancePercentages(raw_blue_steel) error: %v", err)
+	}
+	want := map[string]float64{"black_steel": 55, "steel": 22.5 - 2.5/3, "bismuth_bronze": 12.5 - 2.5/3, "sterling_silver": 12.5 - 2.5/3}
+	if !floatMapEqual(got, want, 0.0001) {
+		t.Errorf("raw blue steel = %v, want %v", got, want)
+	}
+	if ok, err := calc.ValidatePercentages(ctx, "raw_blue_steel", got); !ok {
+		t.Errorf("balanced raw blue steel %v is invalid: %v", got, err)
+	}
+
+	// Nothing pinned gives the defaults; everything pinned is only validated.
+	defaults, _ := calc.GetDefaultPercentages(ctx, "brass")
+	if got, err := calc.BalancePercentages(ctx, "brass", nil); err != nil || !floatMapEqual(got, defaults, 0) {
+		t.Errorf("BalancePercentages(brass, nil) = %v, %v; want the defaults %v", got, err, defaults)
+	}
+	if got, err := calc.BalancePercentages(ctx, "brass", map[string]float64{"copper": 89, "zinc": 11}); err != nil || got["zinc"] != 11 {
+		t.Errorf("BalancePercentages(brass, complete) = %v, %v", got, err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		pinned map[string]float64
+		want   string
+	}{
+		{"too little left", map[string]float64{"copper": 70, "zinc": 25}, "less than their minimum"},
+		{"too much left", map[string]float64{"copper": 50, "zinc": 15}, "more than their maximum"},
+		{"out of range", map[string]float64{"copper": 80}, "outside"},
+		{"not an ingredient", map[string]float64{"gold": 10}, "not an ingredient"},
+		{"bad complete map", map[string]float64{"copper": 60, "zinc": 20, "nickel": 15}, "add up to 95.00%"},
+	} {
+		_, err := calc.BalancePercentages(ctx, "black_bronze", tc.pinned)
+		var verr *ValidationError
+		if !errors.As(err, &verr) || verr.AlloyID != "black_bronze" || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: error = %v, want a ValidationError containing %q", tc.name, err, tc.want)
+		}
+	}
+	if _, err := calc.BalancePercentages(ctx, "nonexistent", map[string]float64{"copper": 50}); !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("unknown alloy: error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestOptimizePercentages(t *testing.T) {
+	// Black bronze needs 15–25% nickel.
+	for _, tc := range []struct {
+		goal   Goal
+		nickel float64
+	}{
+		{Minimize("nickel"), 15},
+		{Maximize("nickel"), 25},
+	} {
+		perc, err := calc.OptimizePercentages(ctx, "black_bronze", tc.goal)
+		if err != nil {
+			t.Fatalf("OptimizePercentages(black_bronze, %+v) error: %v", tc.goal, err)
+		}
+		if got := perc["black_bronze"]["nickel"]; math.Abs(got-tc.nickel) > 1e-6 {
+			t.Errorf("%+v: nickel = %v%%, want %v%%", tc.goal, got, tc.nickel)
+		}
+		if ok, err := calc.ValidatePercentages(ctx, "black_bronze", perc["black_bronze"]); !ok {
+			t.Errorf("%+v: %v is invalid: %v", tc.goal, perc["black_bronze"], err)
+		}
+	}
+
+	// Blue steel takes its silver only from the sterling silver in raw blue steel,
+	// 10–15% of it at 92.5% silver: at least 9.25 mB per ingot.
+	perc, err := calc.OptimizePercentages(ctx, "blue_steel", Minimize("silver"))
+	if err != nil {
+		t.Fatalf("OptimizePercentages(blue_steel) error: %v", err)
+	}
+	mb, _, err := calc.CalculateRequirements(ctx, "blue_steel", 1, "Ingots", perc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(mb["silver"]-9.25) > 1e-6 {
+		t.Errorf("least silver for blue steel = %v mB, want 9.25", mb["silver"])
+	}
+
+	// The least nickel across the nested black steels beats the defaults, and
+	// every alloy stays valid.
+	perc, err = calc.OptimizePercentages(ctx, "blue_steel", Minimize("nickel"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, p := range perc {
+		if ok, err := calc.ValidatePercentages(ctx, id, p); !ok {
+			t.Errorf("%s: %v is invalid: %v", id, p, err)
+		}
+	}
+	optimal, _, _ := calc.CalculateRequirements(ctx, "blue_steel", 1, "Ingots", perc)
+	defaults, _, _ := calc.CalculateRequirements(ctx, "blue_steel", 1, "Ingots", nil)
+	if optimal["nickel"] >= defaults["nickel"]-1 {
+		t.Errorf("least nickel = %v mB, defaults use %v mB", optimal["nickel"], defaults["nickel"])
+	}
+	// Sterling silver has no nickel, so it keeps its defaults.
+	if want, _ := calc.GetDefaultPercentages(ctx, "sterling_silver"); !floatMapEqual(perc["sterling_silver"], want, 0) {
+		t.Errorf("sterling silver = %v, want the defaults %v", perc["sterling_silver"], want)
+	}
+
+	// A weighted cost: nickel five times as dear as zinc moves black bronze to the
+	// least nickel and then the least zinc.
+	perc, err = calc.OptimizePercentages(ctx, "black_bronze", Goal{Weights: map[string]float64{"nickel": 5, "zinc": 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]float64{"copper": 70, "zinc": 15, "nickel": 15}; !floatMapEqual(perc["black_bronze"], want, 1e-6) {
+		t.Errorf("weighted black bronze = %v, want %v", perc["black_bronze"], want)
+	}
+
+	// Brass can be made without nickel at all.
+	perc, err = calc.OptimizePercentages(ctx, "brass", Minimize("nickel"))
+	if want, _ := calc.GetDefaultPercentages(ctx, "brass"); err != nil || !floatMapEqual(perc["brass"], want, 0) {
+		t.Errorf("OptimizePercentages(brass, nickel) = %v, %v; want the defaults", perc, err)
+	}
+}
+
+func TestOptimizePercentages_Invalid(t *testing.T) {
+	for name, goal := range map[string]Goal{
+		"negative": {Weights: map[string]float64{"nickel": -1}},
+		"not base": {Weights: map[string]float64{"brass": 1}},
+		"all zero": {Weights: map[string]float64{"nickel": 0}},
+		"empty":    {},
+	} {
+		var verr *ValidationError
+		if _, err := calc.OptimizePercentages(ctx, "black_bronze", goal); !errors.As(err, &verr) {
+			t.Errorf("%s: error = %v, want a ValidationError", name, err)
+		}
+	}
+	if _, err := calc.OptimizePercentages(ctx, "black_bronze", Minimize("unobtainium")); !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("unknown metal: error = %v, want ErrNotFound", err)
+	}
+	if _, err := calc.OptimizePercentages(ctx, "nonexistent", Minimize("nickel")); !errors.Is(err, data.ErrNotFound) {
+		t.Errorf("unknown target: error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestCalculate_PathOverrides(t *testing.T) {
+	inner := "blue_steel/raw_blue_steel/black_steel/raw_black_steel"
+	outer := "blue_steel/black_steel/raw_black_steel"
+	userPerc := map[string]map[string]float64{
+		// The path of a final steel stands for its raw form.
+		"blue_steel/raw_blue_steel/black_steel": {"steel": 70, "nickel": 15, "black_bronze": 15},
+		"raw_black_steel":                       {"steel": 50, "nickel": 25, "black_bronze": 25},
+	}
+	res, err := calc.Calculate(ctx, "blue_steel", 1, "Ingots", userPerc)
+	if err != nil {
+		t.Fatalf("Calculate(blue_steel) error: %v", err)
+	}
+	if len(res.Warnings) != 0 {
+		t.Errorf("Warnings = %q, want none", res.Warnings)
+	}
+	got := make(map[string]map[string]float64)
+	res.Root.Walk(func(node, _ *Node, _ int) {
+		if node.MaterialID == "raw_black_steel" {
+			got[node.Path] = node.Percentages
+		}
+	})
+	if len(got) != 2 || got[inner]["steel"] != 70 || got[outer]["steel"] != 50 {
+		t.Errorf("raw black steel percentages by path = %v, want steel 70 at %s and 50 at %s", got, inner, outer)
+	}
+	if res.Percentages[inner]["steel"] != 70 || res.Percentages["raw_black_steel"]["steel"] != 50 {
+		t.Errorf("Result.Percentages = %v, want the path and the ID override", res.Percentages)
+	}
+
+	// Result.Percentages reproduces the calculation.
+	again, err := calc.Calculate(ctx, "blue_steel", 1, "Ingots", res.Percentages)
+	if err != nil || !floatMapEqual(again.TotalMB, res.TotalMB, 1e-9) || len(again.Warnings) != 0 {
+		t.Errorf("recalculating with Result.Percentages = %v, %q, %v; want %v", again.TotalMB, again.Warnings, err, res.TotalMB)
+	}
+
+	// The two mixes are melted apart.
+	plan, err := calc.PlanMelts(ctx, "blue_steel", 1, "Ingots", userPerc, Crucible)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, m := range plan.Melts {
+		if m.AlloyID == "raw_black_steel" {
+			paths = append(paths, m.Path)
+		}
+	}
+	if !reflect.DeepEqual(paths, []string{outer, inner}) {
+		t.Errorf("raw black steel melts at %q, want %q", paths, []string{outer, inner})
+	}
+
+	// So does the ID of a final steel.
+	res, err = calc.Calculate(ctx, "blue_steel", 1, "Ingots", map[string]map[string]float64{
+		"black_steel": {"steel": 50, "nickel": 25, "black_bronze": 25},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Warnings) != 0 || res.Percentages["raw_black_steel"]["nickel"] != 25 {
+		t.Errorf("black_steel override: warnings %q, percentages %v", res.Warnings, res.Percentages["raw_black_steel"])
+	}
+
+	// A path that is not in the tree is reported.
+	res, err = calc.Calculate(ctx, "blue_steel", 1, "Ingots", map[string]map[string]float64{
+		"blue_steel/steel/raw_black_steel": {"steel": 70, "nickel": 15, "black_bronze": 15},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Warnings) != 1 || !strings.Contains(res.Warnings[0], "blue_steel/steel/raw_black_steel are not used") {
+		t.Errorf("Warnings = %q, want the unused path", res.Warnings)
+	}
+}
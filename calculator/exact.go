@@ -0,0 +1,46 @@
+package calculator
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"tfccalc/data"
+)
+
+// An exact Calculator keeps every amount as a big.Rat next to its float64. Amounts
+// and percentages are read as the decimals they print as, so 92.5% is 185/2 and not
+// the nearest binary fraction, and an alloy is split in proportion to its
+// percentages: the parts always add up to the whole, even when the percentages only
+// add up to 100 within the tolerance of ValidatePercentages. Nothing is dropped for
+// being small. Results therefore stay exact however deep the tree is, e.g. sterling
+// silver inside raw blue steel inside blue steel.
+
+// ratFromFloat returns f as the decimal fraction it prints as.
+func ratFromFloat(f float64) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(f, 'f', -1, 64))
+	if !ok {
+		return nil, fmt.Errorf("%v is not a finite number", f)
+	}
+	return r, nil
+}
+
+// exactShares splits amountMB of alloy over its ingredients in proportion to perc.
+func exactShares(amountMB *big.Rat, alloy data.AlloyInfo, perc map[string]float64) (map[string]*big.Rat, error) {
+	parts := make(map[string]*big.Rat, len(alloy.Ingredients))
+	total := new(big.Rat)
+	for _, ing := range alloy.Ingredients {
+		part, err := ratFromFloat(perc[ing.IngredientID])
+		if err != nil {
+			return nil, fmt.Errorf("percentage for %s in %s: %w", ing.IngredientID, alloy.ID, err)
+		}
+		parts[ing.IngredientID] = part
+		total.Add(total, part)
+	}
+	if total.Sign() <= 0 {
+		return nil, fmt.Errorf("percentages for %s add up to %s", alloy.ID, total.FloatString(2))
+	}
+	for _, part := range parts {
+		part.Mul(part, amountMB).Quo(part, total)
+	}
+	return parts, nil
+}
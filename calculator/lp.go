@@ -0,0 +1,87 @@
+package calculator
+
+import (
+	"errors"
+	"math"
+)
+
+// lpEps is the tolerance of the simplex solver.
+const lpEps = 1e-9
+
+// errUnbounded is returned by maximize when the objective has no upper bound.
+var errUnbounded = errors.New("linear program is unbounded")
+
+// maximize solves max c·x subject to a·x ≤ b and x ≥ 0, where every b[i] ≥ 0, so
+// x = 0 is a feasible start. It runs the tableau simplex method with Bland's rule,
+// which cannot cycle on the many degenerate vertices the recipe models have.
+// The problems here have a few dozen variables, so a dense tableau is enough.
+func maximize(c []float64, a [][]float64, b []float64) ([]float64, error) {
+	m, n := len(a), len(c)
+	// Columns: n variables, m slacks, right-hand side.
+	t := make([][]float64, m+1)
+	for i := range m {
+		t[i] = make([]float64, n+m+1)
+		copy(t[i], a[i])
+		t[i][n+i] = 1
+		t[i][n+m] = b[i]
+	}
+	obj := make([]float64, n+m+1)
+	for j, v := range c {
+		obj[j] = -v
+	}
+	t[m] = obj
+	basis := make([]int, m)
+	for i := range basis {
+		basis[i] = n + i
+	}
+
+	for {
+		enter := -1
+		for j := 0; j < n+m; j++ {
+			if t[m][j] < -lpEps {
+				enter = j
+				break
+			}
+		}
+		if enter < 0 {
+			break
+		}
+		leave := -1
+		best := math.Inf(1)
+		for i := range m {
+			if t[i][enter] <= lpEps {
+				continue
+			}
+			ratio := t[i][n+m] / t[i][enter]
+			if ratio < best-lpEps || (math.Abs(ratio-best) <= lpEps && basis[i] < basis[leave]) {
+				best, leave = ratio, i
+			}
+		}
+		if leave < 0 {
+			return nil, errUnbounded
+		}
+
+		pivot := t[leave][enter]
+		for j := range t[leave] {
+			t[leave][j] /= pivot
+		}
+		for i := range t {
+			if i == leave || t[i][enter] == 0 {
+				continue
+			}
+			f := t[i][enter]
+			for j := range t[i] {
+				t[i][j] -= f * t[leave][j]
+			}
+		}
+		basis[leave] = enter
+	}
+
+	x := make([]float64, n)
+	for i, v := range basis {
+		if v < n {
+			x[v] = max(t[i][n+m], 0)
+		}
+	}
+	return x, nil
+}
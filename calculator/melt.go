@@ -0,0 +1,78 @@
+package calculator
+
+import (
+	"context"
+	"math"
+)
+
+// Container is something metal is melted in.
+type Container struct {
+	Name       string
+	CapacityMB float64
+}
+
+// Container presets offered by the UI. Any other capacity can be passed to PlanMelts.
+var (
+	Crucible    = Container{Name: "Crucible", CapacityMB: 3024}
+	SmallVessel = Container{Name: "Small Vessel", CapacityMB: 504}
+)
+
+// Containers returns the container presets, largest first.
+func Containers() []Container {
+	return []Container{Crucible, SmallVessel}
+}
+
+// Melt is one alloy that has to be melted, split into runs that fit the container.
+// Every run has the same size and the same load, so each one is within the
+// ingredient ranges on its own.
+type Melt struct {
+	AlloyID string
+	Path    string // where the first of these runs goes, if AlloyID is mixed in more than one way; "" otherwise
+	TotalMB float64
+	Runs    int
+	RunMB   float64
+	LoadMB  map[string]float64 // ingredient ID → mB to load per run
+}
+
+// MeltPlan is the result of PlanMelts.
+type MeltPlan struct {
+	Container Container
+	Melts     []Melt // in build order: an alloy comes after the alloys melted into it
+}
+
+// PlanMelts splits making targetID into container-sized melts. Every alloy and raw
+// steel in the recipe tree is melted on its own, in as few equal runs as fit into
+// container; steel and final steels are not melted and only pass their amounts on.
+// An alloy that path overrides mix in more than one way is melted once per mix.
+// amount, mode and allUserPerc mean the same as for CalculateRequirements.
+func (c *Calculator) PlanMelts(ctx context.Context, targetID string, amount float64, mode string, allUserPerc map[string]map[string]float64, container Container) (*MeltPlan, error) {
+	if container.CapacityMB <= 0 {
+		return nil, invalid(targetID, "container %s must have a positive capacity", container.Name)
+	}
+	res, err := c.Calculate(ctx, targetID, amount, mode, allUserPerc)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &MeltPlan{Container: container}
+	mixes := res.Root.mixes()
+	for _, m := range mixes {
+		material, err := c.store.GetAlloyByID(ctx, m.id)
+		if err != nil {
+			return nil, err
+		}
+		if m.id == "steel" || (material.Type != "alloy" && material.Type != "raw_steel") || len(material.Ingredients) == 0 {
+			continue
+		}
+		runs := int(math.Ceil(m.totalMB/container.CapacityMB - 1e-9))
+		melt := Melt{AlloyID: m.id, TotalMB: m.totalMB, Runs: runs, RunMB: m.totalMB / float64(runs), LoadMB: make(map[string]float64)}
+		if mixedApart(mixes, m.id) {
+			melt.Path = m.path
+		}
+		for _, ing := range material.Ingredients {
+			melt.LoadMB[ing.IngredientID] = melt.RunMB * m.percentages[ing.IngredientID] / 100.0
+		}
+		plan.Melts = append(plan.Melts, melt)
+	}
+	return plan, nil
+}
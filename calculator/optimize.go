@@ -0,0 +1,123 @@
+package calculator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Goal is what OptimizePercentages optimizes: the base metals a target uses,
+// weighted by Weights (base ID → cost per mB; metals not listed cost nothing).
+// The total is minimized unless Maximize is set.
+type Goal struct {
+	Weights  map[string]float64
+	Maximize bool
+}
+
+// Minimize returns the Goal of using as little of baseID as possible.
+func Minimize(baseID string) Goal {
+	return Goal{Weights: map[string]float64{baseID: 1}}
+}
+
+// Maximize returns the Goal of using as much of baseID as possible.
+func Maximize(baseID string) Goal {
+	return Goal{Weights: map[string]float64{baseID: 1}, Maximize: true}
+}
+
+// OptimizePercentages chooses the percentages of every alloy below targetID,
+// nested raw steels included, each within its Min/Max range, so that making
+// targetID scores best on goal. The result is in the form CalculateRequirements
+// takes. Since every recipe scales with the amount, so does the optimum, and no
+// amount is needed. An alloy used in more than one place gets one set of
+// percentages, as in allUserPerc. Alloys that contain none of the weighted metals
+// cannot change the score and keep their defaults. Weights that are negative, not
+// base metals, or all zero are a *ValidationError.
+func (c *Calculator) OptimizePercentages(ctx context.Context, targetID string, goal Goal) (map[string]map[string]float64, error) {
+	ids := make([]string, 0, len(goal.Weights))
+	for id := range goal.Weights {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	positive := false
+	for _, id := range ids {
+		material, err := c.store.GetAlloyByID(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("unknown goal material %s: %w", id, err)
+		}
+		if material.Type != "base" {
+			return nil, invalid(targetID, "only base metals can be optimized, %s is a %s", material.Name, material.Type)
+		}
+		if w := goal.Weights[id]; w < 0 {
+			return nil, invalid(targetID, "weight of %s is negative (%.2f)", material.Name, w)
+		} else if w > 0 {
+			positive = true
+		}
+	}
+	if !positive {
+		return nil, invalid(targetID, "goal has no metal with a positive weight")
+	}
+
+	m, err := c.buildFlowModel(ctx, targetID)
+	if err != nil {
+		return nil, err
+	}
+	a, b := m.recipeConstraints()
+	cost := make([]float64, m.nvars)
+	for _, id := range m.order {
+		if w := goal.Weights[id]; w > 0 && m.materials[id].Type == "base" {
+			for j, v := range m.consumption(id) {
+				cost[j] += w * v
+			}
+		}
+	}
+	unit := make([]float64, m.nvars)
+	unit[0] = 1
+
+	var x []float64
+	if goal.Maximize {
+		// The most cost for one mB of the target.
+		x, err = maximize(cost, append(a, unit), append(b, 1))
+	} else {
+		// The most target for a cost of 1 is the least cost per mB of the target.
+		// If the target can be made without any cost that is unbounded, and any
+		// plan that costs nothing will do.
+		x, err = maximize(unit, append(a, cost), append(b, 1))
+		if errors.Is(err, errUnbounded) {
+			x, err = maximize(unit, append(a, unit, cost), append(b, 1, 0))
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot optimize %s: %w", targetID, err)
+	}
+	perc, err := m.percentages(ctx, c, x)
+	if err != nil {
+		return nil, err
+	}
+	for id := range perc {
+		if !m.contains(id, goal.Weights) {
+			if perc[id], err = c.GetDefaultPercentages(ctx, id); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return perc, nil
+}
+
+// contains reports whether id is, or is made from, a base metal with a positive
+// weight.
+func (m *flowModel) contains(id string, weights map[string]float64) bool {
+	material := m.materials[id]
+	switch {
+	case material.Type == "base":
+		return weights[id] > 0
+	case material.Type == "final_steel":
+		return m.contains(material.RawFormID.String, weights) || m.contains(material.ExtraIngredientID.String, weights)
+	}
+	for _, ing := range material.Ingredients {
+		if m.contains(ing.IngredientID, weights) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,423 @@
+package calculator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"tfccalc/data"
+)
+
+// Node is one material in the calculation tree: how much of it is needed and,
+// for anything but a base metal, what it is made of.
+type Node struct {
+	MaterialID  string
+	Path        string // IDs from the root down to this node, joined by "/", e.g. "blue_steel/raw_blue_steel/black_steel"
+	Name        string
+	Type        string // the material type from the store, e.g. "alloy" or "final_steel"
+	AmountMB    float64
+	ExactMB     *big.Rat           // AmountMB as an exact fraction; nil unless the Calculator is exact
+	Percentages map[string]float64 // how the amount was split over Children; nil for base metals and final steels
+	Children    []*Node
+}
+
+// AmountIngots returns AmountMB in ingots.
+func (n *Node) AmountIngots() float64 {
+	return n.AmountMB / 100.0
+}
+
+// Walk calls fn for n and every node below it, depth first, with the node's parent
+// (nil for n) and its depth below n.
+func (n *Node) Walk(fn func(node, parent *Node, level int)) {
+	n.walk(nil, 0, fn)
+}
+
+func (n *Node) walk(parent *Node, level int, fn func(node, parent *Node, level int)) {
+	fn(n, parent, level)
+	for _, child := range n.Children {
+		child.walk(n, level+1, fn)
+	}
+}
+
+// Label returns the text the front ends show for n, e.g. “Copper (221.25mB | 2.212Ing)”.
+func (n *Node) Label() string {
+	return fmt.Sprintf("%s (%.2fmB | %.3fIng)", n.Name, n.AmountMB, n.AmountIngots())
+}
+
+// TreeLine is one line of a tree of Nodes drawn as text, the way every front end
+// draws it: for each level above the node “│   ” or spaces, then “├── ” or “└── ”
+// and the node's Label.
+type TreeLine struct {
+	Node *Node
+	Last []bool // Last[i]: whether the node's ancestor at depth i, or the node itself at the end, is the last of its siblings
+}
+
+// Depth returns the depth of the line's node, 0 for a root.
+func (l TreeLine) Depth() int {
+	return len(l.Last) - 1
+}
+
+// IsLast reports whether the line's node is the last of its siblings.
+func (l TreeLine) IsLast() bool {
+	return l.Last[len(l.Last)-1]
+}
+
+// Lines flattens the tree below n into lines, depth first.
+func (n *Node) Lines() []TreeLine {
+	return TreeLines(n)
+}
+
+// TreeLines flattens the trees below roots into lines, depth first. The roots are
+// siblings of each other.
+func TreeLines(roots ...*Node) []TreeLine {
+	var lines []TreeLine
+	var collect func(nodes []*Node, last []bool)
+	collect = func(nodes []*Node, last []bool) {
+		for i, node := range nodes {
+			l := append(append([]bool{}, last...), i == len(nodes)-1)
+			lines = append(lines, TreeLine{Node: node, Last: l})
+			collect(node.Children, l)
+		}
+	}
+	collect(roots, nil)
+	return lines
+}
+
+// baseTotals adds up the base metals at the leaves of the tree.
+func (n *Node) baseTotals() map[string]float64 {
+	totals := make(map[string]float64)
+	n.Walk(func(node, _ *Node, _ int) {
+		if node.Type == "base" {
+			totals[node.MaterialID] += node.AmountMB
+		}
+	})
+	return totals
+}
+
+// exactBaseTotals is baseTotals for a tree built by an exact Calculator.
+func (n *Node) exactBaseTotals() map[string]*big.Rat {
+	totals := make(map[string]*big.Rat)
+	n.Walk(func(node, _ *Node, _ int) {
+		if node.Type != "base" {
+			return
+		}
+		if totals[node.MaterialID] == nil {
+			totals[node.MaterialID] = new(big.Rat)
+		}
+		totals[node.MaterialID].Add(totals[node.MaterialID], node.ExactMB)
+	})
+	return totals
+}
+
+// mix is every node of one material in the tree that is made the same way, so
+// they can be made together.
+type mix struct {
+	id          string
+	path        string             // path of the first of the nodes
+	percentages map[string]float64 // nil if the material is not mixed
+	totalMB     float64
+	depth       int // deepest level the material appears at, in any mix
+}
+
+// mixes groups every material in the tree that is not a base metal, including the
+// root, into mixes: all nodes of a material with the same percentages form one
+// mix. The mixes are in build order: since a material is always deeper than
+// everything it goes into, by decreasing depth, then by ID and path.
+func (n *Node) mixes() []*mix {
+	var list []*mix
+	byKey := make(map[string]*mix)
+	depth := make(map[string]int)
+	n.Walk(func(node, _ *Node, level int) {
+		if node.Type == "base" {
+			return
+		}
+		depth[node.MaterialID] = max(depth[node.MaterialID], level)
+		key := node.MaterialID + fmt.Sprint(node.Percentages)
+		m, ok := byKey[key]
+		if !ok {
+			m = &mix{id: node.MaterialID, path: node.Path, percentages: node.Percentages}
+			byKey[key] = m
+			list = append(list, m)
+		}
+		m.totalMB += node.AmountMB
+	})
+	for _, m := range list {
+		m.depth = depth[m.id]
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.depth != b.depth {
+			return a.depth > b.depth
+		}
+		if a.id != b.id {
+			return a.id < b.id
+		}
+		return a.path < b.path
+	})
+	return list
+}
+
+// mixedApart reports whether id is made in more than one way in mixes.
+func mixedApart(mixes []*mix, id string) bool {
+	n := 0
+	for _, m := range mixes {
+		if m.id == id {
+			n++
+		}
+	}
+	return n > 1
+}
+
+// Result is everything a calculation produces. The UI, tests and other front ends
+// all read from it.
+type Result struct {
+	TargetID    string
+	AmountMB    float64
+	Root        *Node
+	TotalMB     map[string]float64            // base ID → mB
+	TotalIngots map[string]float64            // base ID → Ingots
+	ExactMB     map[string]*big.Rat           // base ID → exact mB; nil unless the Calculator is exact
+	Percentages map[string]map[string]float64 // alloy ID, or path for a node with its own override → ingredient ID → percent actually used
+	Steps       []Step                        // processing steps in build order
+	Warnings    []string                      // e.g. user percentages that were replaced by defaults
+}
+
+// Calculate computes the full result for amount of targetID. mode is "mB" or
+// "Ingots"; allUserPerc holds user overrides and is not modified. A key is either
+// an alloy ID, which applies wherever the alloy is used, or the Path of one node,
+// which wins over the ID there. A final steel, by ID or path, stands for its raw
+// form, so "blue_steel/raw_blue_steel/black_steel" sets the black steel inside raw
+// blue steel apart from the one blue steel is welded with. Overrides that fail
+// validation are replaced by defaults and reported in Warnings, as are overrides
+// the target does not use. An exact Calculator fills in ExactMB, and TotalMB and
+// TotalIngots are rounded from it.
+func (c *Calculator) Calculate(ctx context.Context, targetID string, amount float64, mode string, allUserPerc map[string]map[string]float64) (*Result, error) {
+	if amount <= 0 {
+		return nil, errors.New("amount must be positive")
+	}
+	if mode != "mB" && mode != "Ingots" {
+		return nil, errors.New("invalid mode; only \"mB\" or \"Ingots\"")
+	}
+	_, err := c.store.GetAlloyByID(ctx, targetID)
+	if err != nil {
+		return nil, err
+	}
+	amountMB := amount
+	if mode == "Ingots" {
+		amountMB = amount * 100.0
+	}
+
+	res := &Result{
+		TargetID:    targetID,
+		AmountMB:    amountMB,
+		TotalIngots: make(map[string]float64),
+		Percentages: make(map[string]map[string]float64),
+	}
+	warn := func(msg string) {
+		for _, w := range res.Warnings {
+			if w == msg {
+				return
+			}
+		}
+		res.Warnings = append(res.Warnings, msg)
+	}
+	var exactMB *big.Rat
+	if c.exact {
+		if exactMB, err = ratFromFloat(amount); err != nil {
+			return nil, fmt.Errorf("amount: %w", err)
+		}
+		if mode == "Ingots" {
+			exactMB.Mul(exactMB, big.NewRat(100, 1))
+		}
+	}
+	overrides, keys := c.expandPaths(ctx, allUserPerc)
+	root, err := c.buildNode(ctx, targetID, amountMB, exactMB, overrides, "", 0, warn)
+	if err != nil {
+		return nil, err
+	}
+	res.Root = root
+	if c.exact {
+		res.ExactMB = root.exactBaseTotals()
+		res.TotalMB = make(map[string]float64, len(res.ExactMB))
+		for id, mB := range res.ExactMB {
+			res.TotalMB[id], _ = mB.Float64()
+			res.TotalIngots[id], _ = new(big.Rat).Quo(mB, big.NewRat(100, 1)).Float64()
+		}
+	} else {
+		res.TotalMB = root.baseTotals()
+		for id, mB := range res.TotalMB {
+			res.TotalIngots[id] = mB / 100.0
+		}
+	}
+	root.Walk(func(node, _ *Node, _ int) {
+		if node.Percentages == nil {
+			return
+		}
+		if _, ok := overrides[node.Path]; ok {
+			res.Percentages[node.Path] = node.Percentages
+		} else {
+			res.Percentages[node.MaterialID] = node.Percentages
+		}
+	})
+
+	var unused []string
+	for key := range allUserPerc {
+		if _, used := res.Percentages[keys[key]]; !used {
+			unused = append(unused, key)
+		}
+	}
+	sort.Strings(unused)
+	for _, key := range unused {
+		name := key
+		if !strings.Contains(key, "/") {
+			name = data.GetAlloyNameByID(ctx, c.store, key)
+		}
+		warn(fmt.Sprintf("percentages for %s are not used by %s", name, data.GetAlloyNameByID(ctx, c.store, targetID)))
+	}
+
+	if res.Steps, err = c.processingSteps(ctx, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// OverrideAlloyID returns the ID of the alloy whose percentages the override key
+// sets: the last ID of a path, or the raw form if that is a final steel.
+func (c *Calculator) OverrideAlloyID(ctx context.Context, key string) (string, error) {
+	id := key[strings.LastIndex(key, "/")+1:]
+	material, err := c.store.GetAlloyByID(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if material.Type == "final_steel" && material.RawFormID.Valid {
+		return material.RawFormID.String, nil
+	}
+	return id, nil
+}
+
+// expandPaths returns allUserPerc with every key that ends in a final steel moved
+// to its raw form (see OverrideAlloyID): a bare ID to the raw form's ID, a path to
+// the path of the raw form. It also returns the key each original key ended up as.
+func (c *Calculator) expandPaths(ctx context.Context, allUserPerc map[string]map[string]float64) (map[string]map[string]float64, map[string]string) {
+	overrides := make(map[string]map[string]float64, len(allUserPerc))
+	keys := make(map[string]string, len(allUserPerc))
+	for key := range allUserPerc {
+		keys[key] = key
+		i := strings.LastIndex(key, "/")
+		alloyID, err := c.OverrideAlloyID(ctx, key)
+		if err != nil || alloyID == key[i+1:] {
+			continue
+		}
+		if i >= 0 {
+			keys[key] = key + "/" + alloyID
+		} else {
+			keys[key] = alloyID
+		}
+	}
+	// Keys that were given as they are win over moved ones.
+	for key, perc := range allUserPerc {
+		if keys[key] != key {
+			overrides[keys[key]] = perc
+		}
+	}
+	for key, perc := range allUserPerc {
+		if keys[key] == key {
+			overrides[key] = perc
+		}
+	}
+	return overrides, keys
+}
+
+// buildNode recursively expands targetID (any alloy or base) into a tree down to
+// the base materials (type "base"), applying percentages from allUserPerc, where
+// parent is the path of the node targetID goes into ("" for the root). Steel is
+// 100% pig iron, and a final steel needs its raw form and its extra ingredient at
+// the full amount. Problems that do not stop the calculation go to warn. If exactMB
+// is not nil, amounts are split exactly and AmountMB is rounded from ExactMB.
+func (c *Calculator) buildNode(ctx context.Context, targetID string, amountMB float64, exactMB *big.Rat, allUserPerc map[string]map[string]float64, parent string, level int, warn func(string)) (*Node, error) {
+	if level > 20 {
+		return nil, errors.New("maximum recursion depth exceeded, possible cyclic dependency")
+	}
+	targetData, err := c.store.GetAlloyByID(ctx, targetID)
+	if err != nil {
+		return nil, fmt.Errorf("unknown material ID %s: %w", targetID, err)
+	}
+	path := targetID
+	if parent != "" {
+		path = parent + "/" + targetID
+	}
+	node := &Node{MaterialID: targetID, Path: path, Name: targetData.Name, Type: targetData.Type, AmountMB: amountMB, ExactMB: exactMB}
+
+	switch {
+	case targetData.Type == "base":
+		return node, nil
+
+	case targetID == "steel":
+		// Plain "Steel" resolves to pig_iron at 100%
+		child, err := c.buildNode(ctx, "pig_iron", amountMB, exactMB, allUserPerc, path, level+1, warn)
+		if err != nil {
+			return nil, err
+		}
+		node.Percentages = map[string]float64{"pig_iron": 100}
+		node.Children = []*Node{child}
+		return node, nil
+
+	case targetData.Type == "final_steel":
+		// A final steel (e.g. "black_steel") is RawForm + ExtraIngredient
+		if !targetData.RawFormID.Valid || !targetData.ExtraIngredientID.Valid {
+			return nil, fmt.Errorf("incomplete data for final_steel %s", targetID)
+		}
+		raw, err := c.buildNode(ctx, targetData.RawFormID.String, amountMB, exactMB, allUserPerc, path, level+1, warn)
+		if err != nil {
+			return nil, fmt.Errorf("error calculating rawForm for %s: %w", targetID, err)
+		}
+		// The extra ingredient is pig_iron or another steel
+		extra, err := c.buildNode(ctx, targetData.ExtraIngredientID.String, amountMB, exactMB, allUserPerc, path, level+1, warn)
+		if err != nil {
+			return nil, fmt.Errorf("error calculating extraIngredient for %s: %w", targetID, err)
+		}
+		node.Children = []*Node{raw, extra}
+		return node, nil
+
+	case targetData.Type == "alloy" || targetData.Type == "raw_steel" || targetData.Type == "processed":
+		if len(targetData.Ingredients) == 0 {
+			return node, nil
+		}
+		percentagesToUse, err := c.percentagesFor(ctx, targetData, path, allUserPerc, warn)
+		if err != nil {
+			return nil, err
+		}
+		node.Percentages = percentagesToUse
+		var shares map[string]*big.Rat
+		if exactMB != nil {
+			if shares, err = exactShares(exactMB, targetData, percentagesToUse); err != nil {
+				return nil, err
+			}
+		}
+		for _, ing := range targetData.Ingredients {
+			pct, exists := percentagesToUse[ing.IngredientID]
+			if !exists {
+				return nil, fmt.Errorf("internal error: ingredient %s missing after resolving for %s", ing.IngredientID, targetID)
+			}
+			requiredMB := amountMB * (pct / 100.0)
+			requiredExact := shares[ing.IngredientID]
+			if requiredExact != nil {
+				if requiredExact.Sign() == 0 {
+					continue
+				}
+				requiredMB, _ = requiredExact.Float64()
+			} else if requiredMB < 0.001 {
+				continue
+			}
+			child, err := c.buildNode(ctx, ing.IngredientID, requiredMB, requiredExact, allUserPerc, path, level+1, warn)
+			if err != nil {
+				return nil, fmt.Errorf("error expanding %s for %s: %w", ing.IngredientID, targetID, err)
+			}
+			node.Children = append(node.Children, child)
+		}
+		return node, nil
+	}
+	return nil, fmt.Errorf("unhandled material type %s for %s", targetData.Type, targetID)
+}
@@ -0,0 +1,252 @@
+package calculator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"tfccalc/data"
+)
+
+// flowModel is the linear model of everything that goes into one target. Variable 0
+// is the amount of the target; every other material gets a variable for the total
+// amount made of it, and every mixed alloy one per ingredient for the amount of that
+// ingredient melted into it. Percentages are per alloy ID, as in allUserPerc, so an
+// alloy used in two places is mixed the same way in both.
+type flowModel struct {
+	targetID  string
+	materials map[string]data.AlloyInfo
+	order     []string         // materials in discovery order
+	made      map[string]int   // non-base ID → variable
+	flows     map[string][]int // mixed alloy ID → variable per ingredient
+	nvars     int
+}
+
+// buildFlowModel walks the recipe graph below targetID the way
+// getBaseMaterialBreakdown does: steel is pig iron, a final steel needs its raw form
+// and its extra ingredient at the full amount, anything else its ingredients.
+func (c *Calculator) buildFlowModel(ctx context.Context, targetID string) (*flowModel, error) {
+	m := &flowModel{
+		targetID:  targetID,
+		materials: make(map[string]data.AlloyInfo),
+		made:      make(map[string]int),
+		flows:     make(map[string][]int),
+		nvars:     1,
+	}
+	var visit func(id string, level int) error
+	visit = func(id string, level int) error {
+		if level > 20 {
+			return errors.New("maximum recursion depth exceeded, possible cyclic dependency")
+		}
+		if _, seen := m.materials[id]; seen {
+			return nil
+		}
+		material, err := c.store.GetAlloyByID(ctx, id)
+		if err != nil {
+			return fmt.Errorf("unknown material ID %s: %w", id, err)
+		}
+		if id == "steel" {
+			material.Ingredients = []data.IngredientInfo{{IngredientID: "pig_iron", Min: 100, Max: 100}}
+		}
+		m.materials[id] = material
+		m.order = append(m.order, id)
+		if material.Type == "base" {
+			return nil
+		}
+		m.made[id] = m.newVar()
+
+		if material.Type == "final_steel" {
+			if !material.RawFormID.Valid || !material.ExtraIngredientID.Valid {
+				return fmt.Errorf("incomplete data for final_steel %s", id)
+			}
+			if err := visit(material.RawFormID.String, level+1); err != nil {
+				return err
+			}
+			return visit(material.ExtraIngredientID.String, level+1)
+		}
+		vars := make([]int, len(material.Ingredients))
+		for i, ing := range material.Ingredients {
+			vars[i] = m.newVar()
+			if err := visit(ing.IngredientID, level+1); err != nil {
+				return err
+			}
+		}
+		m.flows[id] = vars
+		return nil
+	}
+	if err := visit(targetID, 0); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *flowModel) newVar() int {
+	m.nvars++
+	return m.nvars - 1
+}
+
+// consumption returns the row that sums up how much of id is used: by the target
+// itself, melted into alloys, or as part of a final steel.
+func (m *flowModel) consumption(id string) []float64 {
+	row := make([]float64, m.nvars)
+	if id == m.targetID {
+		row[0] = 1
+	}
+	for _, owner := range m.order {
+		material := m.materials[owner]
+		if material.Type == "final_steel" {
+			if material.RawFormID.String == id {
+				row[m.made[owner]]++
+			}
+			if material.ExtraIngredientID.String == id {
+				row[m.made[owner]]++
+			}
+			continue
+		}
+		for i, ing := range material.Ingredients {
+			if ing.IngredientID == id {
+				row[m.flows[owner][i]]++
+			}
+		}
+	}
+	return row
+}
+
+// recipeConstraints returns the rows a·x ≤ b that every plan must satisfy: each
+// material is made exactly as much as it is used, and each alloy's ingredients add
+// up to the alloy and stay within their ranges.
+func (m *flowModel) recipeConstraints() ([][]float64, []float64) {
+	var a [][]float64
+	equal := func(row []float64) {
+		neg := make([]float64, len(row))
+		for j, v := range row {
+			neg[j] = -v
+		}
+		a = append(a, row, neg)
+	}
+	for _, id := range m.order {
+		y, ok := m.made[id]
+		if !ok {
+			continue
+		}
+		row := m.consumption(id)
+		row[y]--
+		equal(row)
+
+		vars, mixed := m.flows[id]
+		if !mixed {
+			continue
+		}
+		sum := make([]float64, m.nvars)
+		sum[y] = -1
+		for i, ing := range m.materials[id].Ingredients {
+			sum[vars[i]] = 1
+			lo := make([]float64, m.nvars)
+			lo[y], lo[vars[i]] = ing.Min/100, -1
+			hi := make([]float64, m.nvars)
+			hi[y], hi[vars[i]] = -ing.Max/100, 1
+			a = append(a, lo, hi)
+		}
+		equal(sum)
+	}
+	return a, make([]float64, len(a))
+}
+
+// percentages turns a solution into per-alloy percentages in the form
+// CalculateRequirements takes. Alloys the solution does not make get defaults.
+func (m *flowModel) percentages(ctx context.Context, c *Calculator, x []float64) (map[string]map[string]float64, error) {
+	res := make(map[string]map[string]float64)
+	for _, id := range m.order {
+		vars, ok := m.flows[id]
+		if !ok {
+			continue
+		}
+		y := x[m.made[id]]
+		if y <= lpEps {
+			defaults, err := c.GetDefaultPercentages(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			res[id] = defaults
+			continue
+		}
+		perc := make(map[string]float64)
+		for i, ing := range m.materials[id].Ingredients {
+			perc[ing.IngredientID] = math.Min(math.Max(x[vars[i]]/y*100, ing.Min), ing.Max)
+		}
+		res[id] = perc
+	}
+	return res, nil
+}
+
+// Yield is the result of MaxProducible.
+type Yield struct {
+	TargetID    string
+	AmountMB    float64
+	Percentages map[string]map[string]float64 // alloy ID → ingredient ID → percent
+	UsedMB      map[string]float64            // base ID → mB taken from the inventory
+	LeftoverMB  map[string]float64            // base ID → mB still in the inventory
+}
+
+// MaxProducible works out how much of targetID can be made from inventory, a map of
+// base metal ID → mB. It chooses the percentages of every alloy on the way, each
+// within its Min/Max range, to make as much as possible, and returns them in the
+// form CalculateRequirements takes, together with what the plan uses and what is
+// left over. Final steels count their raw form and their extra ingredient, like
+// CalculateRequirements does. An inventory with negative amounts or anything other
+// than base metals is a *ValidationError.
+func (c *Calculator) MaxProducible(ctx context.Context, targetID string, inventory map[string]float64) (*Yield, error) {
+	for id, mB := range inventory {
+		material, err := c.store.GetAlloyByID(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("unknown inventory material %s: %w", id, err)
+		}
+		if material.Type != "base" {
+			return nil, invalid(targetID, "inventory may only hold base metals, %s is a %s", material.Name, material.Type)
+		}
+		if mB < 0 {
+			return nil, invalid(targetID, "inventory amount of %s is negative (%.2f mB)", material.Name, mB)
+		}
+	}
+
+	m, err := c.buildFlowModel(ctx, targetID)
+	if err != nil {
+		return nil, err
+	}
+	a, b := m.recipeConstraints()
+	for _, id := range m.order {
+		if m.materials[id].Type == "base" {
+			a = append(a, m.consumption(id))
+			b = append(b, inventory[id])
+		}
+	}
+	objective := make([]float64, m.nvars)
+	objective[0] = 1
+	x, err := maximize(objective, a, b)
+	if err != nil {
+		return nil, fmt.Errorf("cannot plan %s: %w", targetID, err)
+	}
+
+	perc, err := m.percentages(ctx, c, x)
+	if err != nil {
+		return nil, err
+	}
+	yield := &Yield{
+		TargetID:    targetID,
+		AmountMB:    x[0],
+		Percentages: perc,
+		UsedMB:      make(map[string]float64),
+		LeftoverMB:  make(map[string]float64),
+	}
+	if yield.AmountMB > lpEps {
+		used, err := c.getBaseMaterialBreakdown(ctx, targetID, yield.AmountMB, perc, 0)
+		if err != nil {
+			return nil, err
+		}
+		yield.UsedMB = used
+	}
+	for id, mB := range inventory {
+		yield.LeftoverMB[id] = math.Max(mB-yield.UsedMB[id], 0)
+	}
+	return yield, nil
+}
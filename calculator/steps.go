@@ -0,0 +1,110 @@
+package calculator
+
+import (
+	"context"
+	"tfccalc/data"
+)
+
+// Station is where a processing step happens.
+type Station string
+
+// Stations used by the processing steps.
+const (
+	StationBlastFurnace Station = "blast furnace"
+	StationCrucible     Station = "crucible"
+	StationAnvil        Station = "anvil"
+	StationWaterBarrel  Station = "water barrel" // for quenching
+)
+
+// StepItem is an input or the output of a step. ID is a catalog ID, or a made-up
+// one for in-between items such as "weak_black_steel". AmountMB is 0 for ore,
+// fuel and flux: how much ore makes how much pig iron depends on the ore, so
+// their amounts are not tracked.
+type StepItem struct {
+	ID       string
+	Name     string
+	AmountMB float64
+}
+
+// Step is one thing to do at a station.
+type Step struct {
+	MaterialID string // the material this step is part of making
+	Path       string // for a melt of an alloy mixed in more than one way, where the first of its output goes; "" otherwise
+	Station    Station
+	Action     string // "smelt", "melt", "work", "weld" or "quench"
+	Inputs     []StepItem
+	Output     StepItem
+}
+
+// ProcessingSteps returns the steps to make targetID in build order: pig iron comes
+// out of the blast furnace, steel is worked from pig iron through high carbon steel
+// on the anvil, alloys and raw steels are melted in the crucible, and a final steel
+// is its raw form welded to its extra ingredient into a weak steel, which is then
+// quenched. A material's steps come after the steps of everything that goes into
+// it. The arguments mean the same as for Calculate.
+func (c *Calculator) ProcessingSteps(ctx context.Context, targetID string, amount float64, mode string, allUserPerc map[string]map[string]float64) ([]Step, error) {
+	res, err := c.Calculate(ctx, targetID, amount, mode, allUserPerc)
+	if err != nil {
+		return nil, err
+	}
+	return res.Steps, nil
+}
+
+// processingSteps builds the Steps of a Result from its tree.
+func (c *Calculator) processingSteps(ctx context.Context, res *Result) ([]Step, error) {
+	mixes := res.Root.mixes()
+	var steps []Step
+	if pig := res.TotalMB["pig_iron"]; pig > 0 {
+		steps = append(steps, Step{
+			MaterialID: "pig_iron",
+			Station:    StationBlastFurnace,
+			Action:     "smelt",
+			Inputs: []StepItem{
+				{ID: "iron_ore", Name: "Iron Ore"},
+				{ID: "flux", Name: "Flux"},
+				{ID: "charcoal", Name: "Charcoal"},
+			},
+			Output: c.stepItem(ctx, "pig_iron", pig),
+		})
+	}
+	for _, m := range mixes {
+		id, mB := m.id, m.totalMB
+		material, err := c.store.GetAlloyByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		out := c.stepItem(ctx, id, mB)
+		switch {
+		case id == "steel":
+			highCarbon := StepItem{ID: "high_carbon_steel", Name: "High Carbon Steel", AmountMB: mB}
+			steps = append(steps,
+				Step{MaterialID: id, Station: StationAnvil, Action: "work", Inputs: []StepItem{c.stepItem(ctx, "pig_iron", mB)}, Output: highCarbon},
+				Step{MaterialID: id, Station: StationAnvil, Action: "work", Inputs: []StepItem{highCarbon}, Output: out},
+			)
+		case material.Type == "final_steel":
+			weak := StepItem{ID: "weak_" + id, Name: "Weak " + material.Name, AmountMB: mB}
+			steps = append(steps,
+				Step{MaterialID: id, Station: StationAnvil, Action: "weld", Inputs: []StepItem{
+					c.stepItem(ctx, material.RawFormID.String, mB),
+					c.stepItem(ctx, material.ExtraIngredientID.String, mB),
+				}, Output: weak},
+				Step{MaterialID: id, Station: StationWaterBarrel, Action: "quench", Inputs: []StepItem{weak}, Output: out},
+			)
+		case len(material.Ingredients) > 0:
+			step := Step{MaterialID: id, Station: StationCrucible, Action: "melt", Output: out}
+			if mixedApart(mixes, id) {
+				step.Path = m.path
+			}
+			for _, ing := range material.Ingredients {
+				step.Inputs = append(step.Inputs, c.stepItem(ctx, ing.IngredientID, mB*m.percentages[ing.IngredientID]/100.0))
+			}
+			steps = append(steps, step)
+		}
+	}
+	return steps, nil
+}
+
+// stepItem returns the StepItem for mB of the catalog material id.
+func (c *Calculator) stepItem(ctx context.Context, id string, mB float64) StepItem {
+	return StepItem{ID: id, Name: data.GetAlloyNameByID(ctx, c.store, id), AmountMB: mB}
+}
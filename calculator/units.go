@@ -0,0 +1,280 @@
+package calculator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"tfccalc/data"
+)
+
+// Unit is an item that melts into a fixed amount of metal: an ore piece, a nugget
+// or an ingot.
+type Unit struct {
+	Name string
+	MB   int
+	Max  int // how many the player has; 0 means unlimited
+}
+
+// Units of TerraFirmaCraft 1.20. Copy one and set Max to limit it to a stock.
+var (
+	SmallOre  = Unit{Name: "small ore", MB: 10}
+	PoorOre   = Unit{Name: "poor ore", MB: 15}
+	NormalOre = Unit{Name: "normal ore", MB: 25}
+	RichOre   = Unit{Name: "rich ore", MB: 35}
+	Nugget    = Unit{Name: "nugget", MB: 10}
+	Ingot     = Unit{Name: "ingot", MB: 100}
+)
+
+// ErrNoUnitMix is returned by SolveUnits when no combination of the given units
+// fits the recipe at any amount near the target.
+var ErrNoUnitMix = errors.New("no combination of units fits the recipe")
+
+// DefaultUnits returns the units a material is normally added to a crucible as:
+// ore pieces, nuggets and ingots for base metals that are mined, ingots for
+// everything else (pig iron and the alloys).
+func DefaultUnits(material data.AlloyInfo) []Unit {
+	if material.Type == "base" && material.ID != "pig_iron" {
+		return []Unit{SmallOre, PoorOre, NormalOre, RichOre, Nugget, Ingot}
+	}
+	return []Unit{Ingot}
+}
+
+// UnitCount is how many of one unit go into the crucible.
+type UnitCount struct {
+	Unit  Unit
+	Count int
+}
+
+// IngredientUnits is the part of a UnitMix made of one ingredient.
+type IngredientUnits struct {
+	IngredientID string
+	AmountMB     int
+	Percent      float64
+	Units        []UnitCount // only units with a non-zero count, in the order they were given
+}
+
+// UnitMix is a crucible load of whole units. AmountMB equals TargetMB when Exact
+// is set; otherwise it is the nearest amount that can be made.
+type UnitMix struct {
+	AlloyID     string
+	TargetMB    int
+	AmountMB    int
+	Exact       bool
+	Ingredients []IngredientUnits
+}
+
+// SolveUnits finds whole counts of units for every ingredient of alloyID so that
+// the melted mix is targetMB and each ingredient stays within its Min/Max range.
+// units maps an ingredient ID to the units available for it; ingredients missing
+// from the map use DefaultUnits. Among the valid mixes it picks the one closest to
+// the default (midpoint) percentages, then the one with the fewest pieces.
+//
+// If targetMB cannot be hit exactly, the mix for the nearest amount that works is
+// returned with Exact unset (on a tie, the smaller amount). ErrNoUnitMix means there
+// is no such amount at all, e.g. because the stock is too small. Bad input, such as
+// an alloy that is not made in a crucible, is a *ValidationError.
+func (c *Calculator) SolveUnits(ctx context.Context, alloyID string, targetMB int, units map[string][]Unit) (*UnitMix, error) {
+	if targetMB <= 0 {
+		return nil, invalid(alloyID, "amount must be positive")
+	}
+	alloy, err := c.store.GetAlloyByID(ctx, alloyID)
+	if err != nil {
+		return nil, err
+	}
+	if len(alloy.Ingredients) == 0 {
+		if alloy.Type == "final_steel" && alloy.RawFormID.Valid {
+			return nil, invalid(alloyID, "%s is not melted in a crucible; solve for its raw form %s instead", alloy.Name, alloy.RawFormID.String)
+		}
+		return nil, invalid(alloyID, "%s has no ingredients to melt", alloy.Name)
+	}
+
+	// Per-ingredient units, and the step every amount is a multiple of.
+	ingUnits := make([][]Unit, len(alloy.Ingredients))
+	step, largest := 0, 0
+	for i, ing := range alloy.Ingredients {
+		list, ok := units[ing.IngredientID]
+		if !ok {
+			material, err := c.store.GetAlloyByID(ctx, ing.IngredientID)
+			if err != nil {
+				return nil, fmt.Errorf("cannot get units for %s: %w", ing.IngredientID, err)
+			}
+			list = DefaultUnits(material)
+		}
+		for _, u := range list {
+			if u.MB <= 0 || u.Max < 0 {
+				return nil, invalid(alloyID, "unit %q of %s must have a positive size and a non-negative stock", u.Name, ing.IngredientID)
+			}
+			step = gcd(step, u.MB)
+			largest = max(largest, u.MB)
+		}
+		ingUnits[i] = list
+	}
+	if step == 0 {
+		return nil, ErrNoUnitMix
+	}
+
+	// Search outwards from the target; the upper bound leaves room for mixes that
+	// only work with several of the largest units per ingredient.
+	limit := 2*targetMB + largest*len(alloy.Ingredients)
+	reach := make([]unitReach, len(ingUnits))
+	for i, list := range ingUnits {
+		reach[i] = reachableAmounts(list, step, limit/step)
+	}
+	for d := 0; d <= limit-targetMB; d++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		totals := []int{targetMB - d, targetMB + d}
+		if d == 0 {
+			totals = totals[:1]
+		}
+		for _, total := range totals {
+			if total <= 0 || total%step != 0 {
+				continue
+			}
+			amounts, ok := mixForTotal(alloy.Ingredients, reach, total, step)
+			if !ok {
+				continue
+			}
+			mix := &UnitMix{AlloyID: alloyID, TargetMB: targetMB, AmountMB: total, Exact: total == targetMB}
+			for i, ing := range alloy.Ingredients {
+				part := IngredientUnits{
+					IngredientID: ing.IngredientID,
+					AmountMB:     amounts[i],
+					Percent:      float64(amounts[i]) / float64(total) * 100,
+				}
+				for j, n := range reach[i].counts[amounts[i]/step] {
+					if n > 0 {
+						part.Units = append(part.Units, UnitCount{Unit: ingUnits[i][j], Count: n})
+					}
+				}
+				mix.Ingredients = append(mix.Ingredients, part)
+			}
+			return mix, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: %w", alloy.Name, ErrNoUnitMix)
+}
+
+// unitReach lists, for every amount (in steps), the fewest pieces that make it and
+// how many of each unit they are. pieces is -1 for amounts that cannot be made;
+// most is the largest amount that can.
+type unitReach struct {
+	pieces []int
+	counts [][]int
+	most   int
+}
+
+// reachableAmounts computes the unitReach of units up to limit steps. Unlimited
+// units are added any number of times; limited ones are split into bundles of
+// 1, 2, 4, … pieces, each of which is used at most once.
+func reachableAmounts(units []Unit, step, limit int) unitReach {
+	r := unitReach{pieces: make([]int, limit+1), counts: make([][]int, limit+1)}
+	for a := range r.pieces {
+		r.pieces[a] = -1
+	}
+	r.pieces[0] = 0
+	r.counts[0] = make([]int, len(units))
+
+	add := func(a, from, unit, n int) {
+		if r.pieces[from] < 0 {
+			return
+		}
+		if p := r.pieces[from] + n; r.pieces[a] < 0 || p < r.pieces[a] {
+			r.pieces[a] = p
+			r.counts[a] = append([]int(nil), r.counts[from]...)
+			r.counts[a][unit] += n
+		}
+	}
+	for j, u := range units {
+		size := u.MB / step
+		if u.Max == 0 {
+			for a := size; a <= limit; a++ {
+				add(a, a-size, j, 1)
+			}
+			continue
+		}
+		for left, n := u.Max, 1; left > 0; left, n = left-n, n*2 {
+			n = min(n, left)
+			for a := limit; a >= size*n; a-- {
+				add(a, a-size*n, j, n)
+			}
+		}
+	}
+	for a, p := range r.pieces {
+		if p >= 0 {
+			r.most = a
+		}
+	}
+	return r
+}
+
+// mixForTotal picks an amount (in mB) for every ingredient that adds up to total
+// and keeps each one within its range, preferring the amounts closest to the range
+// midpoints and then the fewest pieces. It reports false if there is none.
+func mixForTotal(ings []data.IngredientInfo, reach []unitReach, total, step int) ([]int, bool) {
+	const eps = 0.001
+	steps := total / step
+	type best struct {
+		dev    float64
+		pieces int
+		ok     bool
+	}
+	cur := make([]best, steps+1)
+	cur[0] = best{ok: true}
+	choice := make([][]int, len(ings))
+
+	for i, ing := range ings {
+		lo := int(math.Ceil((ing.Min - eps) * float64(total) / 100 / float64(step)))
+		hi := int(math.Floor((ing.Max + eps) * float64(total) / 100 / float64(step)))
+		lo, hi = max(lo, 0), min(hi, steps)
+		if lo > reach[i].most {
+			return nil, false // not enough stock for this total
+		}
+		mid := (ing.Min + ing.Max) / 2 * float64(total) / 100
+
+		next := make([]best, steps+1)
+		choice[i] = make([]int, steps+1)
+		for s, b := range cur {
+			if !b.ok {
+				continue
+			}
+			for a := lo; a <= hi && s+a <= steps; a++ {
+				if reach[i].pieces[a] < 0 {
+					continue
+				}
+				cand := best{
+					dev:    b.dev + math.Abs(float64(a*step)-mid),
+					pieces: b.pieces + reach[i].pieces[a],
+					ok:     true,
+				}
+				n := &next[s+a]
+				if !n.ok || cand.dev < n.dev-1e-9 || (math.Abs(cand.dev-n.dev) <= 1e-9 && cand.pieces < n.pieces) {
+					*n = cand
+					choice[i][s+a] = a
+				}
+			}
+		}
+		cur = next
+	}
+	if !cur[steps].ok {
+		return nil, false
+	}
+
+	amounts := make([]int, len(ings))
+	for i, s := len(ings)-1, steps; i >= 0; i-- {
+		a := choice[i][s]
+		amounts[i] = a * step
+		s -= a
+	}
+	return amounts, true
+}
+
+// gcd returns the greatest common divisor of a and b; gcd(0, b) is b.
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
@@ -0,0 +1,256 @@
+// Package cli implements the commands that run without a window, such as
+// "tfccalc calc". It does not import Fyne, so a binary built with the nogui tag
+// works on servers and in scripts with no display.
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"tfccalc/calculator"
+	"tfccalc/data"
+	"tfccalc/report"
+)
+
+// Exit codes of the commands.
+const (
+	ExitOK    = 0
+	ExitError = 1 // the calculation failed, e.g. percentages did not validate
+	ExitUsage = 2 // the command line was wrong
+)
+
+// CalcOptions are the settings of "tfccalc calc".
+type CalcOptions struct {
+	Mode   string // unit of the amount, "Ingots" or "mB" in any case; the -mode flag of package config
+	Set    Overrides
+	Exact  bool
+	Format string // "text", or a format of package report
+}
+
+// AddCalcFlags registers the flags of "tfccalc calc" on fs. Mode is not one of
+// them; the caller fills it in from the configuration.
+func AddCalcFlags(fs *flag.FlagSet) *CalcOptions {
+	o := &CalcOptions{Mode: "Ingots", Set: make(Overrides)}
+	fs.Var(o.Set, "set", "override a percentage, e.g. black_bronze.copper=60 or blue_steel/raw_blue_steel/black_steel.nickel=20 (repeatable)")
+	fs.BoolVar(&o.Exact, "exact", false, "calculate with exact fractions")
+	fs.StringVar(&o.Format, "format", "text", "output format: text, json, yaml or csv (summary only)")
+	return o
+}
+
+// Overrides collects -set flags: alloy ID or path → ingredient ID → percent.
+type Overrides map[string]map[string]float64
+
+func (o Overrides) String() string {
+	var parts []string
+	for key, perc := range o {
+		for ing, pct := range perc {
+			parts = append(parts, fmt.Sprintf("%s.%s=%g", key, ing, pct))
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+// Set parses one "<alloy or path>.<ingredient>=<percent>".
+func (o Overrides) Set(s string) error {
+	target, value, ok := strings.Cut(s, "=")
+	dot := strings.LastIndex(target, ".")
+	if !ok || dot <= 0 || dot == len(target)-1 {
+		return fmt.Errorf("want <alloy>.<ingredient>=<percent>, got %q", s)
+	}
+	pct, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("percentage %q is not a number", value)
+	}
+	key, ing := target[:dot], target[dot+1:]
+	if o[key] == nil {
+		o[key] = make(map[string]float64)
+	}
+	o[key][ing] = pct
+	return nil
+}
+
+// FlagsFirst moves the flags in args in front of the positional arguments, so that
+// "calc brass 10 -mode mb" parses like "calc -mode mb brass 10". Flags that fs does
+// not know, such as the config flags registered later, are taken to have a value.
+// Negative numbers and everything after "--" stay positional.
+func FlagsFirst(fs *flag.FlagSet, args []string) []string {
+	var flags, positional []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			positional = append(positional, args[i+1:]...)
+			break
+		}
+		if _, err := strconv.ParseFloat(arg, 64); err == nil || len(arg) < 2 || arg[0] != '-' {
+			positional = append(positional, arg)
+			continue
+		}
+		flags = append(flags, arg)
+		name := strings.TrimLeft(arg, "-")
+		if strings.Contains(name, "=") {
+			continue
+		}
+		if f := fs.Lookup(name); f != nil {
+			if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+				continue
+			}
+		}
+		if i+1 < len(args) {
+			i++
+			flags = append(flags, args[i])
+		}
+	}
+	return append(append(flags, "--"), positional...)
+}
+
+// Run calculates <alloy> <amount> from args, the positional arguments, and writes
+// the breakdown tree and the summary of base metals to stdout, as text or as a
+// report in o.Format (see package report). The alloy is an ID or a name. Every -set
+// must validate: the ingredients it leaves out are balanced around it
+// (calculator.BalancePercentages), and one that the alloy does not use is an error
+// too. It returns the exit code.
+func (o *CalcOptions) Run(ctx context.Context, store data.RecipeStore, args []string, stdout, stderr io.Writer) int {
+	fail := func(code int, format string, a ...any) int {
+		fmt.Fprintf(stderr, "tfccalc calc: "+format+"\n", a...)
+		return code
+	}
+	if len(args) != 2 {
+		return fail(ExitUsage, "want <alloy> <amount>, got %d arguments", len(args))
+	}
+	amount, err := strconv.ParseFloat(args[1], 64)
+	if err != nil {
+		return fail(ExitUsage, "amount %q is not a number", args[1])
+	}
+	var mode string
+	switch strings.ToLower(o.Mode) {
+	case "ingots":
+		mode = "Ingots"
+	case "mb":
+		mode = "mB"
+	default:
+		return fail(ExitUsage, "mode %q is neither ingots nor mb", o.Mode)
+	}
+	switch o.Format {
+	case "text", report.FormatJSON, report.FormatYAML, report.FormatCSV:
+	default:
+		return fail(ExitUsage, "format %q is not text, json, yaml or csv", o.Format)
+	}
+
+	calc := calculator.New(store)
+	if o.Exact {
+		calc = calculator.NewExact(store)
+	}
+	alloyID, err := findAlloy(ctx, store, args[0])
+	if err != nil {
+		return fail(ExitError, "%v", err)
+	}
+	perc, err := completeOverrides(ctx, calc, o.Set)
+	if err != nil {
+		return fail(ExitError, "%v", err)
+	}
+	res, err := calc.Calculate(ctx, alloyID, amount, mode, perc)
+	if err != nil {
+		return fail(ExitError, "%v", err)
+	}
+	if len(res.Warnings) > 0 {
+		return fail(ExitError, "%s", strings.Join(res.Warnings, "; "))
+	}
+	if o.Format != "text" {
+		in := report.Input{AlloyID: alloyID, Amount: amount, Mode: mode, Percentages: perc, Exact: o.Exact}
+		names := func(id string) string { return data.GetAlloyNameByID(ctx, store, id) }
+		if err := report.New(in, res, names).Write(stdout, o.Format); err != nil {
+			return fail(ExitError, "%v", err)
+		}
+		return ExitOK
+	}
+	writeTree(stdout, res.Root)
+	fmt.Fprintln(stdout)
+	writeSummary(ctx, stdout, store, res.TotalMB)
+	return ExitOK
+}
+
+// findAlloy returns the ID of the material called name, which is an ID or a name
+// in any case.
+func findAlloy(ctx context.Context, store data.RecipeStore, name string) (string, error) {
+	if _, err := store.GetAlloyByID(ctx, name); err == nil {
+		return name, nil
+	} else if !errors.Is(err, data.ErrNotFound) {
+		return "", err
+	}
+	all, err := store.GetAllAlloys(ctx)
+	if err != nil {
+		return "", err
+	}
+	for id, alloy := range all {
+		if strings.EqualFold(alloy.Name, name) || strings.EqualFold(id, name) {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("unknown alloy %q", name)
+}
+
+// completeOverrides balances every override around the ingredients it sets, for
+// the alloy calculator.OverrideAlloyID names.
+func completeOverrides(ctx context.Context, calc *calculator.Calculator, set Overrides) (map[string]map[string]float64, error) {
+	perc := make(map[string]map[string]float64, len(set))
+	for key, pinned := range set {
+		alloyID, err := calc.OverrideAlloyID(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("-set %s: %w", key, err)
+		}
+		balanced, err := calc.BalancePercentages(ctx, alloyID, pinned)
+		if err != nil {
+			return nil, fmt.Errorf("-set %s: %w", key, err)
+		}
+		perc[key] = balanced
+	}
+	return perc, nil
+}
+
+// writeTree writes the calculation tree the way the window draws it, without colors
+// and without the branch of the root.
+func writeTree(w io.Writer, root *calculator.Node) {
+	for _, line := range root.Lines() {
+		var prefix strings.Builder
+		for depth := 1; depth < line.Depth(); depth++ {
+			if line.Last[depth] {
+				prefix.WriteString("    ")
+			} else {
+				prefix.WriteString("│   ")
+			}
+		}
+		if line.Depth() > 0 {
+			if line.IsLast() {
+				prefix.WriteString("└── ")
+			} else {
+				prefix.WriteString("├── ")
+			}
+		}
+		fmt.Fprintln(w, prefix.String()+line.Node.Label())
+	}
+}
+
+// writeSummary writes the Material | mB | Ingots table, sorted by name.
+func writeSummary(ctx context.Context, w io.Writer, store data.RecipeStore, totalMB map[string]float64) {
+	ids := make([]string, 0, len(totalMB))
+	for id := range totalMB {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return data.GetAlloyNameByID(ctx, store, ids[i]) < data.GetAlloyNameByID(ctx, store, ids[j])
+	})
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Material\tmB\tIngots")
+	for _, id := range ids {
+		fmt.Fprintf(tw, "%s\t%.2f\t%.3f\n", data.GetAlloyNameByID(ctx, store, id), totalMB[id], totalMB[id]/100.0)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"tfccalc/data"
+	"tfccalc/report"
+)
+
+var ctx = context.Background()
+
+// run parses args like runCalc does and runs the calculation on the default catalog.
+func run(t *testing.T, args ...string) (code int, stdout, stderr string) {
+	t.Helper()
+	fs := flag.NewFlagSet("calc", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	opts := AddCalcFlags(fs)
+	mode := fs.String("mode", "Ingots", "")
+	if err := fs.Parse(FlagsFirst(fs, args)); err != nil {
+		return ExitUsage, "", err.Error()
+	}
+	opts.Mode = *mode
+	var out, errOut bytes.Buffer
+	code = opts.Run(ctx, data.NewMemoryStore(data.DefaultAlloys()), fs.Args(), &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+func TestRun_TreeAndSummary(t *testing.T) {
+	code, out, errOut := run(t, "black_bronze", "10", "-mode", "ingots", "-set", "black_bronze.copper=66")
+	if code != ExitOK {
+		t.Fatalf("exit code %d, stderr %q", code, errOut)
+	}
+	for _, want := range []string{
+		"Black Bronze (1000.00mB | 10.000Ing)\n",
+		"├── Copper (660.00mB | 6.600Ing)\n",
+		"└── Nickel (170.00mB | 1.700Ing)\n",
+		"Copper    660.00  6.600\n",
+		"Zinc      170.00  1.700\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+
+	// Names work as well as IDs, and nested nodes are indented.
+	code, out, _ = run(t, "Blue Steel", "100", "-mode", "mb")
+	if code != ExitOK || !strings.Contains(out, "│   ├── Black Steel (52.50mB | 0.525Ing)\n") {
+		t.Errorf("exit code %d, output:\n%s", code, out)
+	}
+
+	// A final steel's ID sets its raw form.
+	code, _, errOut = run(t, "blue_steel", "1", "-set", "black_steel.nickel=20")
+	if code != ExitOK {
+		t.Errorf("-set black_steel.nickel=20: exit code %d, stderr %q", code, errOut)
+	}
+}
+
+func TestRun_Formats(t *testing.T) {
+	code, out, errOut := run(t, "brass", "1", "-format", "json", "-set", "brass.copper=89")
+	if code != ExitOK {
+		t.Fatalf("exit code %d, stderr %q", code, errOut)
+	}
+	var doc report.Report
+	if err := json.Unmarshal([]byte(out), &doc); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out)
+	}
+	if doc.SchemaVersion != report.SchemaVersion || doc.Input.Mode != "Ingots" || doc.Input.Percentages["brass"]["zinc"] != 11 || doc.Summary["zinc"].MB != 11 {
+		t.Errorf("report = %+v", doc)
+	}
+
+	code, out, _ = run(t, "brass", "1", "-format", "csv")
+	if want := "schema_version,base_id,name,mb,ingots\n1,copper,Copper,90,0.9\n1,zinc,Zinc,10,0.1\n"; code != ExitOK || out != want {
+		t.Errorf("csv: exit code %d, output\n%s\nwant\n%s", code, out, want)
+	}
+}
+
+func TestRun_Errors(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		code int
+		want string
+	}{
+		{[]string{"brass", "10", "-set", "brass.copper=50"}, ExitError, "outside [88.00–92.00]"},
+		{[]string{"brass", "10", "-set", "rose_gold.gold=75"}, ExitError, "not used by Brass"},
+		{[]string{"unobtainium", "10"}, ExitError, "unknown alloy"},
+		{[]string{"brass", "-5"}, ExitError, "amount must be positive"},
+		{[]string{"brass", "ten"}, ExitUsage, "not a number"},
+		{[]string{"brass"}, ExitUsage, "want <alloy> <amount>"},
+		{[]string{"brass", "10", "-mode", "kg"}, ExitUsage, "neither ingots nor mb"},
+		{[]string{"brass", "10", "-set", "brass=50"}, ExitUsage, "want <alloy>.<ingredient>=<percent>"},
+		{[]string{"brass", "10", "-format", "xml"}, ExitUsage, "format \"xml\""},
+	} {
+		code, out, errOut := run(t, tc.args...)
+		if code != tc.code || !strings.Contains(errOut, tc.want) || out != "" {
+			t.Errorf("%q: exit code %d, stdout %q, stderr %q; want %d and %q", tc.args, code, out, errOut, tc.code, tc.want)
+		}
+	}
+}
+
+func TestFlagsFirst(t *testing.T) {
+	fs := flag.NewFlagSet("calc", flag.ContinueOnError)
+	AddCalcFlags(fs)
+	got := FlagsFirst(fs, []string{"brass", "-exact", "10", "--set", "brass.zinc=10", "-backend=recipes", "-recipes", "a.yaml", "--", "-x"})
+	want := []string{"-exact", "--set", "brass.zinc=10", "-backend=recipes", "-recipes", "a.yaml", "--", "brass", "10", "-x"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FlagsFirst = %q, want %q", got, want)
+	}
+}
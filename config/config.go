@@ -0,0 +1,446 @@
+// Package config gathers the settings of tfccalc from, in increasing priority:
+// built-in defaults, an optional TOML or YAML file, environment variables and
+// command-line flags.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/go-sql-driver/mysql"
+	"gopkg.in/yaml.v3"
+)
+
+// Backends accepted by Config.Backend. BackendAuto picks one from what is configured.
+const (
+	BackendAuto    = "auto"
+	BackendSQLite  = "sqlite"
+	BackendMySQL   = "mysql"
+	BackendRecipes = "recipes"
+)
+
+// Config holds every setting of the application. The field tags are the keys of
+// the config file:
+//
+//	backend = "mysql"          # auto | sqlite | mysql | recipes
+//	sqlite = "/path/tfccalc.db"
+//	recipes = "alloys.yaml"
+//	datapack = "mypack.zip"
+//	cache_ttl = "30s"
+//
+//	[mysql]                    # either dsn, or host/port/user/password/database
+//	dsn = "user:pass@tcp(127.0.0.1:3306)/tfccalc_db"
+//	host = "127.0.0.1"
+//	port = 3306
+//
+//	[ui]
+//	mode = "Ingots"            # mB | Ingots
+//	alloy = "black_steel"      # alloy selected at startup
+//	amount = 10
+type Config struct {
+	Backend  string        `toml:"backend" yaml:"backend"`
+	MySQL    MySQL         `toml:"mysql" yaml:"mysql"`
+	SQLite   string        `toml:"sqlite" yaml:"sqlite"`
+	Recipes  string        `toml:"recipes" yaml:"recipes"`
+	Datapack string        `toml:"datapack" yaml:"datapack"`
+	CacheTTL time.Duration `toml:"cache_ttl" yaml:"cache_ttl"`
+	UI       UI            `toml:"ui" yaml:"ui"`
+
+	// File is the config file that was read, or "" if there was none.
+	File string `toml:"-" yaml:"-"`
+
+	// sources records where each key got its value, for error messages.
+	sources map[string]string
+}
+
+// MySQL is the connection to a MySQL server. DSN wins over the separate fields.
+type MySQL struct {
+	DSN      string `toml:"dsn" yaml:"dsn"`
+	Host     string `toml:"host" yaml:"host"`
+	Port     int    `toml:"port" yaml:"port"`
+	User     string `toml:"user" yaml:"user"`
+	Password string `toml:"password" yaml:"password"`
+	Database string `toml:"database" yaml:"database"`
+}
+
+// UI holds the preferences of the calculator window.
+type UI struct {
+	Mode   string  `toml:"mode" yaml:"mode"`     // "mB" or "Ingots"
+	Alloy  string  `toml:"alloy" yaml:"alloy"`   // ID of the alloy selected at startup
+	Amount float64 `toml:"amount" yaml:"amount"` // amount filled in at startup, 0 for none
+}
+
+// Default returns the configuration used when nothing else is set.
+func Default() *Config {
+	return &Config{
+		Backend: BackendAuto,
+		SQLite:  DefaultSQLitePath(),
+		MySQL:   MySQL{Port: 3306},
+		UI:      UI{Mode: "Ingots"},
+		sources: make(map[string]string),
+	}
+}
+
+// DefaultSQLitePath returns <user config dir>/tfccalc/tfccalc.db, or a file in the
+// working directory if the config dir cannot be determined.
+func DefaultSQLitePath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "tfccalc.db"
+	}
+	return filepath.Join(dir, "tfccalc", "tfccalc.db")
+}
+
+// DefaultFile returns the config file read when none is given: config.toml,
+// config.yaml or config.yml in <user config dir>/tfccalc, whichever exists first.
+// It returns "" if there is none.
+func DefaultFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	for _, name := range []string{"config.toml", "config.yaml", "config.yml"} {
+		p := filepath.Join(dir, "tfccalc", name)
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return ""
+}
+
+// source returns where key got its value, e.g. "env TFCCALC_MODE".
+func (c *Config) source(key string) string {
+	if s, ok := c.sources[key]; ok {
+		return s
+	}
+	return "default"
+}
+
+// set records that key was set from src.
+func (c *Config) set(key, src string) {
+	if c.sources == nil {
+		c.sources = make(map[string]string)
+	}
+	c.sources[key] = src
+}
+
+// LoadFile reads a TOML (.toml) or YAML (.yaml, .yml) file over c. Keys the file
+// does not mention keep their current value; unknown keys are an error.
+func (c *Config) LoadFile(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read config file: %w", err)
+	}
+	src := "config file " + path
+	var keys []string
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".toml":
+		md, err := toml.Decode(string(raw), c)
+		if err != nil {
+			return fmt.Errorf("%s: %w", src, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("%s: unknown key %q", src, undecoded[0].String())
+		}
+		for _, k := range md.Keys() {
+			keys = append(keys, k.String())
+		}
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(raw))
+		dec.KnownFields(true)
+		if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("%s: %w", src, err)
+		}
+		var doc map[string]any
+		if err := yaml.Unmarshal(raw, &doc); err != nil {
+			return fmt.Errorf("%s: %w", src, err)
+		}
+		keys = yamlKeys("", doc)
+	default:
+		return fmt.Errorf("config file %s: unsupported extension %q (use .toml, .yaml or .yml)", path, ext)
+	}
+	for _, k := range keys {
+		c.set(k, src)
+	}
+	c.File = path
+	return nil
+}
+
+// yamlKeys flattens the keys of a decoded YAML document into "ui.mode" form.
+func yamlKeys(prefix string, doc map[string]any) []string {
+	var keys []string
+	for k, v := range doc {
+		key := prefix + k
+		keys = append(keys, key)
+		if sub, ok := v.(map[string]any); ok {
+			keys = append(keys, yamlKeys(key+".", sub)...)
+		}
+	}
+	return keys
+}
+
+// envVar maps an environment variable onto a config key.
+type envVar struct {
+	name string
+	key  string
+}
+
+// envVars lists the variables ApplyEnv reads. The DB_* names are the ones CI exports
+// for the MySQL service; the TFCCALC_DB_* forms win over them.
+var envVars = []envVar{
+	{"TFCCALC_BACKEND", "backend"},
+	{"TFCCALC_MYSQL_DSN", "mysql.dsn"},
+	{"DB_HOST", "mysql.host"},
+	{"TFCCALC_DB_HOST", "mysql.host"},
+	{"DB_PORT", "mysql.port"},
+	{"TFCCALC_DB_PORT", "mysql.port"},
+	{"DB_USER", "mysql.user"},
+	{"TFCCALC_DB_USER", "mysql.user"},
+	{"DB_PASS", "mysql.password"},
+	{"TFCCALC_DB_PASS", "mysql.password"},
+	{"DB_NAME", "mysql.database"},
+	{"TFCCALC_DB_NAME", "mysql.database"},
+	{"TFCCALC_SQLITE", "sqlite"},
+	{"TFCCALC_RECIPES", "recipes"},
+	{"TFCCALC_DATAPACK", "datapack"},
+	{"TFCCALC_CACHE_TTL", "cache_ttl"},
+	{"TFCCALC_MODE", "ui.mode"},
+	{"TFCCALC_ALLOY", "ui.alloy"},
+	{"TFCCALC_AMOUNT", "ui.amount"},
+}
+
+// ApplyEnv overrides c with the environment variables that are set and not empty.
+// getenv is usually os.Getenv.
+func (c *Config) ApplyEnv(getenv func(string) string) error {
+	var errs []error
+	for _, v := range envVars {
+		val := getenv(v.name)
+		if val == "" {
+			continue
+		}
+		if err := c.setKey(v.key, val); err != nil {
+			errs = append(errs, fmt.Errorf("env %s: %w", v.name, err))
+			continue
+		}
+		c.set(v.key, "env "+v.name)
+	}
+	return errors.Join(errs...)
+}
+
+// setKey parses val into the field behind key.
+func (c *Config) setKey(key, val string) error {
+	switch key {
+	case "backend":
+		c.Backend = val
+	case "mysql.dsn":
+		c.MySQL.DSN = val
+	case "mysql.host":
+		c.MySQL.Host = val
+	case "mysql.port":
+		port, err := strconv.Atoi(val)
+		if err != nil {
+			return fmt.Errorf("port %q is not a number", val)
+		}
+		c.MySQL.Port = port
+	case "mysql.user":
+		c.MySQL.User = val
+	case "mysql.password":
+		c.MySQL.Password = val
+	case "mysql.database":
+		c.MySQL.Database = val
+	case "sqlite":
+		c.SQLite = val
+	case "recipes":
+		c.Recipes = val
+	case "datapack":
+		c.Datapack = val
+	case "cache_ttl":
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q, want e.g. 30s or 5m", val)
+		}
+		c.CacheTTL = d
+	case "ui.mode":
+		c.UI.Mode = val
+	case "ui.alloy":
+		c.UI.Alloy = val
+	case "ui.amount":
+		amount, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return fmt.Errorf("amount %q is not a number", val)
+		}
+		c.UI.Amount = amount
+	default:
+		return fmt.Errorf("unknown setting %s", key)
+	}
+	return nil
+}
+
+// flagKeys maps command-line flags onto config keys.
+var flagKeys = []struct {
+	flag, key, usage string
+}{
+	{"backend", "backend", "store to use: auto, sqlite, mysql or recipes (env TFCCALC_BACKEND)"},
+	{"mysql-dsn", "mysql.dsn", "MySQL DSN, e.g. tfccalc_user:tfccalc_pass@tcp(127.0.0.1:3405)/tfccalc_db (env TFCCALC_MYSQL_DSN, or DB_HOST/DB_PORT/DB_USER/DB_PASS/DB_NAME)"},
+	{"sqlite", "sqlite", "SQLite database file, used when no MySQL server is configured (env TFCCALC_SQLITE; default " + DefaultSQLitePath() + ")"},
+	{"recipes", "recipes", "JSON or YAML recipe file to load instead of a database (env TFCCALC_RECIPES)"},
+	{"datapack", "datapack", "TFC datapack directory or .zip whose alloy recipes override the loaded ones (env TFCCALC_DATAPACK)"},
+	{"cache-ttl", "cache_ttl", "re-read the database after this long, e.g. 30s; 0 caches until restart (env TFCCALC_CACHE_TTL)"},
+	{"mode", "ui.mode", "amount unit: mB or Ingots, in any case (env TFCCALC_MODE; default Ingots)"},
+	{"alloy", "ui.alloy", "ID of the alloy to select at startup (env TFCCALC_ALLOY)"},
+	{"amount", "ui.amount", "amount to fill in at startup (env TFCCALC_AMOUNT)"},
+}
+
+// Load registers the config flags on fs, parses args and builds the configuration:
+// defaults, then the config file (-config, TFCCALC_CONFIG or DefaultFile), then the
+// environment, then the flags given in args. The result is validated. Flags the
+// caller registered on fs before are parsed too; positional arguments are left in
+// fs.Args().
+func Load(fs *flag.FlagSet, args []string) (*Config, error) {
+	configPath := fs.String("config", "", "TOML or YAML config file (env TFCCALC_CONFIG; default <user config dir>/tfccalc/config.toml if it exists)")
+	values := make(map[string]*string, len(flagKeys))
+	for _, f := range flagKeys {
+		values[f.flag] = fs.String(f.flag, "", f.usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	c := Default()
+	path := *configPath
+	if path == "" {
+		path = os.Getenv("TFCCALC_CONFIG")
+	}
+	if path == "" {
+		path = DefaultFile()
+	}
+	if path != "" {
+		if err := c.LoadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	errs := []error{c.ApplyEnv(os.Getenv)}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for _, f := range flagKeys {
+		if !set[f.flag] {
+			continue
+		}
+		if err := c.setKey(f.key, *values[f.flag]); err != nil {
+			errs = append(errs, fmt.Errorf("flag -%s: %w", f.flag, err))
+			continue
+		}
+		c.set(f.key, "flag -"+f.flag)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	c.normalize()
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// normalize brings settings that may be spelled in several ways into their canonical
+// form once every source is merged, so that e.g. mode = "mb" in the config file, the
+// environment and -mode mb all mean "mB".
+func (c *Config) normalize() {
+	switch {
+	case strings.EqualFold(c.UI.Mode, "mB"):
+		c.UI.Mode = "mB"
+	case strings.EqualFold(c.UI.Mode, "Ingots"):
+		c.UI.Mode = "Ingots"
+	}
+}
+
+// ResolvedBackend returns the backend to open. For BackendAuto that is a recipe
+// file if one is set, then MySQL if a server is configured, otherwise SQLite.
+func (c *Config) ResolvedBackend() string {
+	if c.Backend != BackendAuto && c.Backend != "" {
+		return c.Backend
+	}
+	switch {
+	case c.Recipes != "":
+		return BackendRecipes
+	case c.MySQL.DSN != "" || c.MySQL.Host != "":
+		return BackendMySQL
+	default:
+		return BackendSQLite
+	}
+}
+
+// MySQLDSN returns the DSN to connect with: MySQL.DSN if set, otherwise one built
+// from the host, port, user, password and database. It returns "" if neither is set.
+func (c *Config) MySQLDSN() string {
+	if c.MySQL.DSN != "" {
+		return c.MySQL.DSN
+	}
+	if c.MySQL.Host == "" {
+		return ""
+	}
+	m := mysql.NewConfig()
+	m.User = c.MySQL.User
+	m.Passwd = c.MySQL.Password
+	m.Net = "tcp"
+	m.Addr = net.JoinHostPort(c.MySQL.Host, strconv.Itoa(c.MySQL.Port))
+	m.DBName = c.MySQL.Database
+	return m.FormatDSN()
+}
+
+// Validate reports every setting that cannot work, naming where it came from.
+func (c *Config) Validate() error {
+	var errs []error
+	bad := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s (from %s): %s", key, c.source(key), fmt.Sprintf(format, args...)))
+	}
+
+	switch c.Backend {
+	case "", BackendAuto, BackendSQLite, BackendMySQL, BackendRecipes:
+	default:
+		bad("backend", "unknown backend %q, want auto, sqlite, mysql or recipes", c.Backend)
+	}
+	switch c.ResolvedBackend() {
+	case BackendMySQL:
+		if c.MySQLDSN() == "" {
+			bad("backend", "mysql needs a DSN (-mysql-dsn, TFCCALC_MYSQL_DSN) or a host (DB_HOST)")
+		}
+	case BackendRecipes:
+		if c.Recipes == "" {
+			bad("backend", "recipes needs a recipe file (-recipes, TFCCALC_RECIPES)")
+		}
+	case BackendSQLite:
+		if c.SQLite == "" {
+			bad("sqlite", "no SQLite file given")
+		}
+	}
+	if c.MySQL.DSN != "" {
+		if _, err := mysql.ParseDSN(c.MySQL.DSN); err != nil {
+			bad("mysql.dsn", "%v", err)
+		}
+	}
+	if c.MySQL.Port < 1 || c.MySQL.Port > 65535 {
+		bad("mysql.port", "port %d out of range", c.MySQL.Port)
+	}
+	if c.CacheTTL < 0 {
+		bad("cache_ttl", "must not be negative")
+	}
+	if c.UI.Mode != "mB" && c.UI.Mode != "Ingots" {
+		bad("ui.mode", "unknown mode %q, want mB or Ingots", c.UI.Mode)
+	}
+	if c.UI.Amount < 0 {
+		bad("ui.amount", "must not be negative")
+	}
+	return errors.Join(errs...)
+}
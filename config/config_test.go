@@ -0,0 +1,238 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// cleanEnv clears every variable Load reads and points the user config dir at an
+// empty temp dir, so the tests do not depend on CI's DB_* variables or a real
+// config file.
+func cleanEnv(t *testing.T) {
+	t.Helper()
+	for _, v := range envVars {
+		t.Setenv(v.name, "")
+	}
+	t.Setenv("TFCCALC_CONFIG", "")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+}
+
+// load runs Load on a fresh FlagSet that does not print to stderr.
+func load(args ...string) (*Config, error) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return Load(fs, args)
+}
+
+// writeFile writes content to name in a temp dir and returns its path.
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	cleanEnv(t)
+	c, err := load()
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if c.ResolvedBackend() != BackendSQLite || c.SQLite != DefaultSQLitePath() {
+		t.Errorf("backend = %s (%s), want sqlite at the default path", c.ResolvedBackend(), c.SQLite)
+	}
+	if c.UI.Mode != "Ingots" || c.File != "" {
+		t.Errorf("Load() = %+v, want mode Ingots and no config file", c)
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	cleanEnv(t)
+	path := writeFile(t, "config.toml", `
+backend = "sqlite"
+sqlite = "from-file.db"
+cache_ttl = "1m"
+
+[ui]
+mode = "mB"
+alloy = "black_steel"
+amount = 5
+`)
+	t.Setenv("TFCCALC_SQLITE", "from-env.db")
+	t.Setenv("TFCCALC_ALLOY", "brass")
+
+	c, err := load("-config", path, "-alloy", "rose_gold")
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if c.SQLite != "from-env.db" {
+		t.Errorf("sqlite = %q, want the environment to override the file", c.SQLite)
+	}
+	if c.UI.Alloy != "rose_gold" {
+		t.Errorf("ui.alloy = %q, want the flag to override the environment", c.UI.Alloy)
+	}
+	if c.UI.Mode != "mB" || c.UI.Amount != 5 || c.CacheTTL != time.Minute {
+		t.Errorf("file settings not applied: %+v", c)
+	}
+	if c.File != path {
+		t.Errorf("File = %q, want %q", c.File, path)
+	}
+
+	// Every source may spell the mode in any case.
+	c, err = load("-config", path, "-mode", "ingots")
+	if err != nil || c.UI.Mode != "Ingots" {
+		t.Errorf("-mode ingots: mode = %q, error %v; want Ingots", c.UI.Mode, err)
+	}
+	lower := writeFile(t, "lower.toml", "[ui]\nmode = \"mb\"\n")
+	c, err = load("-config", lower)
+	if err != nil || c.UI.Mode != "mB" {
+		t.Errorf("mode = \"mb\" in the file: mode = %q, error %v; want mB", c.UI.Mode, err)
+	}
+	t.Setenv("TFCCALC_MODE", "INGOTS")
+	c, err = load("-config", lower)
+	if err != nil || c.UI.Mode != "Ingots" {
+		t.Errorf("TFCCALC_MODE=INGOTS: mode = %q, error %v; want Ingots", c.UI.Mode, err)
+	}
+}
+
+func TestLoad_YAMLFileFromEnv(t *testing.T) {
+	cleanEnv(t)
+	path := writeFile(t, "tfccalc.yaml", "backend: recipes\nrecipes: alloys.yaml\nui:\n  mode: mB\n")
+	t.Setenv("TFCCALC_CONFIG", path)
+	c, err := load()
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if c.ResolvedBackend() != BackendRecipes || c.Recipes != "alloys.yaml" || c.UI.Mode != "mB" {
+		t.Errorf("Load = %+v, want the YAML settings", c)
+	}
+}
+
+func TestLoad_DefaultFile(t *testing.T) {
+	cleanEnv(t)
+	dir := filepath.Join(os.Getenv("XDG_CONFIG_HOME"), "tfccalc")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config.yaml"), []byte("ui:\n  amount: 3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := load()
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if c.UI.Amount != 3 {
+		t.Errorf("ui.amount = %v, want 3 from the default config file", c.UI.Amount)
+	}
+}
+
+// CI exports DB_HOST and friends for the MySQL service.
+func TestLoad_CIDatabaseVariables(t *testing.T) {
+	cleanEnv(t)
+	t.Setenv("DB_HOST", "127.0.0.1")
+	t.Setenv("DB_PORT", "3405")
+	t.Setenv("DB_USER", "tfccalc_user")
+	t.Setenv("DB_PASS", "tfccalc_pass")
+	t.Setenv("DB_NAME", "tfccalc_db")
+	c, err := load()
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if c.ResolvedBackend() != BackendMySQL {
+		t.Errorf("backend = %s, want mysql when DB_HOST is set", c.ResolvedBackend())
+	}
+	if want := "tfccalc_user:tfccalc_pass@tcp(127.0.0.1:3405)/tfccalc_db"; c.MySQLDSN() != want {
+		t.Errorf("MySQLDSN() = %q, want %q", c.MySQLDSN(), want)
+	}
+
+	// An explicit DSN wins over the separate fields.
+	t.Setenv("TFCCALC_MYSQL_DSN", "u:p@tcp(db:3306)/other?timeout=5s")
+	c, err = load()
+	if err != nil {
+		t.Fatalf("Load error: %v", err)
+	}
+	if c.MySQLDSN() != "u:p@tcp(db:3306)/other?timeout=5s" {
+		t.Errorf("MySQLDSN() = %q, want the DSN from TFCCALC_MYSQL_DSN", c.MySQLDSN())
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	cases := []struct {
+		name string
+		env  map[string]string
+		file string // TOML content, if any
+		args []string
+		want []string // substrings of the error
+	}{
+		{
+			name: "bad mode names its source",
+			env:  map[string]string{"TFCCALC_MODE": "ingot"},
+			want: []string{"ui.mode (from env TFCCALC_MODE)", `"ingot"`},
+		},
+		{
+			name: "bad duration",
+			args: []string{"-cache-ttl", "soon"},
+			want: []string{"flag -cache-ttl", `"soon"`},
+		},
+		{
+			name: "bad port",
+			env:  map[string]string{"DB_HOST": "localhost", "DB_PORT": "mysql"},
+			want: []string{"env DB_PORT", "not a number"},
+		},
+		{
+			name: "mysql without a server",
+			args: []string{"-backend", "mysql"},
+			want: []string{"backend (from flag -backend)", "mysql needs a DSN"},
+		},
+		{
+			name: "unknown backend",
+			file: `backend = "postgres"`,
+			want: []string{"backend (from config file", `"postgres"`},
+		},
+		{
+			name: "unknown key",
+			file: "[ui]\ncolour = \"red\"",
+			want: []string{"unknown key", "ui.colour"},
+		},
+		{
+			name: "several problems at once",
+			env:  map[string]string{"TFCCALC_MODE": "x", "TFCCALC_AMOUNT": "-1"},
+			want: []string{"ui.mode", "ui.amount"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cleanEnv(t)
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+			args := tc.args
+			if tc.file != "" {
+				args = append([]string{"-config", writeFile(t, "config.toml", tc.file)}, args...)
+			}
+			_, err := load(args...)
+			if err == nil {
+				t.Fatalf("Load succeeded, want an error containing %q", tc.want)
+			}
+			for _, w := range tc.want {
+				if !strings.Contains(err.Error(), w) {
+					t.Errorf("error %q does not contain %q", err, w)
+				}
+			}
+		})
+	}
+}
+
+func TestLoad_MissingConfigFile(t *testing.T) {
+	cleanEnv(t)
+	if _, err := load("-config", filepath.Join(t.TempDir(), "nope.toml")); err == nil {
+		t.Errorf("Load with a missing -config file succeeded, want an error")
+	}
+}
@@ -1,25 +1,23 @@
 // tfccalc/data/alloys.go
 package data
 
-import "fmt"
+import (
+	"context"
+	"errors"
+	"fmt"
+)
 
-// GetAlloyByID returns (AlloyInfo, true) if found, or (zero, false) otherwise.
-// Internally calls dbGetAlloyByID from db.go.
-func GetAlloyByID(id string) (AlloyInfo, bool) {
-	return dbGetAlloyByID(id)
-}
-
-// GetAlloyNameByID returns the human-readable name for a given ID, or "Unknown[ID]" if not found.
-func GetAlloyNameByID(id string) string {
-	a, ok := dbGetAlloyByID(id)
-	if !ok {
+// GetAlloyNameByID returns the human-readable name for a given ID, for display.
+// It returns "Unknown[ID]" if the ID does not exist and "Unavailable[ID]" if the
+// store could not be queried, so the two cases are never confused.
+func GetAlloyNameByID(ctx context.Context, store RecipeStore, id string) string {
+	a, err := store.GetAlloyByID(ctx, id)
+	switch {
+	case err == nil:
+		return a.Name
+	case errors.Is(err, ErrNotFound):
 		return fmt.Sprintf("Unknown[%s]", id)
+	default:
+		return fmt.Sprintf("Unavailable[%s]", id)
 	}
-	return a.Name
-}
-
-// GetAllAlloys returns a map[id]→AlloyInfo for all alloys/materials.
-// Internally calls dbGetAllAlloys from db.go.
-func GetAllAlloys() map[string]AlloyInfo {
-	return dbGetAllAlloys()
 }
@@ -0,0 +1,68 @@
+// tfccalc/data/catalog.go
+package data
+
+import "database/sql"
+
+// DefaultAlloys returns the stock TFC alloy catalog, the same rows that the
+// 0002_seed_stock_catalog migration inserts. Use it with NewMemoryStore to run
+// without a database.
+func DefaultAlloys() []AlloyInfo {
+	base := func(id, name string) AlloyInfo {
+		return AlloyInfo{ID: id, Name: name, Type: "base"}
+	}
+	mixed := func(id, name, typ string, ings ...IngredientInfo) AlloyInfo {
+		return AlloyInfo{ID: id, Name: name, Type: typ, Ingredients: ings}
+	}
+	finalSteel := func(id, name, rawForm, extra string) AlloyInfo {
+		return AlloyInfo{
+			ID:                id,
+			Name:              name,
+			Type:              "final_steel",
+			RawFormID:         sql.NullString{String: rawForm, Valid: true},
+			ExtraIngredientID: sql.NullString{String: extra, Valid: true},
+		}
+	}
+	ing := func(id string, min, max float64) IngredientInfo {
+		return IngredientInfo{IngredientID: id, Min: min, Max: max}
+	}
+
+	return []AlloyInfo{
+		// Base metals
+		base("copper", "Copper"),
+		base("zinc", "Zinc"),
+		base("bismuth", "Bismuth"),
+		base("silver", "Silver"),
+		base("gold", "Gold"),
+		base("nickel", "Nickel"),
+		base("pig_iron", "Pig Iron"),
+
+		// Simple alloys (bronzes, brasses, etc.)
+		mixed("bismuth_bronze", "Bismuth Bronze", "alloy",
+			ing("copper", 85, 92), ing("bismuth", 8, 15)),
+		mixed("black_bronze", "Black Bronze", "alloy",
+			ing("copper", 50, 70), ing("zinc", 15, 25), ing("nickel", 15, 25)),
+		mixed("brass", "Brass", "alloy",
+			ing("copper", 88, 92), ing("zinc", 8, 12)),
+		mixed("rose_gold", "Rose Gold", "alloy",
+			ing("gold", 75, 80), ing("silver", 20, 25)),
+		mixed("sterling_silver", "Sterling Silver", "alloy",
+			ing("silver", 92.5, 92.5), ing("copper", 7.5, 7.5)),
+
+		// Processed steel
+		mixed("steel", "Steel", "processed",
+			ing("pig_iron", 100, 100)),
+
+		// Raw steels
+		mixed("raw_black_steel", "Raw Black Steel", "raw_steel",
+			ing("steel", 50, 70), ing("nickel", 15, 25), ing("black_bronze", 15, 25)),
+		mixed("raw_blue_steel", "Raw Blue Steel", "raw_steel",
+			ing("black_steel", 50, 55), ing("steel", 20, 25), ing("bismuth_bronze", 10, 15), ing("sterling_silver", 10, 15)),
+		mixed("raw_red_steel", "Raw Red Steel", "raw_steel",
+			ing("black_steel", 50, 55), ing("steel", 20, 25), ing("brass", 10, 15), ing("rose_gold", 10, 15)),
+
+		// Final steels
+		finalSteel("black_steel", "Black Steel", "raw_black_steel", "pig_iron"),
+		finalSteel("blue_steel", "Blue Steel", "raw_blue_steel", "black_steel"),
+		finalSteel("red_steel", "Red Steel", "raw_red_steel", "black_steel"),
+	}
+}
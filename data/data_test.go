@@ -1,72 +1,798 @@
 package data
 
 import (
+	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
+
+	"tfccalc/config"
 )
 
+// testStores holds every RecipeStore the tests run against. The memory and SQLite
+// stores are always present; the MySQL store is added only when a server is configured
+// (TFCCALC_MYSQL_DSN or DB_HOST etc., as in CI) and reachable.
+var testStores = map[string]RecipeStore{}
+
 func TestMain(m *testing.M) {
-	dsn := fmt.Sprintf(
-		"%s:%s@tcp(%s:%d)/%s?parseTime=true&charset=utf8mb4",
-		"tfccalc_user", "tfccalc_pass", "127.0.0.1", 3405, "tfccalc_db",
-	)
-	if err := InitDB(dsn); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to initialize DB: %v\n", err)
+	testStores["memory"] = NewMemoryStore(DefaultAlloys())
+
+	tmpDir, err := os.MkdirTemp("", "tfccalc-data-test")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create temp dir: %v\n", err)
+		os.Exit(1)
+	}
+	sqliteStore, err := NewSQLiteStore(filepath.Join(tmpDir, "tfccalc.db"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to initialize SQLite: %v\n", err)
+		os.Exit(1)
+	}
+	testStores["sqlite"] = sqliteStore
+
+	cfg := config.Default()
+	if err := cfg.ApplyEnv(os.Getenv); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid database environment: %v\n", err)
 		os.Exit(1)
 	}
-	os.Exit(m.Run())
+	if dsn := cfg.MySQLDSN(); dsn == "" {
+		fmt.Fprintln(os.Stderr, "Skipping MySQL store tests: set TFCCALC_MYSQL_DSN or DB_HOST to run them")
+	} else if store, err := NewMySQLStore(dsn); err != nil {
+		fmt.Fprintf(os.Stderr, "Skipping MySQL store tests: %v\n", err)
+	} else {
+		testStores["mysql"] = store
+	}
+	code := m.Run()
+	sqliteStore.Close()
+	os.RemoveAll(tmpDir)
+	os.Exit(code)
+}
+
+// ctx is the context passed to every store call in the tests.
+var ctx = context.Background()
+
+// forEachStore runs fn as a subtest for every store in testStores.
+func forEachStore(t *testing.T, fn func(t *testing.T, store RecipeStore)) {
+	for name, store := range testStores {
+		t.Run(name, func(t *testing.T) { fn(t, store) })
+	}
 }
 
 func TestGetAlloyByID_ExistsAndNotExists(t *testing.T) {
-	// Check an existing alloy
-	alloy, ok := GetAlloyByID("brass")
-	if !ok {
-		t.Fatalf("GetAlloyByID(brass) returned ok=false, want true")
+	forEachStore(t, func(t *testing.T, store RecipeStore) {
+		// Check an existing alloy
+		alloy, err := store.GetAlloyByID(ctx, "brass")
+		if err != nil {
+			t.Fatalf("GetAlloyByID(brass) returned error %v, want nil", err)
+		}
+		if alloy.Name != "Brass" || alloy.Type != "alloy" {
+			t.Errorf("GetAlloyByID(brass) = %+v, want Name=\"Brass\", Type=\"alloy\"", alloy)
+		}
+		// Check a non-existent ID
+		_, err2 := store.GetAlloyByID(ctx, "nonexistent_id")
+		if !errors.Is(err2, ErrNotFound) {
+			t.Errorf("GetAlloyByID(nonexistent_id) error = %v, want ErrNotFound", err2)
+		}
+	})
+}
+
+func TestGetAllAlloys_BasicConsistency(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store RecipeStore) {
+		allAlloys, err := store.GetAllAlloys(ctx)
+		if err != nil {
+			t.Fatalf("GetAllAlloys returned error: %v", err)
+		}
+		// Ensure there is at least one alloy in the store
+		if len(allAlloys) == 0 {
+			t.Fatalf("GetAllAlloys returned 0 entries, want > 0")
+		}
+		// For each ID returned, GetAlloyByID should find it.
+		for id := range allAlloys {
+			if _, err := store.GetAlloyByID(ctx, id); err != nil {
+				t.Errorf("GetAllAlloys returned ID %q that GetAlloyByID cannot find", id)
+			}
+		}
+	})
+}
+
+func TestGetAlloyByID_Caching(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store RecipeStore) {
+		// Two calls to GetAlloyByID should return identical data without error
+		a1, err1 := store.GetAlloyByID(ctx, "brass")
+		a2, err2 := store.GetAlloyByID(ctx, "brass")
+		if err1 != nil || err2 != nil {
+			t.Fatalf("GetAlloyByID(brass) returned errors %v, %v", err1, err2)
+		}
+		if a1.ID != a2.ID || a1.Name != a2.Name || a1.Type != a2.Type {
+			t.Errorf("Cached GetAlloyByID returned different results: %+v vs %+v", a1, a2)
+		}
+	})
+}
+
+func TestGetIngredients(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store RecipeStore) {
+		ings, err := store.GetIngredients(ctx, "brass")
+		if err != nil {
+			t.Fatalf("GetIngredients(brass) returned error: %v", err)
+		}
+		if len(ings) != 2 {
+			t.Fatalf("GetIngredients(brass) returned %d entries, want 2", len(ings))
+		}
+		for _, ing := range ings {
+			if ing.IngredientID != "copper" && ing.IngredientID != "zinc" {
+				t.Errorf("GetIngredients(brass) contains unexpected ingredient %q", ing.IngredientID)
+			}
+		}
+		if got, err := store.GetIngredients(ctx, "copper"); err != nil || len(got) != 0 {
+			t.Errorf("GetIngredients(copper) = (%v, %v), want none", got, err)
+		}
+		if _, err := store.GetIngredients(ctx, "nonexistent_id"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetIngredients(nonexistent_id) error = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestGetAlloyNameByID(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store RecipeStore) {
+		name := GetAlloyNameByID(ctx, store, "brass")
+		if name != "Brass" {
+			t.Errorf("GetAlloyNameByID(brass) = %q, want \"Brass\"", name)
+		}
+		unknown := GetAlloyNameByID(ctx, store, "does_not_exist")
+		if len(unknown) == 0 || unknown[:7] != "Unknown" {
+			t.Errorf("GetAlloyNameByID(does_not_exist) = %q, want prefix \"Unknown\"", unknown)
+		}
+	})
+}
+
+func TestMemoryStore_ReturnsCopies(t *testing.T) {
+	store := NewMemoryStore(DefaultAlloys())
+	a, _ := store.GetAlloyByID(ctx, "brass")
+	a.Ingredients[0].Min = -1
+	b, _ := store.GetAlloyByID(ctx, "brass")
+	if b.Ingredients[0].Min == -1 {
+		t.Errorf("mutating a returned AlloyInfo changed the store")
 	}
-	if alloy.Name != "Brass" || alloy.Type != "alloy" {
-		t.Errorf("GetAlloyByID(brass) = %+v, want Name=\"Brass\", Type=\"alloy\"", alloy)
+}
+
+func TestSQLiteStore_SeedsOnlyOnFirstLaunch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "tfccalc.db")
+	first, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore(new file) error: %v", err)
 	}
-	// Check a non-existent ID
-	_, ok2 := GetAlloyByID("nonexistent_id")
-	if ok2 {
-		t.Errorf("GetAlloyByID(nonexistent_id) = ok=true, want ok=false")
+	if _, err := first.db.Exec(`DELETE FROM alloys WHERE id = 'brass'`); err != nil {
+		t.Fatalf("deleting brass: %v", err)
+	}
+	first.Close()
+
+	// Reopening must keep the existing data instead of seeding again.
+	second, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore(existing file) error: %v", err)
+	}
+	defer second.Close()
+	if _, err := second.GetAlloyByID(ctx, "brass"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("brass reappeared after reopening, want the database left untouched")
+	}
+	all, err := second.GetAllAlloys(ctx)
+	if want := len(DefaultAlloys()) - 1; err != nil || len(all) != want {
+		t.Errorf("GetAllAlloys after reopen returned (%d entries, %v), want %d", len(all), err, want)
 	}
 }
 
-func TestGetAllAlloys_BasicConsistency(t *testing.T) {
-	allAlloys := GetAllAlloys()
-	// Ensure there is at least one alloy in the DB
-	if len(allAlloys) == 0 {
-		t.Fatalf("GetAllAlloys returned 0 entries, want > 0")
+func TestSQLiteSeed_MatchesDefaultAlloys(t *testing.T) {
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "tfccalc.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore error: %v", err)
 	}
-	// For each ID returned, GetAlloyByID should find it.
-	for id := range allAlloys {
-		if _, ok := GetAlloyByID(id); !ok {
-			t.Errorf("GetAllAlloys returned ID %q that GetAlloyByID cannot find", id)
+	defer store.Close()
+	seeded, err := store.GetAllAlloys(ctx)
+	if err != nil {
+		t.Fatalf("GetAllAlloys error: %v", err)
+	}
+	defaults := DefaultAlloys()
+	if len(seeded) != len(defaults) {
+		t.Fatalf("SQLite seed has %d alloys, DefaultAlloys has %d", len(seeded), len(defaults))
+	}
+	for _, want := range defaults {
+		got, ok := seeded[want.ID]
+		if !ok {
+			t.Errorf("alloy %q missing from SQLite seed", want.ID)
+			continue
+		}
+		if got.Name != want.Name || got.Type != want.Type ||
+			got.RawFormID != want.RawFormID || got.ExtraIngredientID != want.ExtraIngredientID {
+			t.Errorf("alloy %q: seed = %+v, DefaultAlloys = %+v", want.ID, got, want)
+		}
+		ranges := make(map[string]IngredientInfo)
+		for _, ing := range got.Ingredients {
+			ranges[ing.IngredientID] = ing
+		}
+		if len(ranges) != len(want.Ingredients) {
+			t.Errorf("alloy %q: seed has %d ingredients, want %d", want.ID, len(ranges), len(want.Ingredients))
+		}
+		for _, ing := range want.Ingredients {
+			if ranges[ing.IngredientID] != ing {
+				t.Errorf("alloy %q: ingredient %+v, want %+v", want.ID, ranges[ing.IngredientID], ing)
+			}
 		}
 	}
 }
 
-func TestGetAlloyByID_Caching(t *testing.T) {
-	// Two calls to GetAlloyByID should return identical data without error
-	a1, ok1 := GetAlloyByID("brass")
-	a2, ok2 := GetAlloyByID("brass")
-	if !ok1 || !ok2 {
-		t.Fatalf("GetAlloyByID(brass) returned ok=false")
+// Every store lists ingredients in recipe order: the first one absorbs rounding in
+// default percentages, so a different order would give different defaults.
+func TestStores_IngredientOrderMatchesMemory(t *testing.T) {
+	memory := NewMemoryStore(DefaultAlloys())
+	for name, store := range testStores {
+		for _, a := range DefaultAlloys() {
+			want, _ := memory.GetIngredients(ctx, a.ID)
+			got, err := store.GetIngredients(ctx, a.ID)
+			if err != nil {
+				t.Fatalf("%s: GetIngredients(%s) error: %v", name, a.ID, err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: GetIngredients(%s) = %v, want %v", name, a.ID, got, want)
+			}
+		}
+	}
+}
+
+func TestLoadRecipeFile_StockYAMLMatchesDefaultAlloys(t *testing.T) {
+	alloys, err := LoadRecipeFile(filepath.Join("..", "db", "alloys.yaml"))
+	if err != nil {
+		t.Fatalf("LoadRecipeFile(db/alloys.yaml) error: %v", err)
 	}
-	if a1.ID != a2.ID || a1.Name != a2.Name || a1.Type != a2.Type {
-		t.Errorf("Cached GetAlloyByID returned different results: %+v vs %+v", a1, a2)
+	if !reflect.DeepEqual(alloys, DefaultAlloys()) {
+		t.Errorf("db/alloys.yaml differs from DefaultAlloys()")
 	}
 }
 
-func TestGetAlloyNameByID(t *testing.T) {
-	name := GetAlloyNameByID("brass")
-	if name != "Brass" {
-		t.Errorf("GetAlloyNameByID(brass) = %q, want \"Brass\"", name)
+func TestNewFileStore_JSON(t *testing.T) {
+	store, err := NewFileStore(filepath.Join("testdata", "bronze.json"))
+	if err != nil {
+		t.Fatalf("NewFileStore(bronze.json) error: %v", err)
+	}
+	bronze, err := store.GetAlloyByID(ctx, "bronze")
+	if err != nil {
+		t.Fatalf("GetAlloyByID(bronze) returned error: %v", err)
+	}
+	want := []IngredientInfo{{"copper", 88, 92}, {"tin", 8, 12}}
+	if bronze.Type != "alloy" || !reflect.DeepEqual(bronze.Ingredients, want) {
+		t.Errorf("bronze = %+v, want type alloy with ingredients %v", bronze, want)
+	}
+}
+
+func TestParseRecipes_Invalid(t *testing.T) {
+	cases := map[string]string{
+		"unknown field":      `{"alloys":[{"id":"copper","name":"Copper","type":"base","colour":"red"}]}`,
+		"unknown type":       `{"alloys":[{"id":"copper","name":"Copper","type":"metal"}]}`,
+		"duplicate id":       `{"alloys":[{"id":"copper","name":"A","type":"base"},{"id":"copper","name":"B","type":"base"}]}`,
+		"unknown ingredient": `{"alloys":[{"id":"brass","name":"Brass","type":"alloy","ingredients":[{"id":"copper","min":100,"max":100}]}]}`,
+		"min above max": `{"alloys":[{"id":"copper","name":"Copper","type":"base"},
+			{"id":"brass","name":"Brass","type":"alloy","ingredients":[{"id":"copper","min":100,"max":90}]}]}`,
+		"ranges miss 100": `{"alloys":[{"id":"copper","name":"Copper","type":"base"},
+			{"id":"brass","name":"Brass","type":"alloy","ingredients":[{"id":"copper","min":10,"max":20}]}]}`,
+		"final steel without raw form": `{"alloys":[{"id":"black_steel","name":"Black Steel","type":"final_steel"}]}`,
+	}
+	for name, doc := range cases {
+		if _, err := ParseRecipes([]byte(doc), "json"); err == nil {
+			t.Errorf("%s: ParseRecipes returned no error", name)
+		}
+	}
+
+	yamlDoc := "alloys:\n  - id: copper\n    name: Copper\n    type: base\n"
+	if alloys, err := ParseRecipes([]byte(yamlDoc), "yaml"); err != nil || len(alloys) != 1 {
+		t.Errorf("ParseRecipes(valid yaml) = (%v, %v), want one alloy", alloys, err)
+	}
+}
+
+func TestMarshalRecipes_RoundTrip(t *testing.T) {
+	for _, format := range []string{"json", "yaml"} {
+		raw, err := MarshalRecipes(DefaultAlloys(), format)
+		if err != nil {
+			t.Fatalf("MarshalRecipes(%s) error: %v", format, err)
+		}
+		alloys, err := ParseRecipes(raw, format)
+		if err != nil {
+			t.Fatalf("ParseRecipes(MarshalRecipes(%s)) error: %v", format, err)
+		}
+		if !reflect.DeepEqual(alloys, DefaultAlloys()) {
+			t.Errorf("%s round trip differs from DefaultAlloys()", format)
+		}
+	}
+	if _, err := MarshalRecipes(nil, "toml"); err == nil {
+		t.Errorf("MarshalRecipes(toml) returned no error")
+	}
+}
+
+func TestSQLStore_ReportsDriverErrors(t *testing.T) {
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "tfccalc.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore error: %v", err)
+	}
+	// A closed connection stands in for an unreachable database.
+	store.Close()
+
+	if _, err := store.GetAlloyByID(ctx, "brass"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("GetAlloyByID on closed DB error = %v, want a driver error that is not ErrNotFound", err)
+	}
+	if all, err := store.GetAllAlloys(ctx); err == nil || all != nil {
+		t.Errorf("GetAllAlloys on closed DB = (%v, %v), want (nil, error)", all, err)
+	}
+	if name := GetAlloyNameByID(ctx, store, "brass"); name != "Unavailable[brass]" {
+		t.Errorf("GetAlloyNameByID on closed DB = %q, want \"Unavailable[brass]\"", name)
+	}
+}
+
+// A single lookup must not make GetAllAlloys return a one-entry catalog.
+func TestSQLStore_GetAllAlloysAfterPartialCache(t *testing.T) {
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "tfccalc.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore error: %v", err)
+	}
+	defer store.Close()
+
+	if _, err := store.GetAlloyByID(ctx, "brass"); err != nil {
+		t.Fatalf("GetAlloyByID(brass) error: %v", err)
+	}
+	all, err := store.GetAllAlloys(ctx)
+	if err != nil || len(all) != len(DefaultAlloys()) {
+		t.Errorf("GetAllAlloys after one lookup = (%d entries, %v), want %d", len(all), err, len(DefaultAlloys()))
+	}
+
+	// The change is not seen until brass is invalidated; invalidating a cached ID makes
+	// the cache partial again, so the next call must re-read it from the database.
+	if _, err := store.db.Exec(`UPDATE alloys SET name = 'Yellow Brass' WHERE id = 'brass'`); err != nil {
+		t.Fatal(err)
+	}
+	if all, _ := store.GetAllAlloys(ctx); all["brass"].Name != "Brass" {
+		t.Errorf("brass before Invalidate = %q, want the cached \"Brass\"", all["brass"].Name)
+	}
+	store.Invalidate("brass")
+	all, err = store.GetAllAlloys(ctx)
+	if err != nil || len(all) != len(DefaultAlloys()) {
+		t.Errorf("GetAllAlloys after Invalidate = (%d entries, %v), want %d", len(all), err, len(DefaultAlloys()))
+	}
+	if all["brass"].Name != "Yellow Brass" {
+		t.Errorf("brass after Invalidate = %q, want \"Yellow Brass\" from the database", all["brass"].Name)
+	}
+}
+
+func TestSQLStore_InvalidateAndReload(t *testing.T) {
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "tfccalc.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore error: %v", err)
+	}
+	defer store.Close()
+	if _, err := store.GetAllAlloys(ctx); err != nil {
+		t.Fatalf("GetAllAlloys error: %v", err)
+	}
+
+	// Edit the database behind the store's back.
+	if _, err := store.db.Exec(`UPDATE alloys SET name = 'Yellow Brass' WHERE id = 'brass'`); err != nil {
+		t.Fatalf("renaming brass: %v", err)
+	}
+	if _, err := store.db.Exec(`DELETE FROM alloys WHERE id = 'rose_gold'`); err != nil {
+		t.Fatalf("deleting rose_gold: %v", err)
+	}
+	if a, _ := store.GetAlloyByID(ctx, "brass"); a.Name != "Brass" {
+		t.Errorf("brass = %q before invalidation, want the cached name", a.Name)
 	}
-	unknown := GetAlloyNameByID("does_not_exist")
-	if len(unknown) == 0 || unknown[:7] != "Unknown" {
-		t.Errorf("GetAlloyNameByID(does_not_exist) = %q, want prefix \"Unknown\"", unknown)
+
+	store.Invalidate("brass")
+	if a, _ := store.GetAlloyByID(ctx, "brass"); a.Name != "Yellow Brass" {
+		t.Errorf("brass = %q after Invalidate, want %q", a.Name, "Yellow Brass")
+	}
+	if _, err := store.GetAlloyByID(ctx, "rose_gold"); err != nil {
+		t.Errorf("rose_gold dropped before Reload: %v", err)
+	}
+
+	if err := store.Reload(ctx); err != nil {
+		t.Fatalf("Reload error: %v", err)
+	}
+	if _, err := store.GetAlloyByID(ctx, "rose_gold"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetAlloyByID(rose_gold) after Reload error = %v, want ErrNotFound", err)
+	}
+	all, _ := store.GetAllAlloys(ctx)
+	if len(all) != len(DefaultAlloys())-1 {
+		t.Errorf("GetAllAlloys after Reload has %d entries, want %d", len(all), len(DefaultAlloys())-1)
+	}
+}
+
+func TestSQLStore_CacheTTL(t *testing.T) {
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "tfccalc.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore error: %v", err)
+	}
+	defer store.Close()
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	store.SetCacheTTL(time.Minute)
+
+	if _, err := store.GetAlloyByID(ctx, "brass"); err != nil {
+		t.Fatalf("GetAlloyByID(brass) error: %v", err)
+	}
+	if _, err := store.db.Exec(`UPDATE alloys SET name = 'Yellow Brass' WHERE id = 'brass'`); err != nil {
+		t.Fatalf("renaming brass: %v", err)
+	}
+
+	now = now.Add(59 * time.Second)
+	if a, _ := store.GetAlloyByID(ctx, "brass"); a.Name != "Brass" {
+		t.Errorf("brass = %q before the TTL ran out, want the cached name", a.Name)
+	}
+	now = now.Add(time.Second)
+	if a, _ := store.GetAlloyByID(ctx, "brass"); a.Name != "Yellow Brass" {
+		t.Errorf("brass = %q after the TTL ran out, want %q", a.Name, "Yellow Brass")
+	}
+}
+
+// The batched loader must return exactly what per-alloy queries return, ingredient
+// order included (the first ingredient absorbs rounding in default percentages).
+func TestSQLStore_BatchedLoadMatchesPerAlloy(t *testing.T) {
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "tfccalc.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore error: %v", err)
+	}
+	defer store.Close()
+	want, err := loadCatalogPerAlloy(ctx, store)
+	if err != nil {
+		t.Fatalf("loadCatalogPerAlloy error: %v", err)
+	}
+	got, err := store.GetAllAlloys(ctx)
+	if err != nil {
+		t.Fatalf("GetAllAlloys error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("batched catalog differs from per-alloy queries:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+// newBenchmarkStore returns a SQLite store holding the stock catalog plus n extra
+// alloys of three ingredients each, the size of a big modpack.
+func newBenchmarkStore(b *testing.B, n int) *SQLStore {
+	b.Helper()
+	store, err := NewSQLiteStore(filepath.Join(b.TempDir(), "tfccalc.db"))
+	if err != nil {
+		b.Fatalf("NewSQLiteStore error: %v", err)
+	}
+	b.Cleanup(func() { store.Close() })
+	tx, err := store.db.Begin()
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("modpack_alloy_%d", i)
+		if _, err := tx.Exec(`INSERT INTO alloys (id, name, type) VALUES (?, ?, 'alloy')`, id, id); err != nil {
+			b.Fatal(err)
+		}
+		for pos, ing := range []IngredientInfo{{"copper", 50, 70}, {"bismuth", 20, 30}, {"zinc", 10, 20}} {
+			if _, err := tx.Exec(`INSERT INTO ingredients (alloy_id, ingredient_id, min_pct, max_pct, sort_order) VALUES (?, ?, ?, ?, ?)`,
+				id, ing.IngredientID, ing.Min, ing.Max, pos); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		b.Fatal(err)
+	}
+	return store
+}
+
+// loadCatalogPerAlloy is the loader SQLStore used before batched loading: one query
+// for the alloys, then one ingredient query per alloy while the outer rows are open.
+func loadCatalogPerAlloy(ctx context.Context, s *SQLStore) (map[string]AlloyInfo, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, name, type, raw_form_id, extra_ingredient_id FROM alloys`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := make(map[string]AlloyInfo)
+	for rows.Next() {
+		var a AlloyInfo
+		if err := rows.Scan(&a.ID, &a.Name, &a.Type, &a.RawFormID, &a.ExtraIngredientID); err != nil {
+			return nil, err
+		}
+		if a.Ingredients, err = s.queryIngredients(ctx, a.ID); err != nil {
+			return nil, err
+		}
+		result[a.ID] = a
+	}
+	return result, rows.Err()
+}
+
+func BenchmarkLoadCatalog_Batched(b *testing.B) {
+	store := newBenchmarkStore(b, 500)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := store.loadCatalog(ctx); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLoadCatalog_PerAlloy(b *testing.B) {
+	store := newBenchmarkStore(b, 500)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := loadCatalogPerAlloy(ctx, store); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestMySQLDSN_AddsOptions(t *testing.T) {
+	cases := map[string]string{
+		"u:p@tcp(127.0.0.1:3405)/tfccalc_db": "u:p@tcp(127.0.0.1:3405)/tfccalc_db?charset=utf8mb4&parseTime=true",
+		// A DSN that already has parameters must not get a second "?".
+		"u:p@tcp(db:3306)/tfccalc_db?timeout=5s":     "u:p@tcp(db:3306)/tfccalc_db?charset=utf8mb4&parseTime=true&timeout=5s",
+		"u:p@tcp(db:3306)/tfccalc_db?charset=latin1": "u:p@tcp(db:3306)/tfccalc_db?charset=latin1&parseTime=true",
+	}
+	for in, want := range cases {
+		got, err := mysqlDSN(in)
+		if err != nil {
+			t.Errorf("mysqlDSN(%q) error: %v", in, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("mysqlDSN(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if _, err := mysqlDSN("not a dsn"); err == nil {
+		t.Errorf("mysqlDSN(invalid) returned no error")
+	}
+}
+
+func TestSQLiteStore_MigratesNewDatabase(t *testing.T) {
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "tfccalc.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore error: %v", err)
+	}
+	defer store.Close()
+	v, err := store.SchemaVersion(ctx)
+	if err != nil || v != store.LatestSchemaVersion() || v < baselineVersion {
+		t.Errorf("SchemaVersion = (%d, %v), want %d", v, err, store.LatestSchemaVersion())
+	}
+}
+
+// A database created before migrations existed must be adopted as is, keeping
+// the user's alloys and not seeding the stock catalog a second time.
+func TestSQLiteStore_AdoptsLegacyDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tfccalc.db")
+	db, err := sql.Open("sqlite3", "file:"+path+"?_foreign_keys=on")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := loadMigrations(migrationFiles, "migrations/sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mig := range list[:baselineVersion] {
+		if _, err := db.Exec(mig.up); err != nil {
+			t.Fatalf("creating legacy schema: %v", err)
+		}
+	}
+	if _, err := db.Exec(`INSERT INTO alloys (id, name, type) VALUES ('mithril', 'Mithril', 'base')`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore(legacy file) error: %v", err)
+	}
+	defer store.Close()
+	if _, err := store.GetAlloyByID(ctx, "mithril"); err != nil {
+		t.Errorf("custom alloy lost when adopting a legacy database: %v", err)
+	}
+	if v, _ := store.SchemaVersion(ctx); v != store.LatestSchemaVersion() {
+		t.Errorf("SchemaVersion = %d, want %d", v, store.LatestSchemaVersion())
+	}
+}
+
+func TestSQLStore_MigrateDownAndUp(t *testing.T) {
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "tfccalc.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore error: %v", err)
+	}
+	defer store.Close()
+	if _, err := store.GetAllAlloys(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Version 1 has the tables but not the stock catalog. The store itself needs the
+	// latest schema, so the tables are read directly.
+	if err := store.MigrateTo(ctx, 1); err != nil {
+		t.Fatalf("MigrateTo(1) error: %v", err)
+	}
+	var n int
+	if err := store.db.QueryRow(`SELECT COUNT(*) FROM alloys`).Scan(&n); err != nil || n != 0 {
+		t.Errorf("alloys at version 1 = (%d rows, %v), want an empty table", n, err)
+	}
+	if err := store.MigrateTo(ctx, 0); err != nil {
+		t.Fatalf("MigrateTo(0) error: %v", err)
+	}
+	if _, err := store.GetAllAlloys(ctx); err == nil {
+		t.Errorf("GetAllAlloys at version 0 succeeded, want an error for the missing tables")
+	}
+	if err := store.MigrateTo(ctx, store.LatestSchemaVersion()); err != nil {
+		t.Fatalf("MigrateTo(latest) error: %v", err)
+	}
+	if all, err := store.GetAllAlloys(ctx); err != nil || len(all) != len(DefaultAlloys()) {
+		t.Errorf("GetAllAlloys after migrating up = (%d entries, %v), want %d", len(all), err, len(DefaultAlloys()))
+	}
+	if err := store.MigrateTo(ctx, store.LatestSchemaVersion()+1); err == nil {
+		t.Errorf("MigrateTo(unknown version) succeeded")
+	}
+}
+
+// A downgrade stays in place when the store is opened again, until it is undone.
+func TestSQLStore_MigrateDownIsPinned(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tfccalc.db")
+	store, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("NewSQLiteStore error: %v", err)
+	}
+	latest := store.LatestSchemaVersion()
+	if err := store.MigrateTo(ctx, stockCatalogVersion); err != nil {
+		t.Fatalf("MigrateTo(%d) error: %v", stockCatalogVersion, err)
+	}
+	store.Close()
+
+	store, err = NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("reopening a pinned database: %v", err)
+	}
+	defer store.Close()
+	if v, _ := store.SchemaVersion(ctx); v != stockCatalogVersion {
+		t.Errorf("SchemaVersion after reopening = %d, want the pinned %d", v, stockCatalogVersion)
+	}
+	if v, ok := store.PinnedSchemaVersion(); !ok || v != stockCatalogVersion {
+		t.Errorf("PinnedSchemaVersion = (%d, %v), want (%d, true)", v, ok, stockCatalogVersion)
+	}
+	if _, err := store.GetAllAlloys(ctx); !errors.Is(err, ErrSchemaPinned) {
+		t.Errorf("GetAllAlloys on a pinned schema error = %v, want ErrSchemaPinned", err)
+	}
+
+	if err := store.MigrateTo(ctx, latest); err != nil {
+		t.Fatalf("MigrateTo(latest) error: %v", err)
+	}
+	if _, ok := store.PinnedSchemaVersion(); ok {
+		t.Errorf("schema still pinned after MigrateTo(latest)")
+	}
+	if all, err := store.GetAllAlloys(ctx); err != nil || len(all) != len(DefaultAlloys()) {
+		t.Errorf("GetAllAlloys after unpinning = (%d entries, %v), want %d", len(all), err, len(DefaultAlloys()))
+	}
+}
+
+// Migrating below the stock catalog must not take the rows of custom alloys with it.
+func TestSQLStore_MigrateDownKeepsCustomAlloys(t *testing.T) {
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "tfccalc.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore error: %v", err)
+	}
+	defer store.Close()
+	for _, stmt := range []string{
+		`INSERT INTO alloys (id, name, type) VALUES ('mithril', 'Mithril', 'base')`,
+		`INSERT INTO alloys (id, name, type) VALUES ('mithril_bronze', 'Mithril Bronze', 'alloy')`,
+		`INSERT INTO ingredients (alloy_id, ingredient_id, min_pct, max_pct, sort_order) VALUES ('mithril_bronze', 'copper', 60, 80, 0)`,
+		`INSERT INTO ingredients (alloy_id, ingredient_id, min_pct, max_pct, sort_order) VALUES ('mithril_bronze', 'mithril', 20, 40, 1)`,
+	} {
+		if _, err := store.db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = store.MigrateTo(ctx, 1)
+	if err == nil || !strings.Contains(err.Error(), "mithril, mithril_bronze") {
+		t.Errorf("MigrateTo(1) error = %v, want a refusal naming the custom alloys", err)
+	}
+	if v, _ := store.SchemaVersion(ctx); v != store.LatestSchemaVersion() {
+		t.Errorf("SchemaVersion after the refused migration = %d, want %d", v, store.LatestSchemaVersion())
+	}
+	want := []IngredientInfo{{"copper", 60, 80}, {"mithril", 20, 40}}
+	if got, err := store.GetIngredients(ctx, "mithril_bronze"); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("mithril_bronze ingredients = (%v, %v), want %v", got, err, want)
+	}
+}
+
+// Adding a column through a migration keeps the rows already in the database.
+func TestMigrator_AddColumnKeepsData(t *testing.T) {
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "tfccalc.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStore error: %v", err)
+	}
+	defer store.Close()
+	if _, err := store.db.Exec(`INSERT INTO alloys (id, name, type) VALUES ('mithril', 'Mithril', 'base')`); err != nil {
+		t.Fatal(err)
+	}
+
+	next := store.LatestSchemaVersion() + 1
+	added := fmt.Sprintf("m/%04d_add_melting_point", next)
+	fsys := fstest.MapFS{
+		added + ".up.sql":   {Data: []byte("ALTER TABLE alloys ADD COLUMN melting_point REAL NULL;\n")},
+		added + ".down.sql": {Data: []byte("ALTER TABLE alloys DROP COLUMN melting_point;\n")},
+	}
+	for _, mig := range store.migrator.migrations {
+		name := fmt.Sprintf("m/%04d_%s", mig.version, mig.name)
+		fsys[name+".up.sql"] = &fstest.MapFile{Data: []byte(mig.up)}
+		fsys[name+".down.sql"] = &fstest.MapFile{Data: []byte(mig.down)}
+	}
+	list, err := loadMigrations(fsys, "m")
+	if err != nil {
+		t.Fatalf("loadMigrations error: %v", err)
+	}
+	m := &migrator{db: store.db, dialect: dialectSQLite, migrations: list}
+
+	if err := m.migrate(ctx, next); err != nil {
+		t.Fatalf("migrate(%d) error: %v", next, err)
+	}
+	var name string
+	var melting sql.NullFloat64
+	if err := store.db.QueryRow(`SELECT name, melting_point FROM alloys WHERE id = 'mithril'`).Scan(&name, &melting); err != nil {
+		t.Fatalf("reading mithril after adding melting_point: %v", err)
+	}
+	if err := m.migrate(ctx, next-1); err != nil {
+		t.Fatalf("migrate(%d) error: %v", next-1, err)
+	}
+	if _, err := store.db.Exec(`SELECT melting_point FROM alloys`); err == nil {
+		t.Errorf("melting_point still exists after migrating down")
+	}
+	if _, err := store.GetAlloyByID(ctx, "mithril"); err != nil {
+		t.Errorf("mithril lost after migrating up and down: %v", err)
+	}
+}
+
+func TestLoadMigrations_Invalid(t *testing.T) {
+	cases := map[string]fstest.MapFS{
+		"missing down": {"m/0001_a.up.sql": {Data: []byte("SELECT 1;")}},
+		"bad name":     {"m/first.up.sql": {Data: []byte("SELECT 1;")}},
+		"two names": {
+			"m/0001_a.up.sql":   {Data: []byte("SELECT 1;")},
+			"m/0001_b.down.sql": {Data: []byte("SELECT 1;")},
+		},
+	}
+	for name, fsys := range cases {
+		if _, err := loadMigrations(fsys, "m"); err == nil {
+			t.Errorf("%s: loadMigrations returned no error", name)
+		}
+	}
+}
+
+// Both dialects must have the same steps, and the same stock catalog.
+func TestMigrations_DialectsMatch(t *testing.T) {
+	mysqlList, err := loadMigrations(migrationFiles, "migrations/mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqliteList, err := loadMigrations(migrationFiles, "migrations/sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mysqlList) != len(sqliteList) {
+		t.Fatalf("mysql has %d migrations, sqlite has %d", len(mysqlList), len(sqliteList))
+	}
+	for i := range mysqlList {
+		if mysqlList[i].version != sqliteList[i].version || mysqlList[i].name != sqliteList[i].name {
+			t.Errorf("migration %d: mysql %04d_%s, sqlite %04d_%s", i,
+				mysqlList[i].version, mysqlList[i].name, sqliteList[i].version, sqliteList[i].name)
+		}
+	}
+	if mysqlList[1].up != sqliteList[1].up {
+		t.Errorf("the stock catalog seeds of mysql and sqlite differ")
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := "-- comment\nCREATE TABLE a (\n  x INT\n);\n\nINSERT INTO a VALUES\n  (1),\n  (2);\nDROP TABLE a"
+	want := []string{"CREATE TABLE a (\n  x INT\n);", "INSERT INTO a VALUES\n  (1),\n  (2);", "DROP TABLE a"}
+	if got := splitStatements(script); !reflect.DeepEqual(got, want) {
+		t.Errorf("splitStatements = %q, want %q", got, want)
 	}
 }
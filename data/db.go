@@ -2,12 +2,15 @@
 package data
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"log"
+	"strings"
 	"sync"
+	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 )
 
 // AlloyInfo represents a single alloy/material row fetched from the database.
@@ -27,133 +30,321 @@ type IngredientInfo struct {
 	Max          float64
 }
 
-// dbConn holds the global DB connection. Initialized by InitDB().
-var (
-	db             *sql.DB
-	initOnce       sync.Once
-	alloyCache     map[string]*AlloyInfo
-	alloyCacheLock sync.RWMutex
-)
+// SQLStore is a RecipeStore backed by a database/sql connection (MySQL or SQLite).
+// The first lookup reads the whole catalog with one batched query into an immutable
+// snapshot, and every later lookup is served from it. The snapshot is kept until
+// Reload or Invalidate is called, or, if SetCacheTTL was used, until it gets too old.
+type SQLStore struct {
+	db       *sql.DB
+	migrator *migrator
+	// pinned is the version MigrateTo left the schema at, or -1. While it is set the
+	// schema is not migrated on open and lookups fail with ErrSchemaPinned.
+	pinned int
 
-// InitDB opens a connection to MySQL using the provided DSN.
-// Call this once at program start (e.g. in main).
-func InitDB(dsn string) error {
-	var err error
-	initOnce.Do(func() {
-		db, err = sql.Open(
-			"mysql",
-			dsn+"?parseTime=true&charset=utf8mb4&allowNativePasswords=true",
-		)
+	// mu guards the fields below. Loads hold it for writing, so concurrent
+	// lookups on a cold store wait for one query instead of each running their own.
+	mu       sync.RWMutex
+	snapshot *catalogSnapshot
+	// stale holds IDs passed to Invalidate that must be re-read before the
+	// snapshot is used again.
+	stale    map[string]bool
+	cacheTTL time.Duration
+	now      func() time.Time
+}
 
-		if err != nil {
-			log.Printf("Error opening MySQL: %v", err)
-			return
-		}
-		if pingErr := db.Ping(); pingErr != nil {
-			err = fmt.Errorf("cannot ping MySQL: %w", pingErr)
-			return
-		}
-		alloyCache = make(map[string]*AlloyInfo)
-	})
-	return err
+// catalogSnapshot is the whole catalog as read at loadedAt. It is never modified
+// once built; refreshing an entry produces a new snapshot.
+type catalogSnapshot struct {
+	alloys   map[string]AlloyInfo
+	loadedAt time.Time
 }
 
-// dbGetAlloyByID fetches a single AlloyInfo (including its ingredients) from DB by ID.
-// Returns (AlloyInfo, true) if found, or (zero, false) otherwise.
-func dbGetAlloyByID(id string) (AlloyInfo, bool) {
-	// Check cache first
-	alloyCacheLock.RLock()
-	if info, ok := alloyCache[id]; ok {
-		alloyCacheLock.RUnlock()
-		return *info, true
+// newSQLStore migrates the schema of db to the latest version, unless MigrateTo
+// pinned it at another one, and wraps it in an SQLStore with nothing loaded yet. It
+// closes db if that fails.
+func newSQLStore(db *sql.DB, dialect string) (*SQLStore, error) {
+	ctx := context.Background()
+	pinned := -1
+	m, err := newMigrator(db, dialect)
+	if err == nil {
+		pinned, err = m.pin(ctx)
 	}
-	alloyCacheLock.RUnlock()
+	if err == nil && pinned < 0 {
+		err = m.migrate(ctx, m.latest())
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SQLStore{db: db, migrator: m, pinned: pinned, now: time.Now}, nil
+}
 
-	// Not in cache → fetch from DB
-	queryAlloy := `
-		SELECT id, name, type, raw_form_id, extra_ingredient_id
-		FROM alloys
-		WHERE id = ?
-	`
-	row := db.QueryRow(queryAlloy, id)
-	var a AlloyInfo
-	var rawForm sql.NullString
-	var extraIng sql.NullString
-	if err := row.Scan(&a.ID, &a.Name, &a.Type, &rawForm, &extraIng); err != nil {
-		if err == sql.ErrNoRows {
-			return AlloyInfo{}, false
+// NewMySQLStore opens a connection to MySQL using the provided DSN.
+// Call this once at program start (e.g. in main).
+func NewMySQLStore(dsn string) (*SQLStore, error) {
+	full, err := mysqlDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("mysql", full)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open MySQL: %w", err)
+	}
+	if pingErr := db.Ping(); pingErr != nil {
+		db.Close()
+		return nil, fmt.Errorf("cannot ping MySQL: %w", pingErr)
+	}
+	return newSQLStore(db, dialectMySQL)
+}
+
+// mysqlDSN adds the connection options the store relies on (parseTime, utf8mb4,
+// native passwords) to dsn, keeping any parameters it already has.
+func mysqlDSN(dsn string) (string, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return "", fmt.Errorf("invalid MySQL DSN: %w", err)
+	}
+	cfg.ParseTime = true
+	cfg.AllowNativePasswords = true
+	// The parsed charset is not exported; look for it in the formatted DSN.
+	if !strings.Contains(cfg.FormatDSN(), "charset=") {
+		if err := cfg.Apply(mysql.Charset("utf8mb4", "")); err != nil {
+			return "", err
 		}
-		log.Printf("Error querying alloy by ID %s: %v", id, err)
-		return AlloyInfo{}, false
 	}
-	a.RawFormID = rawForm
-	a.ExtraIngredientID = extraIng
+	return cfg.FormatDSN(), nil
+}
+
+// Close releases the underlying DB connection.
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
 
-	// Fetch ingredients
-	a.Ingredients = dbGetIngredientsForAlloy(id)
+// SetCacheTTL makes the store read the catalog again once its snapshot is older
+// than ttl, so changes made to the database by others show up without a restart.
+// A ttl of 0 (the default) keeps the snapshot until Reload or Invalidate.
+func (s *SQLStore) SetCacheTTL(ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cacheTTL = ttl
+}
 
-	// Cache it
-	alloyCacheLock.Lock()
-	alloyCache[id] = &a
-	alloyCacheLock.Unlock()
-	return a, true
+// Invalidate marks id as changed, so the next lookup reads it from the database
+// again. The rest of the snapshot is kept.
+func (s *SQLStore) Invalidate(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stale == nil {
+		s.stale = make(map[string]bool)
+	}
+	s.stale[id] = true
 }
 
-// dbGetAllAlloys returns a map[id] → AlloyInfo for all alloys in the database.
-func dbGetAllAlloys() map[string]AlloyInfo {
-	result := make(map[string]AlloyInfo)
+// Reload drops the snapshot and reads the full catalog again. On error nothing is
+// cached, so later lookups go to the database.
+func (s *SQLStore) Reload(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshot = nil
+	s.stale = nil
+	snap, err := s.loadCatalog(ctx)
+	if err != nil {
+		return err
+	}
+	s.snapshot = snap
+	return nil
+}
 
-	// If cache already populated for *all* IDs, return a copy
-	alloyCacheLock.RLock()
-	if len(alloyCache) > 0 {
-		for k, v := range alloyCache {
-			result[k] = *v
+// catalog returns the current snapshot, loading the catalog or refreshing
+// invalidated entries first if needed.
+func (s *SQLStore) catalog(ctx context.Context) (*catalogSnapshot, error) {
+	s.mu.RLock()
+	snap := s.snapshot
+	usable := snap != nil && len(s.stale) == 0 && !s.expired(snap)
+	s.mu.RUnlock()
+	if usable {
+		return snap, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Another caller may have loaded it while we waited for the lock.
+	if s.snapshot == nil || s.expired(s.snapshot) {
+		snap, err := s.loadCatalog(ctx)
+		if err != nil {
+			s.snapshot = nil
+			return nil, err
+		}
+		s.snapshot = snap
+		s.stale = nil
+	}
+	if len(s.stale) > 0 {
+		snap, err := s.refreshStale(ctx, s.snapshot)
+		if err != nil {
+			return nil, err
 		}
-		alloyCacheLock.RUnlock()
-		return result
+		s.snapshot = snap
+		s.stale = nil
 	}
-	alloyCacheLock.RUnlock()
+	return s.snapshot, nil
+}
 
-	// Otherwise, fetch all rows from `alloys`
-	rows, err := db.Query(`SELECT id, name, type, raw_form_id, extra_ingredient_id FROM alloys`)
+// expired reports whether snap is older than the cache TTL. The caller must hold mu.
+func (s *SQLStore) expired(snap *catalogSnapshot) bool {
+	return s.cacheTTL > 0 && s.now().Sub(snap.loadedAt) >= s.cacheTTL
+}
+
+// loadCatalog reads every alloy and every ingredient row with two queries in one
+// read-only transaction and builds a snapshot from them. The caller must hold mu.
+func (s *SQLStore) loadCatalog(ctx context.Context) (*catalogSnapshot, error) {
+	if s.pinned >= 0 {
+		return nil, fmt.Errorf("database %w at version %d (latest %d); run \"tfccalc migrate -to %d\" to use it with this build",
+			ErrSchemaPinned, s.pinned, s.migrator.latest(), s.migrator.latest())
+	}
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
 	if err != nil {
-		log.Printf("Error querying all alloys: %v", err)
-		return result
+		return nil, fmt.Errorf("querying all alloys: %w", err)
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
+	alloys := make(map[string]AlloyInfo)
+	rows, err := tx.QueryContext(ctx, `SELECT id, name, type, raw_form_id, extra_ingredient_id FROM alloys`)
+	if err != nil {
+		return nil, fmt.Errorf("querying all alloys: %w", err)
+	}
 	for rows.Next() {
 		var a AlloyInfo
-		var rawForm sql.NullString
-		var extraIng sql.NullString
-		if err := rows.Scan(&a.ID, &a.Name, &a.Type, &rawForm, &extraIng); err != nil {
-			log.Printf("Error scanning alloy row: %v", err)
+		if err := rows.Scan(&a.ID, &a.Name, &a.Type, &a.RawFormID, &a.ExtraIngredientID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scanning alloy row: %w", err)
+		}
+		alloys[a.ID] = a
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading alloy rows: %w", err)
+	}
+
+	// In the order the per-alloy query returns them in.
+	rows, err = tx.QueryContext(ctx, `SELECT alloy_id, ingredient_id, min_pct, max_pct FROM ingredients ORDER BY alloy_id, sort_order, ingredient_id`)
+	if err != nil {
+		return nil, fmt.Errorf("querying all ingredients: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var alloyID string
+		var ing IngredientInfo
+		if err := rows.Scan(&alloyID, &ing.IngredientID, &ing.Min, &ing.Max); err != nil {
+			return nil, fmt.Errorf("scanning ingredient row: %w", err)
+		}
+		a, ok := alloys[alloyID]
+		if !ok {
 			continue
 		}
-		a.RawFormID = rawForm
-		a.ExtraIngredientID = extraIng
-		a.Ingredients = dbGetIngredientsForAlloy(a.ID)
+		a.Ingredients = append(a.Ingredients, ing)
+		alloys[alloyID] = a
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading ingredient rows: %w", err)
+	}
+	return &catalogSnapshot{alloys: alloys, loadedAt: s.now()}, nil
+}
 
-		// Populate cache + result
-		alloyCacheLock.Lock()
-		alloyCache[a.ID] = &a
-		alloyCacheLock.Unlock()
-		result[a.ID] = a
+// refreshStale returns a copy of snap with every invalidated ID read again, or
+// removed if it no longer exists. The caller must hold mu.
+func (s *SQLStore) refreshStale(ctx context.Context, snap *catalogSnapshot) (*catalogSnapshot, error) {
+	alloys := make(map[string]AlloyInfo, len(snap.alloys))
+	for id, a := range snap.alloys {
+		alloys[id] = a
+	}
+	for id := range s.stale {
+		a, err := s.queryAlloy(ctx, id)
+		switch {
+		case err == nil:
+			alloys[id] = a
+		case errors.Is(err, ErrNotFound):
+			delete(alloys, id)
+		default:
+			return nil, err
+		}
 	}
-	return result
+	return &catalogSnapshot{alloys: alloys, loadedAt: snap.loadedAt}, nil
 }
 
-// dbGetIngredientsForAlloy returns []IngredientInfo for a given alloy_id.
-func dbGetIngredientsForAlloy(alloyID string) []IngredientInfo {
+// GetAlloyByID returns a single AlloyInfo (including its ingredients) by ID.
+// It returns an error wrapping ErrNotFound if there is no such alloy, or the
+// wrapped driver error if the catalog could not be read.
+func (s *SQLStore) GetAlloyByID(ctx context.Context, id string) (AlloyInfo, error) {
+	snap, err := s.catalog(ctx)
+	if err != nil {
+		return AlloyInfo{}, err
+	}
+	a, ok := snap.alloys[id]
+	if !ok {
+		return AlloyInfo{}, notFound(id)
+	}
+	return copyAlloy(a), nil
+}
+
+// GetAllAlloys returns a map[id] → AlloyInfo for all alloys in the database.
+// Any query or scan error fails the whole call; a partial map is never returned.
+func (s *SQLStore) GetAllAlloys(ctx context.Context) (map[string]AlloyInfo, error) {
+	snap, err := s.catalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]AlloyInfo, len(snap.alloys))
+	for id, a := range snap.alloys {
+		result[id] = copyAlloy(a)
+	}
+	return result, nil
+}
+
+// GetIngredients returns []IngredientInfo for a given alloy_id, or an error wrapping
+// ErrNotFound if the alloy does not exist.
+func (s *SQLStore) GetIngredients(ctx context.Context, alloyID string) ([]IngredientInfo, error) {
+	a, err := s.GetAlloyByID(ctx, alloyID)
+	if err != nil {
+		return nil, err
+	}
+	return a.Ingredients, nil
+}
+
+// queryAlloy reads one alloy and its ingredients straight from the database.
+func (s *SQLStore) queryAlloy(ctx context.Context, id string) (AlloyInfo, error) {
+	queryAlloy := `
+		SELECT id, name, type, raw_form_id, extra_ingredient_id
+		FROM alloys
+		WHERE id = ?
+	`
+	var a AlloyInfo
+	err := s.db.QueryRowContext(ctx, queryAlloy, id).Scan(&a.ID, &a.Name, &a.Type, &a.RawFormID, &a.ExtraIngredientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return AlloyInfo{}, notFound(id)
+		}
+		return AlloyInfo{}, fmt.Errorf("querying alloy %s: %w", id, err)
+	}
+	ings, err := s.queryIngredients(ctx, id)
+	if err != nil {
+		return AlloyInfo{}, err
+	}
+	a.Ingredients = ings
+	return a, nil
+}
+
+// queryIngredients reads the ingredient rows of one alloy in their stored order
+// (migration 0003), which is the order of the alloy's recipe.
+func (s *SQLStore) queryIngredients(ctx context.Context, alloyID string) ([]IngredientInfo, error) {
 	query := `
 		SELECT ingredient_id, min_pct, max_pct
 		FROM ingredients
 		WHERE alloy_id = ?
+		ORDER BY sort_order, ingredient_id
 	`
-	rows, err := db.Query(query, alloyID)
+	rows, err := s.db.QueryContext(ctx, query, alloyID)
 	if err != nil {
-		log.Printf("Error querying ingredients for %s: %v", alloyID, err)
-		return nil
+		return nil, fmt.Errorf("querying ingredients for %s: %w", alloyID, err)
 	}
 	defer rows.Close()
 
@@ -161,10 +352,12 @@ func dbGetIngredientsForAlloy(alloyID string) []IngredientInfo {
 	for rows.Next() {
 		var ing IngredientInfo
 		if err := rows.Scan(&ing.IngredientID, &ing.Min, &ing.Max); err != nil {
-			log.Printf("Error scanning ingredient row for %s: %v", alloyID, err)
-			continue
+			return nil, fmt.Errorf("scanning ingredient row for %s: %w", alloyID, err)
 		}
 		list = append(list, ing)
 	}
-	return list
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading ingredients for %s: %w", alloyID, err)
+	}
+	return list, nil
 }
@@ -0,0 +1,20 @@
+// tfccalc/data/errors.go
+package data
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound is returned (wrapped) by RecipeStore lookups when an ID does not exist.
+// Any other error means the store itself failed, e.g. the database is unreachable.
+var ErrNotFound = errors.New("not found")
+
+// notFound returns an error like "alloy brass not found" that wraps ErrNotFound.
+func notFound(id string) error {
+	return fmt.Errorf("alloy %s %w", id, ErrNotFound)
+}
+
+// ErrSchemaPinned is returned (wrapped) by SQLStore lookups when MigrateTo left the
+// schema at an older version than this build reads. See SQLStore.MigrateTo.
+var ErrSchemaPinned = errors.New("schema pinned")
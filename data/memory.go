@@ -0,0 +1,74 @@
+// tfccalc/data/memory.go
+package data
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryStore is a RecipeStore that keeps every alloy in a plain map.
+// It needs no database, which makes it handy for tests and for embedding
+// the calculator in other tools.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	alloys map[string]AlloyInfo
+}
+
+// NewMemoryStore builds a MemoryStore from the given alloys. Later entries
+// with the same ID replace earlier ones.
+func NewMemoryStore(alloys []AlloyInfo) *MemoryStore {
+	m := &MemoryStore{alloys: make(map[string]AlloyInfo, len(alloys))}
+	for _, a := range alloys {
+		m.alloys[a.ID] = copyAlloy(a)
+	}
+	return m
+}
+
+// Put adds or replaces alloys in the store.
+func (m *MemoryStore) Put(alloys ...AlloyInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, a := range alloys {
+		m.alloys[a.ID] = copyAlloy(a)
+	}
+}
+
+// GetAlloyByID returns the alloy with the given ID, or an error wrapping ErrNotFound.
+func (m *MemoryStore) GetAlloyByID(ctx context.Context, id string) (AlloyInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	a, ok := m.alloys[id]
+	if !ok {
+		return AlloyInfo{}, notFound(id)
+	}
+	return copyAlloy(a), nil
+}
+
+// GetAllAlloys returns a map[id]→AlloyInfo for all alloys in the store. It never fails.
+func (m *MemoryStore) GetAllAlloys(ctx context.Context) (map[string]AlloyInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	result := make(map[string]AlloyInfo, len(m.alloys))
+	for id, a := range m.alloys {
+		result[id] = copyAlloy(a)
+	}
+	return result, nil
+}
+
+// GetIngredients returns []IngredientInfo for a given alloy ID, or an error wrapping ErrNotFound.
+func (m *MemoryStore) GetIngredients(ctx context.Context, alloyID string) ([]IngredientInfo, error) {
+	a, err := m.GetAlloyByID(ctx, alloyID)
+	if err != nil {
+		return nil, err
+	}
+	return a.Ingredients, nil
+}
+
+// copyAlloy returns a with its own Ingredients slice, so callers cannot
+// mutate the store through a returned value.
+func copyAlloy(a AlloyInfo) AlloyInfo {
+	if a.Ingredients != nil {
+		a.Ingredients = append([]IngredientInfo(nil), a.Ingredients...)
+	}
+	return a
+}
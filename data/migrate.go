@@ -0,0 +1,402 @@
+// tfccalc/data/migrate.go
+package data
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// migrationFiles holds one directory of migrations per SQL dialect. Each migration
+// is a pair NNNN_name.up.sql / NNNN_name.down.sql; they are applied in version order.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// SQL dialects understood by the migrator; also the directory names under migrations/.
+const (
+	dialectMySQL  = "mysql"
+	dialectSQLite = "sqlite"
+)
+
+// baselineVersion is the schema of databases created before migrations existed:
+// the tables and the stock catalog (db/schema.sql, or the seeded SQLite file).
+const baselineVersion = 2
+
+// stockCatalogVersion is the migration that seeds the stock catalog. Its down script
+// deletes the stock metals, and with them, through ON DELETE CASCADE, the ingredient
+// rows of every alloy that uses one, so migrate refuses to go below it while the
+// database holds alloys of its own.
+const stockCatalogVersion = 2
+
+// migration is one schema step.
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// migrationName matches "0003_add_melting_point.up.sql".
+var migrationName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// loadMigrations reads the migrations in dir of fsys, sorted by version. Every
+// version needs both an up and a down script.
+func loadMigrations(fsys fs.FS, dir string) ([]migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read migrations: %w", err)
+	}
+	byVersion := make(map[int]*migration)
+	for _, e := range entries {
+		m := migrationName.FindStringSubmatch(e.Name())
+		if e.IsDir() || m == nil {
+			return nil, fmt.Errorf("unexpected file %s in migrations", path.Join(dir, e.Name()))
+		}
+		version, _ := strconv.Atoi(m[1])
+		raw, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("cannot read migration %s: %w", e.Name(), err)
+		}
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &migration{version: version, name: m[2]}
+			byVersion[version] = mig
+		}
+		if mig.name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, mig.name, m[2])
+		}
+		if m[3] == "up" {
+			mig.up = string(raw)
+		} else {
+			mig.down = string(raw)
+		}
+	}
+
+	list := make([]migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.up == "" || mig.down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down script", mig.version, mig.name)
+		}
+		list = append(list, *mig)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].version < list[j].version })
+	return list, nil
+}
+
+// migrator applies migrations to one database.
+type migrator struct {
+	db         *sql.DB
+	dialect    string
+	migrations []migration
+}
+
+// newMigrator returns a migrator with the embedded migrations of dialect.
+func newMigrator(db *sql.DB, dialect string) (*migrator, error) {
+	list, err := loadMigrations(migrationFiles, "migrations/"+dialect)
+	if err != nil {
+		return nil, err
+	}
+	return &migrator{db: db, dialect: dialect, migrations: list}, nil
+}
+
+// latest returns the highest known version, or 0 if there are no migrations.
+func (m *migrator) latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].version
+}
+
+// migrate brings the schema to version target, running up scripts in order or down
+// scripts in reverse order. Each step runs in its own transaction together with its
+// schema_migrations row (MySQL commits DDL implicitly, so there a failed step may be
+// half applied).
+func (m *migrator) migrate(ctx context.Context, target int) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot migrate schema: %w", err)
+	}
+	defer conn.Close()
+
+	// Keep two app instances from migrating the same MySQL database at once.
+	if m.dialect == dialectMySQL {
+		var got sql.NullInt64
+		if err := conn.QueryRowContext(ctx, `SELECT GET_LOCK('tfccalc_schema_migrations', 30)`).Scan(&got); err != nil || got.Int64 != 1 {
+			return fmt.Errorf("cannot lock schema for migration (%v)", err)
+		}
+		defer conn.ExecContext(context.Background(), `SELECT RELEASE_LOCK('tfccalc_schema_migrations')`)
+	}
+
+	applied, err := m.appliedVersions(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if target < stockCatalogVersion && applied[stockCatalogVersion] {
+		if err := m.checkOnlyStockAlloys(ctx, conn); err != nil {
+			return err
+		}
+	}
+	for _, mig := range m.migrations {
+		if mig.version <= target && !applied[mig.version] {
+			if err := m.step(ctx, conn, mig, true); err != nil {
+				return err
+			}
+		}
+	}
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		mig := m.migrations[i]
+		if mig.version > target && applied[mig.version] {
+			if err := m.step(ctx, conn, mig, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// appliedVersions creates schema_migrations if needed and returns the versions it
+// lists. A database that has the alloys table but no schema_migrations predates
+// migrations and is recorded as being at baselineVersion.
+func (m *migrator) appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]bool, error) {
+	hadTable, err := m.tableExists(ctx, conn, "schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	if !hadTable {
+		_, err := conn.ExecContext(ctx, `
+			CREATE TABLE schema_migrations (
+			  version INTEGER PRIMARY KEY,
+			  name VARCHAR(255) NOT NULL,
+			  applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+			)`)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create schema_migrations: %w", err)
+		}
+		legacy, err := m.tableExists(ctx, conn, "alloys")
+		if err != nil {
+			return nil, err
+		}
+		if legacy {
+			for _, mig := range m.migrations {
+				if mig.version > baselineVersion {
+					break
+				}
+				if _, err := conn.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, mig.version, mig.name); err != nil {
+					return nil, fmt.Errorf("cannot record baseline schema: %w", err)
+				}
+			}
+		}
+	}
+
+	rows, err := conn.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			return nil, fmt.Errorf("cannot read schema_migrations: %w", err)
+		}
+		applied[v] = true
+	}
+	return applied, rows.Err()
+}
+
+// checkOnlyStockAlloys returns an error naming the alloys that are not part of the
+// stock catalog, if there are any.
+func (m *migrator) checkOnlyStockAlloys(ctx context.Context, conn *sql.Conn) error {
+	stock := make(map[string]bool)
+	for _, a := range DefaultAlloys() {
+		stock[a.ID] = true
+	}
+	rows, err := conn.QueryContext(ctx, `SELECT id FROM alloys ORDER BY id`)
+	if err != nil {
+		return fmt.Errorf("cannot read alloys: %w", err)
+	}
+	defer rows.Close()
+	var custom []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return fmt.Errorf("cannot read alloys: %w", err)
+		}
+		if !stock[id] {
+			custom = append(custom, id)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("cannot read alloys: %w", err)
+	}
+	if len(custom) > 0 {
+		return fmt.Errorf("cannot migrate below version %d: removing the stock catalog would delete the ingredients of alloys not in it (%s); delete those first",
+			stockCatalogVersion, strings.Join(custom, ", "))
+	}
+	return nil
+}
+
+// pin returns the version recorded by setPin, or -1 if the schema is not pinned.
+func (m *migrator) pin(ctx context.Context) (int, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("cannot read schema pin: %w", err)
+	}
+	defer conn.Close()
+	exists, err := m.tableExists(ctx, conn, "schema_pin")
+	if err != nil || !exists {
+		return -1, err
+	}
+	var v sql.NullInt64
+	if err := conn.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_pin`).Scan(&v); err != nil {
+		return 0, fmt.Errorf("cannot read schema pin: %w", err)
+	}
+	if !v.Valid {
+		return -1, nil
+	}
+	return int(v.Int64), nil
+}
+
+// setPin records version in schema_pin so that opening the store does not migrate
+// past it, or clears the pin if version is negative.
+func (m *migrator) setPin(ctx context.Context, version int) error {
+	if _, err := m.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_pin (version INTEGER NOT NULL)`); err != nil {
+		return fmt.Errorf("cannot record schema pin: %w", err)
+	}
+	if _, err := m.db.ExecContext(ctx, `DELETE FROM schema_pin`); err != nil {
+		return fmt.Errorf("cannot record schema pin: %w", err)
+	}
+	if version < 0 {
+		return nil
+	}
+	if _, err := m.db.ExecContext(ctx, `INSERT INTO schema_pin (version) VALUES (?)`, version); err != nil {
+		return fmt.Errorf("cannot record schema pin: %w", err)
+	}
+	return nil
+}
+
+// tableExists reports whether the current database has a table called name.
+func (m *migrator) tableExists(ctx context.Context, conn *sql.Conn, name string) (bool, error) {
+	query := `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`
+	if m.dialect == dialectMySQL {
+		query = `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?`
+	}
+	var n int
+	if err := conn.QueryRowContext(ctx, query, name).Scan(&n); err != nil {
+		return false, fmt.Errorf("cannot inspect schema: %w", err)
+	}
+	return n > 0, nil
+}
+
+// step runs the up or down script of mig and records the result.
+func (m *migrator) step(ctx context.Context, conn *sql.Conn, mig migration, up bool) error {
+	script, record, dir := mig.up, `INSERT INTO schema_migrations (version, name) VALUES (?, ?)`, "up"
+	args := []any{mig.version, mig.name}
+	if !up {
+		script, record, dir = mig.down, `DELETE FROM schema_migrations WHERE version = ?`, "down"
+		args = args[:1]
+	}
+	fail := func(err error) error {
+		return fmt.Errorf("migration %04d_%s (%s) failed: %w", mig.version, mig.name, dir, err)
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fail(err)
+	}
+	defer tx.Rollback()
+	for _, stmt := range splitStatements(script) {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fail(err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return fail(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fail(err)
+	}
+	return nil
+}
+
+// splitStatements splits a script into statements at semicolons that end a line,
+// dropping "--" comment lines. The MySQL driver runs one statement per Exec.
+func splitStatements(script string) []string {
+	var stmts []string
+	var cur strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		cur.WriteString(line)
+		cur.WriteByte('\n')
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, strings.TrimSpace(cur.String()))
+			cur.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(cur.String()); rest != "" {
+		stmts = append(stmts, rest)
+	}
+	return stmts
+}
+
+// SchemaVersion returns the highest migration applied to the database.
+func (s *SQLStore) SchemaVersion(ctx context.Context) (int, error) {
+	var v sql.NullInt64
+	if err := s.db.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_migrations`).Scan(&v); err != nil {
+		return 0, fmt.Errorf("cannot read schema version: %w", err)
+	}
+	return int(v.Int64), nil
+}
+
+// LatestSchemaVersion returns the version the store migrates to when it is opened.
+func (s *SQLStore) LatestSchemaVersion() int {
+	return s.migrator.latest()
+}
+
+// MigrateTo moves the schema up or down to version and drops the cached catalog.
+// Opening a store already migrates it to LatestSchemaVersion; going down is only
+// needed to undo a release. Version 0 removes every table.
+//
+// A version below the latest is pinned: later opens leave the schema alone, for an
+// older build to use, and lookups fail with ErrSchemaPinned until MigrateTo is
+// called with LatestSchemaVersion.
+func (s *SQLStore) MigrateTo(ctx context.Context, version int) error {
+	if version < 0 || version > s.migrator.latest() {
+		return fmt.Errorf("unknown schema version %d (latest is %d)", version, s.migrator.latest())
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshot = nil
+	s.stale = nil
+	if err := s.migrator.migrate(ctx, version); err != nil {
+		return err
+	}
+	pinned := version
+	if version == s.migrator.latest() {
+		pinned = -1
+	}
+	if err := s.migrator.setPin(ctx, pinned); err != nil {
+		return err
+	}
+	s.pinned = pinned
+	return nil
+}
+
+// PinnedSchemaVersion returns the version MigrateTo pinned the schema at, and
+// whether it is pinned at all.
+func (s *SQLStore) PinnedSchemaVersion() (int, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.pinned, s.pinned >= 0
+}
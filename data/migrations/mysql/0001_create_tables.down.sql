@@ -0,0 +1,4 @@
+-- Drops the alloys and ingredients tables with everything in them.
+
+DROP TABLE ingredients;
+DROP TABLE alloys;
@@ -0,0 +1,21 @@
+-- Creates the alloys and ingredients tables.
+
+CREATE TABLE alloys (
+  id VARCHAR(64) PRIMARY KEY,
+  name VARCHAR(128) NOT NULL,
+  type ENUM('base','alloy','processed','raw_steel','final_steel') NOT NULL,
+  raw_form_id VARCHAR(64) NULL,
+  extra_ingredient_id VARCHAR(64) NULL,
+  FOREIGN KEY (raw_form_id) REFERENCES alloys(id) ON DELETE SET NULL,
+  FOREIGN KEY (extra_ingredient_id) REFERENCES alloys(id) ON DELETE SET NULL
+);
+
+CREATE TABLE ingredients (
+  alloy_id VARCHAR(64) NOT NULL,
+  ingredient_id VARCHAR(64) NOT NULL,
+  min_pct FLOAT NOT NULL,
+  max_pct FLOAT NOT NULL,
+  PRIMARY KEY (alloy_id, ingredient_id),
+  FOREIGN KEY (alloy_id) REFERENCES alloys(id) ON DELETE CASCADE,
+  FOREIGN KEY (ingredient_id) REFERENCES alloys(id) ON DELETE CASCADE
+);
@@ -0,0 +1,13 @@
+-- Removes the stock TFC catalog. The migrator refuses to run this while other alloys
+-- exist: deleting a stock metal cascades to the ingredient rows that use it.
+
+DELETE FROM ingredients WHERE alloy_id IN (
+  'bismuth_bronze', 'black_bronze', 'brass', 'rose_gold', 'sterling_silver',
+  'steel', 'raw_black_steel', 'raw_blue_steel', 'raw_red_steel'
+);
+DELETE FROM alloys WHERE id IN (
+  'black_steel', 'blue_steel', 'red_steel',
+  'raw_black_steel', 'raw_blue_steel', 'raw_red_steel', 'steel',
+  'bismuth_bronze', 'black_bronze', 'brass', 'rose_gold', 'sterling_silver',
+  'copper', 'zinc', 'bismuth', 'silver', 'gold', 'nickel', 'pig_iron'
+);
@@ -1,25 +1,4 @@
-DROP TABLE IF EXISTS ingredients;
-DROP TABLE IF EXISTS alloys;
-
-CREATE TABLE alloys (
-  id VARCHAR(64) PRIMARY KEY,
-  name VARCHAR(128) NOT NULL,
-  type ENUM('base','alloy','processed','raw_steel','final_steel') NOT NULL,
-  raw_form_id VARCHAR(64) NULL,
-  extra_ingredient_id VARCHAR(64) NULL,
-  FOREIGN KEY (raw_form_id) REFERENCES alloys(id) ON DELETE SET NULL,
-  FOREIGN KEY (extra_ingredient_id) REFERENCES alloys(id) ON DELETE SET NULL
-);
-
-CREATE TABLE ingredients (
-  alloy_id VARCHAR(64) NOT NULL,
-  ingredient_id VARCHAR(64) NOT NULL,
-  min_pct FLOAT NOT NULL,
-  max_pct FLOAT NOT NULL,
-  PRIMARY KEY (alloy_id, ingredient_id),
-  FOREIGN KEY (alloy_id) REFERENCES alloys(id) ON DELETE CASCADE,
-  FOREIGN KEY (ingredient_id) REFERENCES alloys(id) ON DELETE CASCADE
-);
+-- Seeds the stock TFC catalog. Keep in sync with DefaultAlloys in data/catalog.go.
 
 -- 1) Insert ALL rows into `alloys` (including final_steel) before any `ingredients`.
 
@@ -91,4 +70,4 @@ INSERT INTO ingredients (alloy_id, ingredient_id, min_pct, max_pct) VALUES
   ('raw_red_steel', 'black_steel', 50, 55),
   ('raw_red_steel', 'steel', 20, 25),
   ('raw_red_steel', 'brass', 10, 15),
-  ('raw_red_steel', 'rose_gold', 10, 15);
\ No newline at end of file
+  ('raw_red_steel', 'rose_gold', 10, 15);
@@ -0,0 +1,3 @@
+-- Drops the ingredient positions; ingredients are then listed by ID.
+
+ALTER TABLE ingredients DROP COLUMN sort_order;
@@ -0,0 +1,24 @@
+-- Stores the position of each ingredient within its alloy, so every store lists
+-- ingredients in the order they were written (the first one absorbs rounding in
+-- default percentages). InnoDB keeps no insertion order, so the stock catalog is
+-- numbered as in 0002; other rows keep position 0 and are listed by ID.
+
+ALTER TABLE ingredients ADD COLUMN sort_order INT NOT NULL DEFAULT 0;
+
+UPDATE ingredients SET sort_order = CASE
+  WHEN alloy_id = 'bismuth_bronze' AND ingredient_id = 'bismuth' THEN 1
+  WHEN alloy_id = 'black_bronze' AND ingredient_id = 'zinc' THEN 1
+  WHEN alloy_id = 'black_bronze' AND ingredient_id = 'nickel' THEN 2
+  WHEN alloy_id = 'brass' AND ingredient_id = 'zinc' THEN 1
+  WHEN alloy_id = 'rose_gold' AND ingredient_id = 'silver' THEN 1
+  WHEN alloy_id = 'sterling_silver' AND ingredient_id = 'copper' THEN 1
+  WHEN alloy_id = 'raw_black_steel' AND ingredient_id = 'nickel' THEN 1
+  WHEN alloy_id = 'raw_black_steel' AND ingredient_id = 'black_bronze' THEN 2
+  WHEN alloy_id = 'raw_blue_steel' AND ingredient_id = 'steel' THEN 1
+  WHEN alloy_id = 'raw_blue_steel' AND ingredient_id = 'bismuth_bronze' THEN 2
+  WHEN alloy_id = 'raw_blue_steel' AND ingredient_id = 'sterling_silver' THEN 3
+  WHEN alloy_id = 'raw_red_steel' AND ingredient_id = 'steel' THEN 1
+  WHEN alloy_id = 'raw_red_steel' AND ingredient_id = 'brass' THEN 2
+  WHEN alloy_id = 'raw_red_steel' AND ingredient_id = 'rose_gold' THEN 3
+  ELSE sort_order
+END;
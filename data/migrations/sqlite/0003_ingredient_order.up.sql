@@ -0,0 +1,10 @@
+-- Stores the position of each ingredient within its alloy, so every store lists
+-- ingredients in the order they were written (the first one absorbs rounding in
+-- default percentages). Existing rows are numbered in insertion order.
+
+ALTER TABLE ingredients ADD COLUMN sort_order INTEGER NOT NULL DEFAULT 0;
+
+UPDATE ingredients SET sort_order = (
+  SELECT COUNT(*) FROM ingredients AS prev
+  WHERE prev.alloy_id = ingredients.alloy_id AND prev.rowid < ingredients.rowid
+);
@@ -0,0 +1,222 @@
+// tfccalc/data/recipefile.go
+package data
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Recipe files describe a whole alloy catalog in JSON or YAML. The schema is:
+//
+//	alloys:                              # list of every material, base metals included
+//	  - id: brass                        # unique ID, referenced by other entries
+//	    name: Brass                      # display name
+//	    type: alloy                      # base | alloy | processed | raw_steel | final_steel
+//	    ingredients:                     # alloy, processed and raw_steel only
+//	      - id: copper                   # ID of another entry
+//	        min: 88                      # minimum percentage (0–100)
+//	        max: 92                      # maximum percentage (0–100)
+//	      - id: zinc
+//	        min: 8
+//	        max: 12
+//	  - id: black_steel
+//	    name: Black Steel
+//	    type: final_steel
+//	    raw_form_id: raw_black_steel     # final_steel only
+//	    extra_ingredient_id: pig_iron    # final_steel only
+//
+// JSON files use the same field names. db/alloys.yaml contains the stock catalog.
+
+// recipeFile is the on-disk layout of a recipe file.
+type recipeFile struct {
+	Alloys []recipeFileAlloy `json:"alloys" yaml:"alloys"`
+}
+
+// recipeFileAlloy is one entry of recipeFile.Alloys.
+type recipeFileAlloy struct {
+	ID                string                 `json:"id" yaml:"id"`
+	Name              string                 `json:"name" yaml:"name"`
+	Type              string                 `json:"type" yaml:"type"`
+	RawFormID         string                 `json:"raw_form_id,omitempty" yaml:"raw_form_id,omitempty"`
+	ExtraIngredientID string                 `json:"extra_ingredient_id,omitempty" yaml:"extra_ingredient_id,omitempty"`
+	Ingredients       []recipeFileIngredient `json:"ingredients,omitempty" yaml:"ingredients,omitempty"`
+}
+
+// recipeFileIngredient is one ingredient range of a recipeFileAlloy.
+type recipeFileIngredient struct {
+	ID  string  `json:"id" yaml:"id"`
+	Min float64 `json:"min" yaml:"min"`
+	Max float64 `json:"max" yaml:"max"`
+}
+
+// NewFileStore loads a recipe file (see LoadRecipeFile) into a MemoryStore.
+func NewFileStore(path string) (*MemoryStore, error) {
+	alloys, err := LoadRecipeFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewMemoryStore(alloys), nil
+}
+
+// LoadRecipeFile reads a JSON (.json) or YAML (.yaml, .yml) recipe file and
+// returns its alloys after validating them with ValidateCatalog.
+func LoadRecipeFile(path string) ([]AlloyInfo, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read recipe file: %w", err)
+	}
+	var format string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		format = "json"
+	case ".yaml", ".yml":
+		format = "yaml"
+	default:
+		return nil, fmt.Errorf("recipe file %s: unknown extension (want .json, .yaml or .yml)", path)
+	}
+	alloys, err := ParseRecipes(raw, format)
+	if err != nil {
+		return nil, fmt.Errorf("recipe file %s: %w", path, err)
+	}
+	return alloys, nil
+}
+
+// ParseRecipes decodes a recipe document in the given format ("json" or "yaml")
+// and validates it with ValidateCatalog.
+func ParseRecipes(raw []byte, format string) ([]AlloyInfo, error) {
+	var file recipeFile
+	switch format {
+	case "json":
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&file); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+	case "yaml":
+		dec := yaml.NewDecoder(bytes.NewReader(raw))
+		dec.KnownFields(true)
+		if err := dec.Decode(&file); err != nil {
+			return nil, fmt.Errorf("invalid YAML: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown recipe format %q", format)
+	}
+
+	alloys := make([]AlloyInfo, 0, len(file.Alloys))
+	for _, fa := range file.Alloys {
+		a := AlloyInfo{
+			ID:                fa.ID,
+			Name:              fa.Name,
+			Type:              fa.Type,
+			RawFormID:         nullString(fa.RawFormID),
+			ExtraIngredientID: nullString(fa.ExtraIngredientID),
+		}
+		for _, fi := range fa.Ingredients {
+			a.Ingredients = append(a.Ingredients, IngredientInfo{IngredientID: fi.ID, Min: fi.Min, Max: fi.Max})
+		}
+		alloys = append(alloys, a)
+	}
+	if err := ValidateCatalog(alloys); err != nil {
+		return nil, err
+	}
+	return alloys, nil
+}
+
+// MarshalRecipes encodes alloys as a recipe document in the given format ("json"
+// or "yaml") that ParseRecipes reads back unchanged. Entries keep their order.
+func MarshalRecipes(alloys []AlloyInfo, format string) ([]byte, error) {
+	file := recipeFile{Alloys: make([]recipeFileAlloy, 0, len(alloys))}
+	for _, a := range alloys {
+		fa := recipeFileAlloy{
+			ID:                a.ID,
+			Name:              a.Name,
+			Type:              a.Type,
+			RawFormID:         a.RawFormID.String,
+			ExtraIngredientID: a.ExtraIngredientID.String,
+		}
+		for _, ing := range a.Ingredients {
+			fa.Ingredients = append(fa.Ingredients, recipeFileIngredient{ID: ing.IngredientID, Min: ing.Min, Max: ing.Max})
+		}
+		file.Alloys = append(file.Alloys, fa)
+	}
+	switch format {
+	case "json":
+		return json.MarshalIndent(file, "", "  ")
+	case "yaml":
+		return yaml.Marshal(file)
+	default:
+		return nil, fmt.Errorf("unknown recipe format %q", format)
+	}
+}
+
+// ValidateCatalog checks that a list of alloys forms a usable catalog:
+// unique IDs, known types, existing references and sane min/max ranges.
+func ValidateCatalog(alloys []AlloyInfo) error {
+	ids := make(map[string]bool, len(alloys))
+	for _, a := range alloys {
+		if a.ID == "" {
+			return fmt.Errorf("alloy %q has no id", a.Name)
+		}
+		if ids[a.ID] {
+			return fmt.Errorf("duplicate alloy id %q", a.ID)
+		}
+		ids[a.ID] = true
+	}
+
+	for _, a := range alloys {
+		switch a.Type {
+		case "base":
+			if len(a.Ingredients) > 0 {
+				return fmt.Errorf("base material %s must not have ingredients", a.ID)
+			}
+		case "alloy", "processed", "raw_steel":
+			if len(a.Ingredients) == 0 {
+				return fmt.Errorf("%s %s has no ingredients", a.Type, a.ID)
+			}
+		case "final_steel":
+			if !a.RawFormID.Valid || !a.ExtraIngredientID.Valid {
+				return fmt.Errorf("final_steel %s needs raw_form_id and extra_ingredient_id", a.ID)
+			}
+		default:
+			return fmt.Errorf("alloy %s has unknown type %q", a.ID, a.Type)
+		}
+		for _, ref := range []sql.NullString{a.RawFormID, a.ExtraIngredientID} {
+			if ref.Valid && !ids[ref.String] {
+				return fmt.Errorf("alloy %s references unknown id %q", a.ID, ref.String)
+			}
+		}
+
+		seen := make(map[string]bool)
+		minSum, maxSum := 0.0, 0.0
+		for _, ing := range a.Ingredients {
+			if !ids[ing.IngredientID] {
+				return fmt.Errorf("alloy %s references unknown ingredient %q", a.ID, ing.IngredientID)
+			}
+			if seen[ing.IngredientID] {
+				return fmt.Errorf("alloy %s lists ingredient %s twice", a.ID, ing.IngredientID)
+			}
+			seen[ing.IngredientID] = true
+			if ing.Min < 0 || ing.Max > 100 || ing.Min > ing.Max {
+				return fmt.Errorf("alloy %s: invalid range [%g–%g] for %s", a.ID, ing.Min, ing.Max, ing.IngredientID)
+			}
+			minSum += ing.Min
+			maxSum += ing.Max
+		}
+		if len(a.Ingredients) > 0 && (minSum > 100.001 || maxSum < 99.999) {
+			return fmt.Errorf("alloy %s: ingredient ranges cannot sum to 100%% (min %g, max %g)", a.ID, minSum, maxSum)
+		}
+	}
+	return nil
+}
+
+// nullString turns "" into an invalid sql.NullString.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,27 @@
+// tfccalc/data/sqlite.go
+package data
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// NewSQLiteStore opens (or creates) the SQLite database file at path and migrates
+// its schema. A new file gets the stock catalog from the seed migration, so a fresh
+// install works without any setup.
+func NewSQLiteStore(path string) (*SQLStore, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("cannot create directory for %s: %w", path, err)
+		}
+	}
+	db, err := sql.Open("sqlite3", "file:"+path+"?_foreign_keys=on")
+	if err != nil {
+		return nil, fmt.Errorf("cannot open SQLite %s: %w", path, err)
+	}
+	return newSQLStore(db, dialectSQLite)
+}
@@ -0,0 +1,26 @@
+// tfccalc/data/store.go
+package data
+
+import "context"
+
+// RecipeStore is the read side of the alloy/recipe database. The calculator and
+// the UI only ever talk to a RecipeStore, so the backing storage (MySQL, memory, …)
+// can be swapped without touching them.
+//
+// Lookups of a missing ID return an error wrapping ErrNotFound; every other error
+// means the store could not answer (e.g. the database is down).
+type RecipeStore interface {
+	// GetAlloyByID returns the alloy with the given ID.
+	GetAlloyByID(ctx context.Context, id string) (AlloyInfo, error)
+	// GetAllAlloys returns a map[id]→AlloyInfo for all alloys/materials.
+	GetAllAlloys(ctx context.Context) (map[string]AlloyInfo, error)
+	// GetIngredients returns the ingredient ranges of a single alloy.
+	GetIngredients(ctx context.Context, alloyID string) ([]IngredientInfo, error)
+}
+
+// Reloader is implemented by stores that cache what they read (SQLStore). Reload
+// drops the cache and reads the full catalog again; Invalidate drops a single ID.
+type Reloader interface {
+	Reload(ctx context.Context) error
+	Invalidate(id string)
+}
@@ -0,0 +1,253 @@
+package datapack
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"tfccalc/data"
+)
+
+var ctx = context.Background()
+
+// checkTestPack verifies what Import made of testdata/pack.
+func checkTestPack(t *testing.T, store *data.MemoryStore, report *Report) {
+	t.Helper()
+
+	wantImported := []string{"brass", "bronze", "raw_black_steel"}
+	if !reflect.DeepEqual(report.Imported, wantImported) {
+		t.Errorf("Imported = %v, want %v", report.Imported, wantImported)
+	}
+	if want := []string{"tin"}; !reflect.DeepEqual(report.NewBases, want) {
+		t.Errorf("NewBases = %v, want %v", report.NewBases, want)
+	}
+	wantUnclassified := []UnclassifiedMetal{{ID: "mithril", UsedBy: []string{"mithril_bronze"}}}
+	if !reflect.DeepEqual(report.Unclassified, wantUnclassified) {
+		t.Errorf("Unclassified = %v, want %v", report.Unclassified, wantUnclassified)
+	}
+	skipped := make(map[string]bool)
+	for _, s := range report.Skipped {
+		skipped[filepath.Base(s.Path)] = true
+	}
+	if len(skipped) != 2 || !skipped["broken.json"] || !skipped["mithril_bronze.json"] {
+		t.Errorf("Skipped = %v, want broken.json and mithril_bronze.json", report.Skipped)
+	}
+
+	// Fractions become percentages and replace the stock ranges.
+	brass, err := store.GetAlloyByID(ctx, "brass")
+	if err != nil {
+		t.Fatalf("brass missing after import: %v", err)
+	}
+	wantBrass := []data.IngredientInfo{{IngredientID: "copper", Min: 85, Max: 90}, {IngredientID: "zinc", Min: 10, Max: 15}}
+	if brass.Name != "Brass" || !reflect.DeepEqual(brass.Ingredients, wantBrass) {
+		t.Errorf("brass = %+v, want ingredients %v", brass, wantBrass)
+	}
+
+	// weak_steel maps onto the existing raw steel and keeps its type.
+	raw, _ := store.GetAlloyByID(ctx, "raw_black_steel")
+	if raw.Type != "raw_steel" || raw.Name != "Raw Black Steel" || len(raw.Ingredients) != 3 {
+		t.Errorf("raw_black_steel = %+v, want the imported raw_steel recipe", raw)
+	}
+
+	bronze, _ := store.GetAlloyByID(ctx, "bronze")
+	if bronze.Type != "alloy" || bronze.Name != "Bronze" {
+		t.Errorf("bronze = %+v, want a new alloy named Bronze", bronze)
+	}
+	if tin, _ := store.GetAlloyByID(ctx, "tin"); tin.Type != "base" {
+		t.Errorf("tin = %+v, want a base metal", tin)
+	}
+	if _, err := store.GetAlloyByID(ctx, "mithril_bronze"); err == nil {
+		t.Errorf("mithril_bronze was imported although it uses an unclassified metal")
+	}
+	// Untouched entries come from the base store.
+	if _, err := store.GetAlloyByID(ctx, "blue_steel"); err != nil {
+		t.Errorf("blue_steel missing after import: %v", err)
+	}
+}
+
+func TestImport_Directory(t *testing.T) {
+	base := data.NewMemoryStore(data.DefaultAlloys())
+	store, report, err := Import(ctx, filepath.Join("testdata", "pack"), base)
+	if err != nil {
+		t.Fatalf("Import(dir) error: %v", err)
+	}
+	checkTestPack(t, store, report)
+
+	// The base store must not change.
+	if brass, _ := base.GetAlloyByID(ctx, "brass"); brass.Ingredients[0].Min != 88 {
+		t.Errorf("Import modified the base store: %+v", brass)
+	}
+}
+
+func TestImport_Zip(t *testing.T) {
+	zipPath := filepath.Join(t.TempDir(), "pack.zip")
+	f, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	// Put everything below a top-level folder, as many downloaded packs do.
+	src := os.DirFS(filepath.Join("testdata", "pack"))
+	err = fs.WalkDir(src, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		raw, err := fs.ReadFile(src, p)
+		if err != nil {
+			return err
+		}
+		w, err := zw.Create("mypack/" + p)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(raw)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	store, report, err := Import(ctx, zipPath, data.NewMemoryStore(data.DefaultAlloys()))
+	if err != nil {
+		t.Fatalf("Import(zip) error: %v", err)
+	}
+	checkTestPack(t, store, report)
+}
+
+func TestIsAlloyRecipePath(t *testing.T) {
+	cases := map[string]bool{
+		"data/tfc/recipes/alloy/bronze.json":        true,
+		"pack/data/tfc/recipe/alloy/bronze.json":    true,
+		"data/tfc/recipes/alloy/bronze.txt":         false,
+		"data/tfc/recipes/casting/bronze.json":      false,
+		"data/tfc/recipes/alloy/sub/bronze.json":    false,
+		"assets/tfc/recipes/alloy/bronze.json":      false,
+		"data/tfc/tags/recipes/alloy/bronze.json":   false,
+		"recipes/alloy/bronze.json":                 false,
+		"data/mymod/recipes/alloy/mithril_x.json":   true,
+		"x/y/data/mymod/recipes/alloy/steel_x.json": true,
+	}
+	for p, want := range cases {
+		if got := isAlloyRecipePath(p); got != want {
+			t.Errorf("isAlloyRecipePath(%q) = %v, want %v", p, got, want)
+		}
+	}
+}
+
+func TestWriteDatapack_RoundTrip(t *testing.T) {
+	// Tweak a few entries so the round trip has something to carry over.
+	tweaked := data.NewMemoryStore(data.DefaultAlloys())
+	brass, _ := tweaked.GetAlloyByID(ctx, "brass")
+	brass.Name = "Yellow Brass"
+	brass.Ingredients = []data.IngredientInfo{{IngredientID: "copper", Min: 87.5, Max: 91}, {IngredientID: "zinc", Min: 9, Max: 12.5}}
+	rawBlue, _ := tweaked.GetAlloyByID(ctx, "raw_blue_steel")
+	rawBlue.Ingredients[0].Max = 56.3
+	blue, _ := tweaked.GetAlloyByID(ctx, "blue_steel")
+	blue.ExtraIngredientID.String = "black_steel"
+	tweaked.Put(brass, rawBlue, blue)
+
+	zipPath := filepath.Join(t.TempDir(), "export.zip")
+	f, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteDatapack(ctx, f, tweaked); err != nil {
+		t.Fatalf("WriteDatapack error: %v", err)
+	}
+	f.Close()
+
+	// Import into an empty store: everything must come from the pack.
+	imported, report, err := Import(ctx, zipPath, data.NewMemoryStore(nil))
+	if err != nil {
+		t.Fatalf("Import(exported zip) error: %v", err)
+	}
+	if len(report.Skipped) > 0 || len(report.Unclassified) > 0 || len(report.NewBases) > 0 {
+		t.Errorf("round trip report = %+v, want a clean import", report)
+	}
+	// Eight crucible alloys: five simple alloys and three raw steels.
+	if len(report.Imported) != 8 {
+		t.Errorf("Imported %v, want 8 alloys", report.Imported)
+	}
+	got, err := imported.GetAllAlloys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := tweaked.GetAllAlloys(ctx)
+	if len(report.Catalog) != len(want) {
+		t.Errorf("Catalog has %d materials, want %d", len(report.Catalog), len(want))
+	}
+	if len(got) != len(want) {
+		t.Errorf("round trip has %d materials, want %d", len(got), len(want))
+	}
+	for id := range want {
+		if !reflect.DeepEqual(got[id], want[id]) {
+			t.Errorf("%s after round trip = %+v, want %+v", id, got[id], want[id])
+		}
+	}
+}
+
+func TestImportFS_RecipeOverridesCatalog(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteDatapack(ctx, &buf, data.NewMemoryStore(data.DefaultAlloys())); err != nil {
+		t.Fatalf("WriteDatapack error: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog, err := fs.ReadFile(zr, catalogPath)
+	if err != nil {
+		t.Fatalf("exported pack has no %s: %v", catalogPath, err)
+	}
+
+	// A recipe edited after the export wins over the catalog, which keeps the name.
+	pack := fstest.MapFS{
+		catalogPath: {Data: catalog},
+		"data/tfc/recipes/alloy/brass.json": {Data: []byte(`{"type":"tfc:alloy","result":"tfc:brass",
+			"contents":[{"metal":"tfc:copper","min":0.8,"max":0.9},{"metal":"tfc:zinc","min":0.1,"max":0.2}]}`)},
+	}
+	store, _, err := ImportFS(ctx, pack, data.NewMemoryStore(nil))
+	if err != nil {
+		t.Fatalf("ImportFS error: %v", err)
+	}
+	brass, _ := store.GetAlloyByID(ctx, "brass")
+	want := []data.IngredientInfo{{IngredientID: "copper", Min: 80, Max: 90}, {IngredientID: "zinc", Min: 10, Max: 20}}
+	if brass.Name != "Brass" || !reflect.DeepEqual(brass.Ingredients, want) {
+		t.Errorf("brass = %+v, want the edited recipe named Brass", brass)
+	}
+	if steel, err := store.GetAlloyByID(ctx, "black_steel"); err != nil || steel.Type != "final_steel" {
+		t.Errorf("black_steel = (%+v, %v), want the final steel from the catalog", steel, err)
+	}
+}
+
+func TestWriteKubeJS(t *testing.T) {
+	var buf strings.Builder
+	if err := WriteKubeJS(ctx, &buf, data.NewMemoryStore(data.DefaultAlloys())); err != nil {
+		t.Fatalf("WriteKubeJS error: %v", err)
+	}
+	script := buf.String()
+	for _, want := range []string{
+		"ServerEvents.recipes(event => {",
+		"event.remove({ id: 'tfc:alloy/weak_steel' })",
+		`"result":"tfc:weak_steel"`,
+		`{"metal":"tfc:copper","min":0.88,"max":0.92}`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("KubeJS script does not contain %q:\n%s", want, script)
+		}
+	}
+	if strings.Contains(script, "tfc:alloy/steel'") || strings.Contains(script, "black_steel'") {
+		t.Errorf("KubeJS script contains a recipe for a non-crucible steel:\n%s", script)
+	}
+}
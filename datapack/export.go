@@ -0,0 +1,149 @@
+package datapack
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"tfccalc/data"
+)
+
+// packFormat is the pack_format written to pack.mcmeta (Minecraft 1.20.1, the TFC 1.20 line).
+const packFormat = 15
+
+// catalogPath is where WriteDatapack stores the whole catalog as a tfccalc recipe file
+// (see data.ParseRecipes). TFC only has recipes for crucible alloys; the catalog keeps
+// display names, base metals and the anvil-worked steels so Import loses nothing.
+// Minecraft ignores the file.
+const catalogPath = "data/tfccalc/catalog.json"
+
+// exportable reports whether an alloy is made in a crucible and therefore has a TFC
+// alloy recipe. Processed and final steels are worked on an anvil instead.
+func exportable(a data.AlloyInfo) bool {
+	return (a.Type == "alloy" || a.Type == "raw_steel") && len(a.Ingredients) > 0
+}
+
+// recipeFor converts an alloy into its TFC recipe, percentages becoming fractions.
+func recipeFor(a data.AlloyInfo) alloyRecipe {
+	rec := alloyRecipe{Type: "tfc:alloy", Result: tfcMetal(a.ID)}
+	for _, ing := range a.Ingredients {
+		rec.Contents = append(rec.Contents, alloyContent{
+			Metal: tfcMetal(ing.IngredientID),
+			Min:   ing.Min / 100,
+			Max:   ing.Max / 100,
+		})
+	}
+	return rec
+}
+
+// sortedCatalog returns every material of store, sorted by ID.
+func sortedCatalog(ctx context.Context, store data.RecipeStore) ([]data.AlloyInfo, error) {
+	all, err := store.GetAllAlloys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read alloys: %w", err)
+	}
+	catalog := make([]data.AlloyInfo, 0, len(all))
+	for _, a := range all {
+		catalog = append(catalog, a)
+	}
+	sort.Slice(catalog, func(i, j int) bool { return catalog[i].ID < catalog[j].ID })
+	return catalog, nil
+}
+
+// exportableAlloys returns the alloys of catalog that have a TFC recipe, in order.
+func exportableAlloys(catalog []data.AlloyInfo) []data.AlloyInfo {
+	var list []data.AlloyInfo
+	for _, a := range catalog {
+		if exportable(a) {
+			list = append(list, a)
+		}
+	}
+	return list
+}
+
+// WriteDatapack writes a datapack zip to w with one data/tfc/recipes/alloy/<metal>.json
+// per crucible alloy in store, plus the full catalog at catalogPath. The zip can be
+// dropped into a world's datapacks folder and read back with Import.
+func WriteDatapack(ctx context.Context, w io.Writer, store data.RecipeStore) error {
+	catalog, err := sortedCatalog(ctx, store)
+	if err != nil {
+		return err
+	}
+	alloys := exportableAlloys(catalog)
+	catalogJSON, err := data.MarshalRecipes(catalog, "json")
+	if err != nil {
+		return fmt.Errorf("cannot encode catalog: %w", err)
+	}
+	zw := zip.NewWriter(w)
+
+	meta := map[string]any{
+		"pack": map[string]any{
+			"pack_format": packFormat,
+			"description": "TFC alloy recipes exported by tfccalc",
+		},
+	}
+	if err := writeJSON(zw, "pack.mcmeta", meta); err != nil {
+		return err
+	}
+	for _, a := range alloys {
+		name := fmt.Sprintf("data/tfc/recipes/alloy/%s.json", tfcMetal(a.ID)[len("tfc:"):])
+		if err := writeJSON(zw, name, recipeFor(a)); err != nil {
+			return err
+		}
+	}
+	f, err := zw.Create(catalogPath)
+	if err != nil {
+		return fmt.Errorf("cannot add %s to datapack: %w", catalogPath, err)
+	}
+	if _, err := f.Write(append(catalogJSON, '\n')); err != nil {
+		return fmt.Errorf("cannot write %s: %w", catalogPath, err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("cannot finish datapack zip: %w", err)
+	}
+	return nil
+}
+
+// writeJSON adds one indented JSON file to zw.
+func writeJSON(zw *zip.Writer, name string, v any) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return fmt.Errorf("cannot add %s to datapack: %w", name, err)
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("cannot write %s: %w", name, err)
+	}
+	return nil
+}
+
+// WriteKubeJS writes a KubeJS server script that registers the same alloy recipes as
+// WriteDatapack. It replaces the recipes by ID, so it can be used on a server instead
+// of the datapack. Put it in kubejs/server_scripts/.
+func WriteKubeJS(ctx context.Context, w io.Writer, store data.RecipeStore) error {
+	catalog, err := sortedCatalog(ctx, store)
+	if err != nil {
+		return err
+	}
+	alloys := exportableAlloys(catalog)
+	if _, err := fmt.Fprint(w, "// TFC alloy recipes exported by tfccalc.\n\nServerEvents.recipes(event => {\n"); err != nil {
+		return err
+	}
+	for _, a := range alloys {
+		metal := tfcMetal(a.ID)
+		raw, err := json.Marshal(recipeFor(a))
+		if err != nil {
+			return err
+		}
+		id := "tfc:alloy/" + metal[len("tfc:"):]
+		if _, err := fmt.Fprintf(w, "  event.remove({ id: '%s' })\n  event.custom(%s).id('%s')\n", id, raw, id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprint(w, "})\n")
+	return err
+}
@@ -0,0 +1,353 @@
+package datapack
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"tfccalc/data"
+)
+
+// alloyRecipe is the JSON layout of a TFC alloy recipe:
+//
+//	{
+//	  "type": "tfc:alloy",
+//	  "result": "tfc:bronze",
+//	  "contents": [
+//	    {"metal": "tfc:copper", "min": 0.88, "max": 0.92},
+//	    {"metal": "tfc:tin", "min": 0.08, "max": 0.12}
+//	  ]
+//	}
+type alloyRecipe struct {
+	Type     string         `json:"type"`
+	Result   string         `json:"result"`
+	Contents []alloyContent `json:"contents"`
+}
+
+// alloyContent is one entry of alloyRecipe.Contents; Min and Max are fractions (0–1).
+type alloyContent struct {
+	Metal string  `json:"metal"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+}
+
+// Report describes what an import did with the recipes it found.
+type Report struct {
+	Imported     []string            // IDs of alloys added or replaced from recipes
+	Catalog      []string            // IDs of materials taken from a tfccalc catalog file
+	NewBases     []string            // ingredient-only metals added as "base" materials
+	Unclassified []UnclassifiedMetal // metals that could not be classified as base or alloy
+	Skipped      []SkippedFile       // recipe files that were not imported, with the reason
+}
+
+// UnclassifiedMetal is an ingredient that is neither the result of a recipe, known to
+// the store, nor a known TFC base metal. Recipes using it are skipped.
+type UnclassifiedMetal struct {
+	ID     string
+	UsedBy []string // IDs of the recipes that use it
+}
+
+// SkippedFile is a recipe file that was found but not imported.
+type SkippedFile struct {
+	Path   string
+	Reason string
+}
+
+// Import reads every alloy recipe from a datapack directory or .zip file and returns a
+// new MemoryStore holding the alloys of base with the imported recipes laid over them.
+// base itself is not modified.
+func Import(ctx context.Context, packPath string, base data.RecipeStore) (*data.MemoryStore, *Report, error) {
+	info, err := os.Stat(packPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot open datapack: %w", err)
+	}
+	if info.IsDir() {
+		return ImportFS(ctx, os.DirFS(packPath), base)
+	}
+	zr, err := zip.OpenReader(packPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot open datapack %s: %w", packPath, err)
+	}
+	defer zr.Close()
+	return ImportFS(ctx, zr, base)
+}
+
+// ImportFS is Import for an already opened datapack file system.
+func ImportFS(ctx context.Context, fsys fs.FS, base data.RecipeStore) (*data.MemoryStore, *Report, error) {
+	report := &Report{}
+	recipes, err := readRecipes(fsys, report)
+	if err != nil {
+		return nil, nil, err
+	}
+	baseAlloys, err := base.GetAllAlloys(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot read base catalog: %w", err)
+	}
+	catalog, err := readCatalog(fsys, report)
+	if err != nil {
+		return nil, nil, err
+	}
+	// A catalog written by WriteDatapack is laid over base and recipes over both, so
+	// names, base metals and anvil-worked steels survive while edited recipes win.
+	existing := make(map[string]data.AlloyInfo, len(baseAlloys)+len(catalog))
+	for id, a := range baseAlloys {
+		existing[id] = a
+	}
+	for _, a := range catalog {
+		existing[a.ID] = a
+		report.Catalog = append(report.Catalog, a.ID)
+	}
+	sort.Strings(report.Catalog)
+
+	// Classify every ingredient that is not itself produced by a recipe.
+	newBases := make(map[string]bool)
+	unclassified := make(map[string][]string)
+	for _, id := range sortedKeys(recipes) {
+		for _, c := range recipes[id].recipe.Contents {
+			metal := storeID(c.Metal)
+			if _, isResult := recipes[metal]; isResult {
+				continue
+			}
+			if _, known := existing[metal]; known {
+				continue
+			}
+			if knownBaseMetals[metal] {
+				newBases[metal] = true
+				continue
+			}
+			unclassified[metal] = append(unclassified[metal], id)
+		}
+	}
+	for _, id := range sortedKeys(unclassified) {
+		report.Unclassified = append(report.Unclassified, UnclassifiedMetal{ID: id, UsedBy: unclassified[id]})
+	}
+
+	// Drop recipes that use an unclassified metal, then recipes that use a dropped
+	// recipe, until nothing changes.
+	for changed := true; changed; {
+		changed = false
+		for _, id := range sortedKeys(recipes) {
+			rec := recipes[id]
+			for _, c := range rec.recipe.Contents {
+				metal := storeID(c.Metal)
+				_, isResult := recipes[metal]
+				_, known := existing[metal]
+				if isResult || known || newBases[metal] {
+					continue
+				}
+				reason := fmt.Sprintf("uses %s, whose recipe was skipped", metal)
+				if _, ok := unclassified[metal]; ok {
+					reason = fmt.Sprintf("uses unclassified metal %s", metal)
+				}
+				report.Skipped = append(report.Skipped, SkippedFile{Path: rec.path, Reason: reason})
+				delete(recipes, id)
+				changed = true
+				break
+			}
+		}
+	}
+
+	store := data.NewMemoryStore(nil)
+	for _, a := range existing {
+		store.Put(a)
+	}
+	for _, id := range sortedKeys(newBases) {
+		store.Put(data.AlloyInfo{ID: id, Name: displayName(id), Type: "base"})
+		report.NewBases = append(report.NewBases, id)
+	}
+	for _, id := range sortedKeys(recipes) {
+		store.Put(recipeToAlloy(id, recipes[id].recipe, existing))
+		report.Imported = append(report.Imported, id)
+	}
+
+	merged, err := store.GetAllAlloys(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	all := make([]data.AlloyInfo, 0, len(merged))
+	for _, a := range merged {
+		all = append(all, a)
+	}
+	if err := data.ValidateCatalog(all); err != nil {
+		return nil, nil, fmt.Errorf("imported catalog is invalid: %w", err)
+	}
+	return store, report, nil
+}
+
+// parsedRecipe is an alloy recipe together with the file it came from.
+type parsedRecipe struct {
+	path   string
+	recipe alloyRecipe
+}
+
+// readRecipes finds and decodes every data/<namespace>/recipes/alloy/*.json file
+// (TFC 1.21 packs use "recipe" instead of "recipes"). Files that cannot be used are
+// added to report.Skipped. The result is keyed by store ID of the recipe result.
+func readRecipes(fsys fs.FS, report *Report) (map[string]parsedRecipe, error) {
+	recipes := make(map[string]parsedRecipe)
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isAlloyRecipePath(p) {
+			return nil
+		}
+		raw, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		var rec alloyRecipe
+		if err := json.Unmarshal(raw, &rec); err != nil {
+			report.Skipped = append(report.Skipped, SkippedFile{Path: p, Reason: fmt.Sprintf("invalid JSON: %v", err)})
+			return nil
+		}
+		if reason := checkRecipe(rec); reason != "" {
+			report.Skipped = append(report.Skipped, SkippedFile{Path: p, Reason: reason})
+			return nil
+		}
+		id := storeID(rec.Result)
+		if prev, dup := recipes[id]; dup {
+			report.Skipped = append(report.Skipped, SkippedFile{
+				Path:   prev.path,
+				Reason: fmt.Sprintf("overridden by %s", p),
+			})
+		}
+		recipes[id] = parsedRecipe{path: p, recipe: rec}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot read datapack: %w", err)
+	}
+	return recipes, nil
+}
+
+// readCatalog decodes the tfccalc catalog file WriteDatapack adds at catalogPath, if
+// the pack has one. An unreadable catalog is added to report.Skipped and ignored.
+func readCatalog(fsys fs.FS, report *Report) ([]data.AlloyInfo, error) {
+	var catalog []data.AlloyInfo
+	var found string
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || (p != catalogPath && !strings.HasSuffix(p, "/"+catalogPath)) {
+			return nil
+		}
+		raw, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		alloys, err := data.ParseRecipes(raw, "json")
+		if err != nil {
+			report.Skipped = append(report.Skipped, SkippedFile{Path: p, Reason: err.Error()})
+			return nil
+		}
+		if found != "" {
+			report.Skipped = append(report.Skipped, SkippedFile{
+				Path:   found,
+				Reason: fmt.Sprintf("overridden by %s", p),
+			})
+		}
+		catalog, found = alloys, p
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot read datapack: %w", err)
+	}
+	return catalog, nil
+}
+
+// isAlloyRecipePath reports whether p ends in data/<ns>/recipes/alloy/<name>.json.
+// Anything may precede "data", so zips with a top-level folder work too.
+func isAlloyRecipePath(p string) bool {
+	if path.Ext(p) != ".json" {
+		return false
+	}
+	parts := strings.Split(p, "/")
+	n := len(parts)
+	if n < 5 {
+		return false
+	}
+	return parts[n-5] == "data" &&
+		(parts[n-3] == "recipes" || parts[n-3] == "recipe") &&
+		parts[n-2] == "alloy"
+}
+
+// checkRecipe returns why rec cannot be imported, or "" if it is usable.
+func checkRecipe(rec alloyRecipe) string {
+	if rec.Type != "tfc:alloy" {
+		return fmt.Sprintf("recipe type %q is not tfc:alloy", rec.Type)
+	}
+	if rec.Result == "" {
+		return "recipe has no result"
+	}
+	if len(rec.Contents) == 0 {
+		return "recipe has no contents"
+	}
+	minSum, maxSum := 0.0, 0.0
+	seen := make(map[string]bool)
+	for _, c := range rec.Contents {
+		metal := storeID(c.Metal)
+		if metal == "" {
+			return "content without metal"
+		}
+		if seen[metal] {
+			return fmt.Sprintf("metal %s listed twice", metal)
+		}
+		seen[metal] = true
+		if c.Min < 0 || c.Max > 1 || c.Min > c.Max {
+			return fmt.Sprintf("invalid range [%g–%g] for %s", c.Min, c.Max, metal)
+		}
+		minSum += c.Min
+		maxSum += c.Max
+	}
+	if minSum > 1.00001 || maxSum < 0.99999 {
+		return fmt.Sprintf("ranges cannot sum to 100%% (min %g, max %g)", minSum, maxSum)
+	}
+	return ""
+}
+
+// recipeToAlloy converts a recipe into an AlloyInfo, keeping the name and raw_steel
+// type of an existing entry with the same ID.
+func recipeToAlloy(id string, rec alloyRecipe, existing map[string]data.AlloyInfo) data.AlloyInfo {
+	a := data.AlloyInfo{ID: id, Name: displayName(id), Type: "alloy"}
+	if strings.HasPrefix(id, "raw_") && strings.HasSuffix(id, "_steel") {
+		a.Type = "raw_steel"
+	}
+	if prev, ok := existing[id]; ok {
+		a.Name = prev.Name
+		if prev.Type == "raw_steel" {
+			a.Type = prev.Type
+		}
+	}
+	for _, c := range rec.Contents {
+		a.Ingredients = append(a.Ingredients, data.IngredientInfo{
+			IngredientID: storeID(c.Metal),
+			Min:          fractionToPercent(c.Min),
+			Max:          fractionToPercent(c.Max),
+		})
+	}
+	return a
+}
+
+// fractionToPercent converts 0.88 into 88, dropping float noise past 6 decimals.
+func fractionToPercent(f float64) float64 {
+	return math.Round(f*100*1e6) / 1e6
+}
+
+// sortedKeys returns the keys of m in ascending order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
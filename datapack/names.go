@@ -0,0 +1,74 @@
+// Package datapack converts between TerraFirmaCraft datapack alloy recipes
+// (data/<namespace>/recipes/alloy/*.json) and the tfccalc recipe store.
+package datapack
+
+import (
+	"strings"
+	"unicode"
+)
+
+// tfcToStoreID maps TFC metal names that differ from the IDs used by tfccalc.
+// TFC calls the raw steels "weak" steels.
+var tfcToStoreID = map[string]string{
+	"weak_steel":      "raw_black_steel",
+	"weak_blue_steel": "raw_blue_steel",
+	"weak_red_steel":  "raw_red_steel",
+}
+
+// storeToTFCID is the reverse of tfcToStoreID.
+var storeToTFCID = func() map[string]string {
+	m := make(map[string]string, len(tfcToStoreID))
+	for tfc, id := range tfcToStoreID {
+		m[id] = tfc
+	}
+	return m
+}()
+
+// knownBaseMetals are the TFC metals that are smelted from ore rather than alloyed.
+// A metal that only appears as an ingredient is classified as "base" if it is listed here.
+var knownBaseMetals = map[string]bool{
+	"bismuth":      true,
+	"cast_iron":    true,
+	"copper":       true,
+	"gold":         true,
+	"nickel":       true,
+	"pig_iron":     true,
+	"silver":       true,
+	"tin":          true,
+	"wrought_iron": true,
+	"zinc":         true,
+}
+
+// storeID converts a namespaced TFC metal ("tfc:weak_steel") into a store ID ("raw_black_steel").
+// The namespace is dropped, so "mymod:tin" and "tfc:tin" are the same metal.
+func storeID(metal string) string {
+	if i := strings.IndexByte(metal, ':'); i >= 0 {
+		metal = metal[i+1:]
+	}
+	if id, ok := tfcToStoreID[metal]; ok {
+		return id
+	}
+	return metal
+}
+
+// tfcMetal converts a store ID back into a namespaced TFC metal name.
+func tfcMetal(id string) string {
+	if tfc, ok := storeToTFCID[id]; ok {
+		id = tfc
+	}
+	return "tfc:" + id
+}
+
+// displayName turns an ID like "bismuth_bronze" into "Bismuth Bronze".
+func displayName(id string) string {
+	words := strings.Split(id, "_")
+	for i, w := range words {
+		if w == "" {
+			continue
+		}
+		r := []rune(w)
+		r[0] = unicode.ToUpper(r[0])
+		words[i] = string(r)
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"tfccalc/datapack"
+)
+
+// runExportDatapack implements "tfccalc export-datapack": it writes the crucible
+// alloys of the selected store as a datapack zip and, optionally, a KubeJS script.
+func runExportDatapack(args []string) {
+	fs := flag.NewFlagSet("export-datapack", flag.ExitOnError)
+	out := fs.String("o", "tfccalc_alloys.zip", "datapack zip to write")
+	kubejs := fs.String("kubejs", "", "also write a KubeJS server script with the same recipes to this file")
+	cfg := loadConfig(fs, args)
+
+	store, closeStore, err := openStore(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize DB: %v", err)
+	}
+	defer closeStore()
+
+	ctx := context.Background()
+	if err := writeFile(*out, func(f *os.File) error { return datapack.WriteDatapack(ctx, f, store) }); err != nil {
+		log.Fatalf("Failed to export datapack: %v", err)
+	}
+	log.Printf("Wrote datapack %s", *out)
+
+	if *kubejs != "" {
+		if err := writeFile(*kubejs, func(f *os.File) error { return datapack.WriteKubeJS(ctx, f, store) }); err != nil {
+			log.Fatalf("Failed to export KubeJS script: %v", err)
+		}
+		log.Printf("Wrote KubeJS script %s", *kubejs)
+	}
+}
+
+// writeFile creates path, lets write fill it and closes it, reporting the first error.
+func writeFile(path string, write func(f *os.File) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
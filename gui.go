@@ -0,0 +1,28 @@
+//go:build !nogui
+
+package main
+
+import (
+	"flag"
+	"log"
+
+	"fyne.io/fyne/v2/app"
+
+	"tfccalc/ui"
+)
+
+// runGUI opens the Fyne window.
+func runGUI(args []string) {
+	fs := flag.NewFlagSet("tfccalc", flag.ExitOnError)
+	cfg := loadConfig(fs, args)
+
+	store, closeStore, err := openStore(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize DB: %v", err)
+	}
+	defer closeStore()
+
+	myApp := app.New()
+	myWindow := ui.BuildUI(myApp, store, cfg.UI)
+	myWindow.ShowAndRun()
+}
@@ -0,0 +1,14 @@
+//go:build nogui
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// runGUI reports that this binary was built without the window.
+func runGUI(args []string) {
+	fmt.Fprintln(os.Stderr, "tfccalc was built with -tags nogui and has no window; see tfccalc help")
+	os.Exit(2)
+}
@@ -1,24 +1,65 @@
 package main
 
 import (
+	"flag"
 	"fmt"
-	"log"
+	"os"
+	"strings"
 
-	"fyne.io/fyne/v2/app"
-
-	"tfccalc/data"
-	"tfccalc/ui"
+	"tfccalc/config"
 )
 
 func main() {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true&charset=utf8mb4",
-		"tfccalc_user", "tfccalc_pass", "127.0.0.1", 3405, "tfccalc_db",
-	)
-	if err := data.InitDB(dsn); err != nil {
-		log.Fatalf("Failed to initialize DB: %v", err)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "export-datapack":
+			runExportDatapack(os.Args[2:])
+			return
+		case "migrate":
+			runMigrate(os.Args[2:])
+			return
+		case "calc":
+			runCalc(os.Args[2:])
+			return
+		case "tui":
+			runTUI(os.Args[2:])
+			return
+		case "serve":
+			runServe(os.Args[2:])
+			return
+		case "help", "-h", "-help", "--help":
+			usage()
+			return
+		}
 	}
+	runGUI(os.Args[1:])
+}
+
+// usage prints the available subcommands.
+func usage() {
+	fmt.Fprint(os.Stderr, `Usage:
+  tfccalc [flags]                     open the calculator window
+  tfccalc calc <alloy> <amount> [-mode ingots|mb] [-set alloy.ingredient=pct]... [-format text|json|yaml|csv]
+                                      print the breakdown and the base metals
+  tfccalc tui                         open the calculator full-screen in the terminal
+  tfccalc serve [-addr host:port]     serve the web page and its JSON API
+  tfccalc export-datapack [flags]     write the alloy recipes as a TFC datapack
+  tfccalc migrate [-to N] [flags]     show or change the database schema version
 
-	myApp := app.New()
-	myWindow := ui.BuildUI(myApp)
-	myWindow.ShowAndRun()
+Run a subcommand with -h to see its flags. Every subcommand also reads
+TFCCALC_* environment variables and an optional config file (-config).
+Binaries built with -tags nogui have every subcommand but the window.
+`)
+}
+
+// loadConfig parses args into a configuration, exiting with a readable message
+// if it is invalid.
+func loadConfig(fs *flag.FlagSet, args []string) *config.Config {
+	cfg, err := config.Load(fs, args)
+	if err != nil {
+		msg := strings.ReplaceAll(err.Error(), "\n", "\n  ")
+		fmt.Fprintf(os.Stderr, "%s: invalid configuration:\n  %s\n", fs.Name(), msg)
+		os.Exit(2)
+	}
+	return cfg
 }
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"tfccalc/config"
+	"tfccalc/data"
+)
+
+// runMigrate implements "tfccalc migrate": opening the database already applies
+// every new migration, so without -to it only reports the schema version. With
+// -to it moves the schema up or down to that version. A version below the latest
+// is pinned (see data.SQLStore.MigrateTo): this build then leaves the database
+// alone, for an older build to use, until "migrate -to <latest>" is run.
+func runMigrate(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	to := fs.Int("to", -1, "schema version to migrate to; 0 drops every table. "+
+		"A version below the latest stays pinned until you migrate to the latest again")
+	cfg := loadConfig(fs, args)
+
+	backend := cfg.ResolvedBackend()
+	if backend == config.BackendRecipes {
+		log.Fatalf("The recipe file backend has no schema to migrate")
+	}
+	store, err := openBackend(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize DB: %v", err)
+	}
+	sqlStore, ok := store.(*data.SQLStore)
+	if !ok {
+		log.Fatalf("The %s backend has no schema to migrate", backend)
+	}
+	defer sqlStore.Close()
+
+	ctx := context.Background()
+	if *to >= 0 {
+		if err := sqlStore.MigrateTo(ctx, *to); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+	}
+	v, err := sqlStore.SchemaVersion(ctx)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	pin := ""
+	if _, pinned := sqlStore.PinnedSchemaVersion(); pinned {
+		pin = ", pinned"
+	}
+	fmt.Printf("%s schema version %d (latest %d%s)\n", backend, v, sqlStore.LatestSchemaVersion(), pin)
+}
@@ -0,0 +1,165 @@
+// Package report turns a calculation into machine-readable output: JSON and YAML
+// documents with the inputs, the summary of base metals and the full tree, and a
+// CSV file with the summary only. Documents carry SchemaVersion; schema.json
+// describes version 1.
+package report
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"tfccalc/calculator"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SchemaVersion is the version of the document layout. It changes only when a
+// field is removed or changes meaning; new optional fields keep the version.
+const SchemaVersion = 1
+
+// JSONSchema is the JSON Schema of a version 1 document.
+//
+//go:embed schema.json
+var JSONSchema []byte
+
+// Report is one calculation with everything needed to repeat it.
+type Report struct {
+	SchemaVersion int               `json:"schema_version" yaml:"schema_version"`
+	Input         Input             `json:"input" yaml:"input"`
+	Summary       map[string]Amount `json:"summary" yaml:"summary"` // base ID → amount
+	Tree          *Node             `json:"tree" yaml:"tree"`
+	Warnings      []string          `json:"warnings,omitempty" yaml:"warnings,omitempty"`
+}
+
+// Input echoes what was asked for.
+type Input struct {
+	AlloyID     string                        `json:"alloy_id" yaml:"alloy_id"`
+	Amount      float64                       `json:"amount" yaml:"amount"`
+	Mode        string                        `json:"mode" yaml:"mode"`                                   // "mB" or "Ingots"
+	Percentages map[string]map[string]float64 `json:"percentages,omitempty" yaml:"percentages,omitempty"` // alloy ID or path → ingredient ID → percent
+	Exact       bool                          `json:"exact,omitempty" yaml:"exact,omitempty"`
+}
+
+// Amount is a quantity of one material.
+type Amount struct {
+	Name   string  `json:"name" yaml:"name"`
+	MB     float64 `json:"mb" yaml:"mb"`
+	Ingots float64 `json:"ingots" yaml:"ingots"`
+	// ExactMB is MB as a fraction such as "111/4", for exact calculations only.
+	ExactMB string `json:"exact_mb,omitempty" yaml:"exact_mb,omitempty"`
+}
+
+// Node is one node of the calculation tree.
+type Node struct {
+	ID          string             `json:"id" yaml:"id"`
+	Path        string             `json:"path" yaml:"path"`
+	Name        string             `json:"name" yaml:"name"`
+	Type        string             `json:"type" yaml:"type"`
+	MB          float64            `json:"mb" yaml:"mb"`
+	Ingots      float64            `json:"ingots" yaml:"ingots"`
+	Percentages map[string]float64 `json:"percentages,omitempty" yaml:"percentages,omitempty"` // ingredient ID → percent used here
+	Children    []*Node            `json:"children,omitempty" yaml:"children,omitempty"`
+}
+
+// New builds the report of res, which was calculated from in. names gives the
+// display name of a base ID; the tree has its own names.
+func New(in Input, res *calculator.Result, names func(id string) string) *Report {
+	r := &Report{
+		SchemaVersion: SchemaVersion,
+		Input:         in,
+		Summary:       make(map[string]Amount, len(res.TotalMB)),
+		Tree:          newNode(res.Root),
+		Warnings:      res.Warnings,
+	}
+	for id, mB := range res.TotalMB {
+		a := Amount{Name: names(id), MB: mB, Ingots: res.TotalIngots[id]}
+		if exact := res.ExactMB[id]; exact != nil {
+			a.ExactMB = exact.RatString()
+		}
+		r.Summary[id] = a
+	}
+	return r
+}
+
+func newNode(n *calculator.Node) *Node {
+	node := &Node{
+		ID:          n.MaterialID,
+		Path:        n.Path,
+		Name:        n.Name,
+		Type:        n.Type,
+		MB:          n.AmountMB,
+		Ingots:      n.AmountIngots(),
+		Percentages: n.Percentages,
+	}
+	for _, child := range n.Children {
+		node.Children = append(node.Children, newNode(child))
+	}
+	return node
+}
+
+// Formats accepted by Write.
+const (
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+	FormatCSV  = "csv"
+)
+
+// Write writes r to w in format.
+func (r *Report) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatJSON:
+		return r.WriteJSON(w)
+	case FormatYAML:
+		return r.WriteYAML(w)
+	case FormatCSV:
+		return r.WriteCSV(w)
+	}
+	return fmt.Errorf("unknown format %q, want json, yaml or csv", format)
+}
+
+// WriteJSON writes r as an indented JSON document.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteYAML writes r as a YAML document with the same fields as the JSON one.
+func (r *Report) WriteYAML(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(r); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// WriteCSV writes the summary with a header row,
+//
+//	schema_version,base_id,name,mb,ingots
+//
+// and one row per base metal, sorted by ID. Amounts are printed in full precision.
+func (r *Report) WriteCSV(w io.Writer) error {
+	ids := make([]string, 0, len(r.Summary))
+	for id := range r.Summary {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"schema_version", "base_id", "name", "mb", "ingots"})
+	version := strconv.Itoa(r.SchemaVersion)
+	for _, id := range ids {
+		a := r.Summary[id]
+		cw.Write([]string{version, id, a.Name, formatFloat(a.MB), formatFloat(a.Ingots)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
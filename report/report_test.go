@@ -0,0 +1,127 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"tfccalc/calculator"
+	"tfccalc/data"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ctx = context.Background()
+
+// blueSteel returns the report of 2 ingots of blue steel with one override.
+func blueSteel(t *testing.T, calc *calculator.Calculator) *Report {
+	t.Helper()
+	in := Input{AlloyID: "blue_steel", Amount: 2, Mode: "Ingots", Percentages: map[string]map[string]float64{
+		"black_bronze": {"copper": 66, "zinc": 17, "nickel": 17},
+	}}
+	res, err := calc.Calculate(ctx, in.AlloyID, in.Amount, in.Mode, in.Percentages)
+	if err != nil {
+		t.Fatalf("Calculate error: %v", err)
+	}
+	return New(in, res, func(id string) string { return data.GetAlloyNameByID(ctx, calc.Store(), id) })
+}
+
+func TestWriteJSON(t *testing.T) {
+	r := blueSteel(t, calculator.New(data.NewMemoryStore(data.DefaultAlloys())))
+	var buf bytes.Buffer
+	if err := r.Write(&buf, FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	var back Report
+	if err := json.Unmarshal(buf.Bytes(), &back); err != nil {
+		t.Fatalf("output is not JSON: %v", err)
+	}
+	if !reflect.DeepEqual(&back, r) {
+		t.Errorf("JSON round trip changed the report:\n%s", buf.String())
+	}
+	if back.SchemaVersion != 1 || back.Summary["silver"].Name != "Silver" || back.Summary["silver"].MB <= 0 {
+		t.Errorf("schema_version %d, silver %+v", back.SchemaVersion, back.Summary["silver"])
+	}
+	if back.Tree.Children[0].Path != "blue_steel/raw_blue_steel" || back.Tree.Children[0].Percentages["black_steel"] != 52.5 {
+		t.Errorf("first child = %+v, want raw blue steel with its percentages", back.Tree.Children[0])
+	}
+
+	// Every field the schema requires is there.
+	var schema struct {
+		Required   []string `json:"required"`
+		Properties struct {
+			Input struct {
+				Required []string `json:"required"`
+			} `json:"input"`
+		} `json:"properties"`
+		Defs struct {
+			Node struct {
+				Required []string `json:"required"`
+			} `json:"node"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(JSONSchema, &schema); err != nil {
+		t.Fatalf("JSONSchema is not JSON: %v", err)
+	}
+	var doc map[string]any
+	json.Unmarshal(buf.Bytes(), &doc)
+	for obj, required := range map[string][]string{
+		"document": schema.Required,
+		"input":    schema.Properties.Input.Required,
+		"tree":     schema.Defs.Node.Required,
+	} {
+		m := doc
+		if obj != "document" {
+			m = doc[obj].(map[string]any)
+		}
+		for _, key := range required {
+			if _, ok := m[key]; !ok {
+				t.Errorf("%s lacks required field %q", obj, key)
+			}
+		}
+	}
+}
+
+func TestWriteYAML(t *testing.T) {
+	r := blueSteel(t, calculator.New(data.NewMemoryStore(data.DefaultAlloys())))
+	var buf bytes.Buffer
+	if err := r.Write(&buf, FormatYAML); err != nil {
+		t.Fatal(err)
+	}
+	var back Report
+	if err := yaml.Unmarshal(buf.Bytes(), &back); err != nil {
+		t.Fatalf("output is not YAML: %v", err)
+	}
+	if !reflect.DeepEqual(&back, r) {
+		t.Errorf("YAML round trip changed the report:\n%s", buf.String())
+	}
+	if !strings.HasPrefix(buf.String(), "schema_version: 1\n") {
+		t.Errorf("YAML starts with %q", strings.SplitN(buf.String(), "\n", 2)[0])
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	calc := calculator.NewExact(data.NewMemoryStore(data.DefaultAlloys()))
+	res, err := calc.Calculate(ctx, "sterling_silver", 0.3, "Ingots", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := New(Input{AlloyID: "sterling_silver", Amount: 0.3, Mode: "Ingots", Exact: true}, res, func(id string) string { return id })
+	if r.Summary["silver"].ExactMB != "111/4" {
+		t.Errorf("exact silver = %q, want 111/4", r.Summary["silver"].ExactMB)
+	}
+	var buf bytes.Buffer
+	if err := r.Write(&buf, FormatCSV); err != nil {
+		t.Fatal(err)
+	}
+	want := "schema_version,base_id,name,mb,ingots\n1,copper,copper,2.25,0.0225\n1,silver,silver,27.75,0.2775\n"
+	if buf.String() != want {
+		t.Errorf("CSV =\n%s\nwant\n%s", buf.String(), want)
+	}
+	if err := r.Write(&buf, "xml"); err == nil {
+		t.Error("Write(xml) succeeded")
+	}
+}
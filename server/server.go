@@ -0,0 +1,331 @@
+// Package server exposes the calculator as a JSON REST API:
+//
+//	GET  /alloys          every material, sorted by ID
+//	GET  /alloys/{id}     one material
+//	POST /calculate       a calculation, answered with a report (see package report)
+//	POST /reverse         the most of an alloy an inventory of base metals can make
+//	POST /validate        whether percentages fit an alloy's recipe
+//	POST /balance         the percentages of an alloy completed around some pinned ones
+//	GET  /openapi.yaml    the OpenAPI document of all of the above
+//	GET  /schema.json     the JSON Schema of the report
+//
+// Errors are JSON objects with an "error" message: 400 for a malformed request,
+// 404 for an unknown material, 422 for percentages or inventories that the
+// calculator rejects (calculator.ValidationError), 500 for anything else.
+package server
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"tfccalc/calculator"
+	"tfccalc/data"
+	"tfccalc/report"
+)
+
+// OpenAPI is the OpenAPI 3 document of the API.
+//
+//go:embed openapi.yaml
+var OpenAPI []byte
+
+// maxBodyBytes limits the size of a request body.
+const maxBodyBytes = 1 << 20
+
+// Server answers API requests from a RecipeStore.
+type Server struct {
+	store data.RecipeStore
+	mux   *http.ServeMux
+}
+
+// New returns a Server that reads recipes from store.
+func New(store data.RecipeStore) *Server {
+	s := &Server{store: store, mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /alloys", s.listAlloys)
+	s.mux.HandleFunc("GET /alloys/{id}", s.getAlloy)
+	s.mux.HandleFunc("POST /calculate", s.calculate)
+	s.mux.HandleFunc("POST /reverse", s.reverse)
+	s.mux.HandleFunc("POST /validate", s.validate)
+	s.mux.HandleFunc("POST /balance", s.balance)
+	s.mux.HandleFunc("GET /openapi.yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write(OpenAPI)
+	})
+	s.mux.HandleFunc("GET /schema.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/schema+json")
+		w.Write(report.JSONSchema)
+	})
+	return s
+}
+
+// Handle registers an extra handler for pattern, e.g. a web page served next to
+// the API.
+func (s *Server) Handle(pattern string, h http.Handler) {
+	s.mux.Handle(pattern, h)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Alloy is a material as the API shows it, with the field names of recipe files.
+type Alloy struct {
+	ID                 string             `json:"id"`
+	Name               string             `json:"name"`
+	Type               string             `json:"type"`
+	RawFormID          string             `json:"raw_form_id,omitempty"`
+	ExtraIngredientID  string             `json:"extra_ingredient_id,omitempty"`
+	Ingredients        []Ingredient       `json:"ingredients,omitempty"`
+	DefaultPercentages map[string]float64 `json:"default_percentages,omitempty"`
+}
+
+// Ingredient is the range of one ingredient of an Alloy.
+type Ingredient struct {
+	ID  string  `json:"id"`
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// CalculateRequest is the body of POST /calculate.
+type CalculateRequest struct {
+	AlloyID     string                        `json:"alloy_id"`
+	Amount      float64                       `json:"amount"`
+	Mode        string                        `json:"mode"` // "mB" or "Ingots" in any case; "" means Ingots
+	Percentages map[string]map[string]float64 `json:"percentages"`
+	Exact       bool                          `json:"exact"`
+}
+
+// ReverseRequest is the body of POST /reverse.
+type ReverseRequest struct {
+	AlloyID   string             `json:"alloy_id"`
+	Inventory map[string]float64 `json:"inventory"` // base ID → mB
+}
+
+// ReverseResponse answers POST /reverse.
+type ReverseResponse struct {
+	AlloyID     string                        `json:"alloy_id"`
+	AmountMB    float64                       `json:"amount_mb"`
+	Percentages map[string]map[string]float64 `json:"percentages"`
+	UsedMB      map[string]float64            `json:"used_mb"`
+	LeftoverMB  map[string]float64            `json:"leftover_mb"`
+}
+
+// ValidateRequest is the body of POST /validate.
+type ValidateRequest struct {
+	AlloyID     string             `json:"alloy_id"`
+	Percentages map[string]float64 `json:"percentages"`
+}
+
+// ValidateResponse answers POST /validate, with 200 if Valid and 422 if not.
+type ValidateResponse struct {
+	Valid bool   `json:"valid"`
+	Error string `json:"error,omitempty"`
+}
+
+// BalanceRequest is the body of POST /balance.
+type BalanceRequest struct {
+	AlloyID string             `json:"alloy_id"`
+	Pinned  map[string]float64 `json:"pinned"` // ingredient ID → percent; the others are filled in
+}
+
+// BalanceResponse answers POST /balance.
+type BalanceResponse struct {
+	Percentages map[string]float64 `json:"percentages"`
+}
+
+// ErrorResponse is the body of every error.
+type ErrorResponse struct {
+	Error   string `json:"error"`
+	AlloyID string `json:"alloy_id,omitempty"` // the alloy whose percentages were rejected, for 422
+}
+
+func (s *Server) listAlloys(w http.ResponseWriter, r *http.Request) {
+	all, err := s.store.GetAllAlloys(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	calc := calculator.New(s.store)
+	alloys := make([]Alloy, 0, len(all))
+	for _, a := range all {
+		alloy, err := newAlloy(r, calc, a)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		alloys = append(alloys, alloy)
+	}
+	sort.Slice(alloys, func(i, j int) bool { return alloys[i].ID < alloys[j].ID })
+	writeJSON(w, http.StatusOK, alloys)
+}
+
+func (s *Server) getAlloy(w http.ResponseWriter, r *http.Request) {
+	a, err := s.store.GetAlloyByID(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	alloy, err := newAlloy(r, calculator.New(s.store), a)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, alloy)
+}
+
+// newAlloy converts a to its API form.
+func newAlloy(r *http.Request, calc *calculator.Calculator, a data.AlloyInfo) (Alloy, error) {
+	alloy := Alloy{ID: a.ID, Name: a.Name, Type: a.Type, RawFormID: a.RawFormID.String, ExtraIngredientID: a.ExtraIngredientID.String}
+	for _, ing := range a.Ingredients {
+		alloy.Ingredients = append(alloy.Ingredients, Ingredient{ID: ing.IngredientID, Min: ing.Min, Max: ing.Max})
+	}
+	if len(a.Ingredients) > 0 {
+		defaults, err := calc.GetDefaultPercentages(r.Context(), a.ID)
+		if err != nil {
+			return Alloy{}, err
+		}
+		alloy.DefaultPercentages = defaults
+	}
+	return alloy, nil
+}
+
+func (s *Server) calculate(w http.ResponseWriter, r *http.Request) {
+	var req CalculateRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	mode := "Ingots"
+	switch {
+	case req.Mode == "" || strings.EqualFold(req.Mode, "Ingots"):
+	case strings.EqualFold(req.Mode, "mB"):
+		mode = "mB"
+	default:
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("mode %q is neither mB nor Ingots", req.Mode)})
+		return
+	}
+	if req.Amount <= 0 {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "amount must be positive"})
+		return
+	}
+	calc := calculator.New(s.store)
+	if req.Exact {
+		calc = calculator.NewExact(s.store)
+	}
+	if _, err := s.store.GetAlloyByID(r.Context(), req.AlloyID); err != nil {
+		writeError(w, err)
+		return
+	}
+	// The calculator would replace invalid percentages by defaults with a warning;
+	// an API client gets an error instead.
+	for key, perc := range req.Percentages {
+		alloyID, err := calc.OverrideAlloyID(r.Context(), key)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if _, err := calc.ValidatePercentages(r.Context(), alloyID, perc); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+
+	res, err := calc.Calculate(r.Context(), req.AlloyID, req.Amount, mode, req.Percentages)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	in := report.Input{AlloyID: req.AlloyID, Amount: req.Amount, Mode: mode, Percentages: req.Percentages, Exact: req.Exact}
+	names := func(id string) string { return data.GetAlloyNameByID(r.Context(), s.store, id) }
+	writeJSON(w, http.StatusOK, report.New(in, res, names))
+}
+
+func (s *Server) reverse(w http.ResponseWriter, r *http.Request) {
+	var req ReverseRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	yield, err := calculator.New(s.store).MaxProducible(r.Context(), req.AlloyID, req.Inventory)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ReverseResponse{
+		AlloyID:     yield.TargetID,
+		AmountMB:    yield.AmountMB,
+		Percentages: yield.Percentages,
+		UsedMB:      yield.UsedMB,
+		LeftoverMB:  yield.LeftoverMB,
+	})
+}
+
+func (s *Server) validate(w http.ResponseWriter, r *http.Request) {
+	var req ValidateRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	valid, err := calculator.New(s.store).ValidatePercentages(r.Context(), req.AlloyID, req.Percentages)
+	var invalid *calculator.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		writeJSON(w, http.StatusUnprocessableEntity, ValidateResponse{Error: err.Error()})
+	case err != nil:
+		writeError(w, err)
+	case !valid:
+		// Only an alloy without ingredients rejects a map without an error.
+		writeJSON(w, http.StatusUnprocessableEntity, ValidateResponse{Error: fmt.Sprintf("%s has no ingredients", req.AlloyID)})
+	default:
+		writeJSON(w, http.StatusOK, ValidateResponse{Valid: true})
+	}
+}
+
+func (s *Server) balance(w http.ResponseWriter, r *http.Request) {
+	var req BalanceRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	perc, err := calculator.New(s.store).BalancePercentages(r.Context(), req.AlloyID, req.Pinned)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, BalanceResponse{Percentages: perc})
+}
+
+// readJSON decodes the request body into v. Unknown fields are an error, so that
+// a misspelt field is not silently ignored. On failure it answers 400 and returns
+// false.
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("invalid request body: %v", err)})
+		return false
+	}
+	return true
+}
+
+// writeError answers with the status that fits err.
+func writeError(w http.ResponseWriter, err error) {
+	var invalid *calculator.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		writeJSON(w, http.StatusUnprocessableEntity, ErrorResponse{Error: err.Error(), AlloyID: invalid.AlloyID})
+	case errors.Is(err, data.ErrNotFound):
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: err.Error()})
+	default:
+		log.Printf("server: %v", err)
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
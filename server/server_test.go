@@ -0,0 +1,176 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"tfccalc/data"
+	"tfccalc/report"
+)
+
+// do sends a request to a server on the default catalog and decodes the JSON
+// answer into out, if out is not nil.
+func do(t *testing.T, method, path, body string, out any) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	New(data.NewMemoryStore(data.DefaultAlloys())).ServeHTTP(rec, req)
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: answer is not JSON: %v\n%s", method, path, err, rec.Body.String())
+		}
+	}
+	return rec
+}
+
+func TestAlloys(t *testing.T) {
+	var alloys []Alloy
+	if rec := do(t, "GET", "/alloys", "", &alloys); rec.Code != http.StatusOK {
+		t.Fatalf("GET /alloys = %d", rec.Code)
+	}
+	if len(alloys) != len(data.DefaultAlloys()) {
+		t.Errorf("got %d alloys, want %d", len(alloys), len(data.DefaultAlloys()))
+	}
+	for i := 1; i < len(alloys); i++ {
+		if alloys[i-1].ID >= alloys[i].ID {
+			t.Errorf("alloys not sorted by ID: %s before %s", alloys[i-1].ID, alloys[i].ID)
+		}
+	}
+
+	var bronze Alloy
+	if rec := do(t, "GET", "/alloys/black_bronze", "", &bronze); rec.Code != http.StatusOK {
+		t.Fatalf("GET /alloys/black_bronze = %d", rec.Code)
+	}
+	if bronze.Name != "Black Bronze" || len(bronze.Ingredients) != 3 || bronze.DefaultPercentages["copper"] == 0 {
+		t.Errorf("black bronze = %+v", bronze)
+	}
+	var blue Alloy
+	do(t, "GET", "/alloys/blue_steel", "", &blue)
+	if blue.Type != "final_steel" || blue.RawFormID != "raw_blue_steel" || blue.ExtraIngredientID == "" {
+		t.Errorf("blue steel = %+v", blue)
+	}
+
+	var e ErrorResponse
+	if rec := do(t, "GET", "/alloys/mithril", "", &e); rec.Code != http.StatusNotFound || e.Error == "" {
+		t.Errorf("GET /alloys/mithril = %d %+v, want 404 with an error", rec.Code, e)
+	}
+}
+
+func TestCalculate(t *testing.T) {
+	var r report.Report
+	rec := do(t, "POST", "/calculate", `{"alloy_id": "black_bronze", "amount": 1000, "mode": "mb",
+		"percentages": {"black_bronze": {"copper": 60, "zinc": 20, "nickel": 20}}}`, &r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /calculate = %d\n%s", rec.Code, rec.Body.String())
+	}
+	if r.Input.Mode != "mB" || r.Summary["copper"].MB != 600 || r.Summary["nickel"].MB != 200 {
+		t.Errorf("report input %+v, summary %+v", r.Input, r.Summary)
+	}
+
+	// A final steel's ID sets its raw form, where Calculate applies it too.
+	r = report.Report{}
+	rec = do(t, "POST", "/calculate", `{"alloy_id": "blue_steel", "amount": 1,
+		"percentages": {"black_steel": {"steel": 50, "nickel": 25, "black_bronze": 25}}}`, &r)
+	if rec.Code != http.StatusOK || len(r.Warnings) != 0 || r.Summary["nickel"].MB <= 0 {
+		t.Errorf("black_steel override = %d, warnings %q", rec.Code, r.Warnings)
+	}
+
+	rec = do(t, "POST", "/calculate", `{"alloy_id": "blue_steel", "amount": 1, "exact": true}`, &r)
+	if rec.Code != http.StatusOK || !r.Input.Exact || r.Summary["silver"].ExactMB == "" {
+		t.Errorf("exact blue steel = %d, summary %+v", rec.Code, r.Summary)
+	}
+}
+
+func TestCalculate_Errors(t *testing.T) {
+	for _, tc := range []struct {
+		name, body string
+		code       int
+		alloyID    string
+	}{
+		{"not JSON", `{"alloy_id":`, http.StatusBadRequest, ""},
+		{"unknown field", `{"alloy_id": "brass", "amount": 1, "amuont": 2}`, http.StatusBadRequest, ""},
+		{"bad mode", `{"alloy_id": "brass", "amount": 1, "mode": "buckets"}`, http.StatusBadRequest, ""},
+		{"no amount", `{"alloy_id": "brass"}`, http.StatusBadRequest, ""},
+		{"unknown alloy", `{"alloy_id": "mithril", "amount": 1}`, http.StatusNotFound, ""},
+		{"sum not 100", `{"alloy_id": "brass", "amount": 1, "percentages": {"brass": {"copper": 90, "zinc": 20}}}`,
+			http.StatusUnprocessableEntity, "brass"},
+		{"out of range", `{"alloy_id": "brass", "amount": 1, "percentages": {"brass": {"copper": 80, "zinc": 20}}}`,
+			http.StatusUnprocessableEntity, "brass"},
+		// A final steel's percentages are those of its raw form.
+		{"final steel", `{"alloy_id": "blue_steel", "amount": 1, "percentages": {"blue_steel": {"black_steel": 10}}}`,
+			http.StatusUnprocessableEntity, "raw_blue_steel"},
+		{"path", `{"alloy_id": "blue_steel", "amount": 1, "percentages": {"blue_steel/raw_blue_steel/black_steel/raw_black_steel/black_bronze": {"copper": 100}}}`,
+			http.StatusUnprocessableEntity, "black_bronze"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var e ErrorResponse
+			rec := do(t, "POST", "/calculate", tc.body, &e)
+			if rec.Code != tc.code || e.Error == "" || e.AlloyID != tc.alloyID {
+				t.Errorf("POST /calculate = %d %+v, want %d for %q", rec.Code, e, tc.code, tc.alloyID)
+			}
+		})
+	}
+}
+
+func TestReverse(t *testing.T) {
+	var y ReverseResponse
+	rec := do(t, "POST", "/reverse", `{"alloy_id": "brass", "inventory": {"copper": 900, "zinc": 100}}`, &y)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /reverse = %d\n%s", rec.Code, rec.Body.String())
+	}
+	if y.AmountMB < 999 || y.Percentages["brass"]["zinc"] != 10 || y.LeftoverMB["copper"] > 1 {
+		t.Errorf("yield = %+v", y)
+	}
+
+	var e ErrorResponse
+	rec = do(t, "POST", "/reverse", `{"alloy_id": "brass", "inventory": {"copper": -1}}`, &e)
+	if rec.Code != http.StatusUnprocessableEntity || e.AlloyID != "brass" {
+		t.Errorf("negative inventory = %d %+v, want 422", rec.Code, e)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	var v ValidateResponse
+	rec := do(t, "POST", "/validate", `{"alloy_id": "brass", "percentages": {"copper": 90, "zinc": 10}}`, &v)
+	if rec.Code != http.StatusOK || !v.Valid {
+		t.Errorf("valid brass = %d %+v", rec.Code, v)
+	}
+	v = ValidateResponse{}
+	rec = do(t, "POST", "/validate", `{"alloy_id": "brass", "percentages": {"copper": 80, "zinc": 10}}`, &v)
+	if rec.Code != http.StatusUnprocessableEntity || v.Valid || v.Error == "" {
+		t.Errorf("invalid brass = %d %+v", rec.Code, v)
+	}
+	rec = do(t, "POST", "/validate", `{"alloy_id": "mithril", "percentages": {}}`, nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown alloy = %d, want 404", rec.Code)
+	}
+}
+
+func TestBalance(t *testing.T) {
+	var b BalanceResponse
+	rec := do(t, "POST", "/balance", `{"alloy_id": "black_bronze", "pinned": {"copper": 70}}`, &b)
+	if rec.Code != http.StatusOK || b.Percentages["copper"] != 70 || b.Percentages["zinc"] != 15 || b.Percentages["nickel"] != 15 {
+		t.Errorf("balanced black bronze = %d %+v", rec.Code, b)
+	}
+	var e ErrorResponse
+	rec = do(t, "POST", "/balance", `{"alloy_id": "black_bronze", "pinned": {"copper": 20}}`, &e)
+	if rec.Code != http.StatusUnprocessableEntity || e.AlloyID != "black_bronze" {
+		t.Errorf("copper 20%% = %d %+v, want 422", rec.Code, e)
+	}
+}
+
+func TestDocuments(t *testing.T) {
+	rec := do(t, "GET", "/openapi.yaml", "", nil)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Body.String(), "openapi: 3") {
+		t.Errorf("GET /openapi.yaml = %d %.40q", rec.Code, rec.Body.String())
+	}
+	var schema map[string]any
+	if rec := do(t, "GET", "/schema.json", "", &schema); rec.Code != http.StatusOK || schema["$id"] != "urn:tfccalc:report:1" {
+		t.Errorf("GET /schema.json = %d, $id %v", rec.Code, schema["$id"])
+	}
+	if rec := do(t, "DELETE", "/alloys", "", nil); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE /alloys = %d, want 405", rec.Code)
+	}
+}
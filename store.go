@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+
+	"tfccalc/config"
+	"tfccalc/data"
+	"tfccalc/datapack"
+)
+
+// openStore opens the backend selected by cfg and applies the datapack, if any.
+// The returned function releases the store and must be called when done.
+func openStore(cfg *config.Config) (data.RecipeStore, func(), error) {
+	store, err := openBackend(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	closeStore := func() {
+		if c, ok := store.(io.Closer); ok {
+			c.Close()
+		}
+	}
+	if s, ok := store.(*data.SQLStore); ok {
+		s.SetCacheTTL(cfg.CacheTTL)
+	}
+	if cfg.Datapack != "" {
+		imported, report, err := datapack.Import(context.Background(), cfg.Datapack, store)
+		if err != nil {
+			closeStore()
+			return nil, nil, err
+		}
+		logImportReport(cfg.Datapack, report)
+		return imported, closeStore, nil
+	}
+	return store, closeStore, nil
+}
+
+// openBackend opens the store named by cfg.ResolvedBackend.
+func openBackend(cfg *config.Config) (data.RecipeStore, error) {
+	switch backend := cfg.ResolvedBackend(); backend {
+	case config.BackendRecipes:
+		return data.NewFileStore(cfg.Recipes)
+	case config.BackendMySQL:
+		return data.NewMySQLStore(cfg.MySQLDSN())
+	case config.BackendSQLite:
+		return data.NewSQLiteStore(cfg.SQLite)
+	default:
+		return nil, fmt.Errorf("unknown backend %q", backend)
+	}
+}
+
+// logImportReport logs what a datapack import did, including everything it had to skip.
+func logImportReport(packPath string, report *datapack.Report) {
+	log.Printf("Datapack %s: imported %d alloy recipes %v", packPath, len(report.Imported), report.Imported)
+	if len(report.Catalog) > 0 {
+		log.Printf("Datapack %s: read %d materials from its tfccalc catalog", packPath, len(report.Catalog))
+	}
+	if len(report.NewBases) > 0 {
+		log.Printf("Datapack %s: added base metals %v", packPath, report.NewBases)
+	}
+	for _, m := range report.Unclassified {
+		log.Printf("Warning: datapack metal %s is neither a known base metal nor an alloy (used by %v)", m.ID, m.UsedBy)
+	}
+	for _, s := range report.Skipped {
+		log.Printf("Warning: skipped datapack recipe %s: %s", s.Path, s.Reason)
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"tfccalc/tui"
+)
+
+// runTUI implements "tfccalc tui": the calculator full-screen in the terminal.
+func runTUI(args []string) {
+	fs := flag.NewFlagSet("tui", flag.ExitOnError)
+	cfg := loadConfig(fs, args)
+
+	store, closeStore, err := openStore(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize DB: %v", err)
+	}
+	err = tui.Run(context.Background(), store, cfg.UI, os.Stdin, os.Stdout)
+	closeStore()
+	if err != nil {
+		log.Fatalf("Terminal UI failed: %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package tui
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// fuzzyScore tells whether every character of query appears in text in order,
+// ignoring case, and how good the match is. Consecutive characters and characters
+// at the start of a word score more, so "bb" puts Black Bronze and Bismuth Bronze
+// first. An empty query matches everything with score 0.
+func fuzzyScore(query, text string) (int, bool) {
+	query = strings.ToLower(query)
+	text = strings.ToLower(text)
+	score, pos := 0, 0
+	for n, q := range []rune(query) {
+		i := strings.IndexRune(text[pos:], q)
+		if i < 0 {
+			return 0, false
+		}
+		score++
+		if n > 0 && i == 0 {
+			score += 3
+		}
+		i += pos
+		if i == 0 || !unicode.IsLetter(lastRune(text[:i])) {
+			score += 2
+		}
+		pos = i + utf8.RuneLen(q)
+	}
+	return score, true
+}
+
+func lastRune(s string) rune {
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return r
+}
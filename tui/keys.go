@@ -0,0 +1,98 @@
+package tui
+
+import "unicode/utf8"
+
+// keyKind is what a key press does, apart from the character it types.
+type keyKind int
+
+const (
+	keyRune keyKind = iota // a character, in key.r
+	keyEnter
+	keyTab
+	keyShiftTab
+	keyBackspace
+	keyUp
+	keyDown
+	keyLeft
+	keyRight
+	keyPgUp
+	keyPgDown
+	keyEsc
+	keyCtrlC
+)
+
+// key is one key press read from the terminal.
+type key struct {
+	kind keyKind
+	r    rune
+}
+
+// escapes maps the escape sequences of xterm-like terminals to keys.
+var escapes = map[string]keyKind{
+	"\x1b[A":  keyUp,
+	"\x1b[B":  keyDown,
+	"\x1b[C":  keyRight,
+	"\x1b[D":  keyLeft,
+	"\x1bOA":  keyUp,
+	"\x1bOB":  keyDown,
+	"\x1bOC":  keyRight,
+	"\x1bOD":  keyLeft,
+	"\x1b[Z":  keyShiftTab,
+	"\x1b[5~": keyPgUp,
+	"\x1b[6~": keyPgDown,
+}
+
+// parseKeys splits what one read from a raw terminal returned into key presses.
+// Escape sequences it does not know are dropped; a lone ESC is keyEsc.
+func parseKeys(b []byte) []key {
+	var keys []key
+	for len(b) > 0 {
+		switch c := b[0]; {
+		case c == 0x1b:
+			if len(b) == 1 {
+				return append(keys, key{kind: keyEsc})
+			}
+			n := escapeLen(b)
+			if kind, ok := escapes[string(b[:n])]; ok {
+				keys = append(keys, key{kind: kind})
+			}
+			b = b[n:]
+			continue
+		case c == '\r' || c == '\n':
+			keys = append(keys, key{kind: keyEnter})
+		case c == '\t':
+			keys = append(keys, key{kind: keyTab})
+		case c == 0x7f || c == 0x08:
+			keys = append(keys, key{kind: keyBackspace})
+		case c == 0x03:
+			keys = append(keys, key{kind: keyCtrlC})
+		case c < 0x20:
+			// other control characters do nothing
+		default:
+			r, size := utf8.DecodeRune(b)
+			keys = append(keys, key{kind: keyRune, r: r})
+			b = b[size:]
+			continue
+		}
+		b = b[1:]
+	}
+	return keys
+}
+
+// escapeLen returns the length of the escape sequence at the start of b: ESC, then
+// "[" and parameters up to a final letter or "~", or "O" and one letter. ESC followed
+// by anything else is a lone ESC.
+func escapeLen(b []byte) int {
+	switch b[1] {
+	case 'O':
+		return min(3, len(b))
+	case '[':
+		for i := 2; i < len(b); i++ {
+			if c := b[i]; c >= 0x40 && c <= 0x7e {
+				return i + 1
+			}
+		}
+		return len(b)
+	}
+	return 1
+}
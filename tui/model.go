@@ -0,0 +1,534 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"tfccalc/calculator"
+	"tfccalc/config"
+	"tfccalc/data"
+	"unicode/utf8"
+)
+
+// focus is the control that gets the keys.
+type focus int
+
+const (
+	focusAlloy       focus = iota // search field and alloy list
+	focusAmount                   // amount field
+	focusMode                     // mB / Ingots
+	focusExact                    // exact arithmetic
+	focusPercentages              // percentage editor
+	focusCalculate                // Calculate button
+	focusCount
+)
+
+// section is the percentage editor of one alloy, or of one place it is used, like a
+// “Configure: <Name>” item of the window's accordion.
+type section struct {
+	key     string // alloy ID, or the path of a node (see calculator.Calculate)
+	title   string
+	alloy   data.AlloyInfo
+	open    bool
+	entries []*entry
+	hint    string // why the typed values cannot be balanced, or ""
+}
+
+// entry is the percentage of one ingredient. text is what the user typed; while it
+// is blank the entry shows placeholder, the value it will get.
+type entry struct {
+	ing         data.IngredientInfo
+	name        string
+	text        string
+	placeholder string
+}
+
+// row is a line of the percentage editor: the header of sections[sec] if ent < 0,
+// otherwise entry ent of it.
+type row struct{ sec, ent int }
+
+// model is the state of the terminal UI. update changes it for a key press and view
+// draws it; neither touches the terminal.
+type model struct {
+	ctx   context.Context
+	store data.RecipeStore
+	calc  *calculator.Calculator
+
+	alloys    []data.AlloyInfo // alloys and final steels, sorted by name
+	query     string
+	matches   []int // indexes into alloys that match query, best first
+	highlight int   // index into matches
+	alloyID   string
+
+	amount string
+	mode   string // "mB" or "Ingots"
+	exact  bool
+
+	sections []*section
+	cursor   int // index into rows()
+
+	focus   focus
+	status  string
+	tree    []calculator.TreeLine
+	summary [][]string // name, mB, Ingots per base material
+	scroll  int        // first line of the results panel that is shown
+
+	width, height int
+}
+
+// newModel loads the alloys of store and fills in prefs like the window does.
+func newModel(ctx context.Context, store data.RecipeStore, prefs config.UI) (*model, error) {
+	all, err := store.GetAllAlloys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load alloys: %w", err)
+	}
+	m := &model{
+		ctx:    ctx,
+		store:  store,
+		calc:   calculator.New(store),
+		mode:   prefs.Mode,
+		status: "Enter data and press Calculate.",
+		width:  80,
+		height: 24,
+	}
+	for _, alloy := range all {
+		if alloy.Type == "alloy" || alloy.Type == "final_steel" {
+			m.alloys = append(m.alloys, alloy)
+		}
+	}
+	sort.Slice(m.alloys, func(i, j int) bool { return m.alloys[i].Name < m.alloys[j].Name })
+	m.filter()
+	if m.mode != "mB" {
+		m.mode = "Ingots"
+	}
+	if prefs.Amount > 0 {
+		m.amount = strconv.FormatFloat(prefs.Amount, 'f', -1, 64)
+	}
+	if prefs.Alloy != "" {
+		if alloy, ok := all[prefs.Alloy]; ok && (alloy.Type == "alloy" || alloy.Type == "final_steel") {
+			m.selectAlloy(prefs.Alloy)
+		} else {
+			m.status = fmt.Sprintf("Configured alloy %q is not available.", prefs.Alloy)
+		}
+	}
+	return m, nil
+}
+
+// update applies a key press and reports whether the user asked to quit.
+func (m *model) update(k key) bool {
+	switch k.kind {
+	case keyCtrlC, keyEsc:
+		return true
+	case keyTab:
+		m.moveFocus(1)
+		return false
+	case keyShiftTab:
+		m.moveFocus(-1)
+		return false
+	case keyPgUp:
+		m.scroll = max(m.scroll-m.height/2, 0)
+		return false
+	case keyPgDown:
+		m.scroll += m.height / 2
+		return false
+	}
+
+	switch m.focus {
+	case focusAlloy:
+		m.updateAlloy(k)
+	case focusAmount:
+		switch {
+		case k.kind == keyRune && (k.r >= '0' && k.r <= '9' || k.r == '.'):
+			m.amount += string(k.r)
+		case k.kind == keyBackspace:
+			m.amount = dropLast(m.amount)
+		case k.kind == keyEnter:
+			m.calculate()
+		}
+	case focusMode:
+		switch {
+		case k.kind == keyLeft || k.kind == keyRight || k.kind == keyRune && k.r == ' ':
+			if m.mode == "mB" {
+				m.mode = "Ingots"
+			} else {
+				m.mode = "mB"
+			}
+		case k.kind == keyEnter:
+			m.calculate()
+		}
+	case focusExact:
+		switch {
+		case k.kind == keyRune && k.r == ' ':
+			m.setExact(!m.exact)
+		case k.kind == keyEnter:
+			m.calculate()
+		}
+	case focusPercentages:
+		m.updatePercentages(k)
+	case focusCalculate:
+		if k.kind == keyEnter || k.kind == keyRune && k.r == ' ' {
+			m.calculate()
+		}
+	}
+	return false
+}
+
+// moveFocus moves the focus by step controls, skipping the percentage editor when
+// the alloy has none.
+func (m *model) moveFocus(step int) {
+	m.focus = (m.focus + focus(step) + focusCount) % focusCount
+	if m.focus == focusPercentages && len(m.sections) == 0 {
+		m.focus = (m.focus + focus(step) + focusCount) % focusCount
+	}
+}
+
+func (m *model) updateAlloy(k key) {
+	switch k.kind {
+	case keyRune:
+		m.query += string(k.r)
+		m.filter()
+	case keyBackspace:
+		m.query = dropLast(m.query)
+		m.filter()
+	case keyUp:
+		m.highlight = max(m.highlight-1, 0)
+	case keyDown:
+		m.highlight = min(m.highlight+1, max(len(m.matches)-1, 0))
+	case keyEnter:
+		if len(m.matches) > 0 {
+			m.selectAlloy(m.alloys[m.matches[m.highlight]].ID)
+			m.focus = focusAmount
+		}
+	}
+}
+
+// filter lists the alloys whose name or ID matches query, best match first.
+func (m *model) filter() {
+	type match struct{ i, score int }
+	var found []match
+	for i, alloy := range m.alloys {
+		score, ok := fuzzyScore(m.query, alloy.Name)
+		if s, okID := fuzzyScore(m.query, alloy.ID); okID && (!ok || s > score) {
+			score, ok = s, true
+		}
+		if ok {
+			found = append(found, match{i, score})
+		}
+	}
+	sort.SliceStable(found, func(a, b int) bool { return found[a].score > found[b].score })
+	m.matches = m.matches[:0]
+	for _, f := range found {
+		m.matches = append(m.matches, f.i)
+	}
+	m.highlight = 0
+}
+
+func (m *model) setExact(on bool) {
+	m.exact = on
+	if on {
+		m.calc = calculator.NewExact(m.store)
+	} else {
+		m.calc = calculator.New(m.store)
+	}
+}
+
+// selectAlloy makes id the target, rebuilds the percentage editor for it and clears
+// the results.
+func (m *model) selectAlloy(id string) {
+	if id == m.alloyID {
+		return
+	}
+	m.alloyID = id
+	m.sections = nil
+	m.cursor = 0
+	m.tree, m.summary, m.scroll = nil, nil, 0
+	m.status = "Select amount and mode, then press Calculate."
+	err := m.addSections(id, make(map[string]bool))
+	if err == nil {
+		err = m.addPathSections(id)
+	}
+	if err != nil {
+		m.status = fmt.Sprintf("Error loading percentage settings:\n%v", err)
+	}
+	if len(m.sections) > 0 {
+		m.sections[0].open = true
+	}
+}
+
+// inputsOf returns the alloy whose percentages configure id: a final steel's raw
+// form, otherwise id itself.
+func (m *model) inputsOf(id string) (data.AlloyInfo, error) {
+	alloy, err := m.store.GetAlloyByID(m.ctx, id)
+	if err != nil || alloy.Type != "final_steel" {
+		return alloy, err
+	}
+	return m.store.GetAlloyByID(m.ctx, alloy.RawFormID.String)
+}
+
+// addSections walks the alloy → ingredients graph like the window's
+// buildAccordionItemsRecursive and adds a section for every alloy or raw steel
+// with ingredients. It uses visited to avoid cycles.
+func (m *model) addSections(id string, visited map[string]bool) error {
+	alloy, err := m.inputsOf(id)
+	if err != nil {
+		return err
+	}
+	if visited[alloy.ID] || len(alloy.Ingredients) == 0 {
+		return nil
+	}
+	visited[alloy.ID] = true
+
+	sec, err := m.newSection(alloy.ID, alloy, "Configure: "+alloy.Name)
+	if err != nil {
+		return err
+	}
+	m.sections = append(m.sections, sec)
+
+	for _, ing := range alloy.Ingredients {
+		next, err := m.inputsOf(ing.IngredientID)
+		if err != nil {
+			return err
+		}
+		if (next.Type == "alloy" || next.Type == "raw_steel") && len(next.Ingredients) > 0 {
+			if err := m.addSections(next.ID, visited); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// addPathSections adds a “Configure: <Name> in <path>” section for every place an
+// alloy of the targetID tree is used, if it is used in more than one place, like
+// the window's appendPathItems. Their keys are the nodes' paths.
+func (m *model) addPathSections(targetID string) error {
+	res, err := m.calc.Calculate(m.ctx, targetID, 100, "mB", nil)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	paths := make(map[string][]*calculator.Node)
+	res.Root.Walk(func(node, _ *calculator.Node, _ int) {
+		if node.Percentages == nil || node.MaterialID == "steel" {
+			return
+		}
+		if paths[node.MaterialID] == nil {
+			ids = append(ids, node.MaterialID)
+		}
+		paths[node.MaterialID] = append(paths[node.MaterialID], node)
+	})
+	for _, id := range ids {
+		if len(paths[id]) < 2 {
+			continue
+		}
+		alloy, err := m.store.GetAlloyByID(m.ctx, id)
+		if err != nil {
+			return err
+		}
+		for _, node := range paths[id] {
+			parents := strings.Split(node.Path, "/")
+			names := make([]string, len(parents)-1)
+			for i, parent := range parents[:len(parents)-1] {
+				names[i] = data.GetAlloyNameByID(m.ctx, m.store, parent)
+			}
+			sec, err := m.newSection(node.Path, alloy, fmt.Sprintf("Configure: %s in %s", alloy.Name, strings.Join(names, " › ")))
+			if err != nil {
+				return err
+			}
+			m.autoFill(sec)
+			m.sections = append(m.sections, sec)
+		}
+	}
+	return nil
+}
+
+// newSection returns a section for key with an entry per ingredient of alloy,
+// showing the defaults.
+func (m *model) newSection(key string, alloy data.AlloyInfo, title string) (*section, error) {
+	defaults, err := m.calc.GetDefaultPercentages(m.ctx, alloy.ID)
+	if err != nil {
+		return nil, err
+	}
+	sec := &section{key: key, title: title, alloy: alloy}
+	for _, ing := range alloy.Ingredients {
+		sec.entries = append(sec.entries, &entry{
+			ing:         ing,
+			name:        data.GetAlloyNameByID(m.ctx, m.store, ing.IngredientID),
+			placeholder: fmt.Sprintf("%.1f", defaults[ing.IngredientID]),
+		})
+	}
+	return sec, nil
+}
+
+// rows returns the lines of the percentage editor: every header, and the entries
+// of the open sections.
+func (m *model) rows() []row {
+	var rows []row
+	for i, sec := range m.sections {
+		rows = append(rows, row{i, -1})
+		if sec.open {
+			for j := range sec.entries {
+				rows = append(rows, row{i, j})
+			}
+		}
+	}
+	return rows
+}
+
+func (m *model) updatePercentages(k key) {
+	rows := m.rows()
+	m.cursor = min(m.cursor, len(rows)-1)
+	r := rows[m.cursor]
+	sec := m.sections[r.sec]
+	switch {
+	case k.kind == keyUp:
+		m.cursor = max(m.cursor-1, 0)
+	case k.kind == keyDown:
+		m.cursor = min(m.cursor+1, len(rows)-1)
+	case r.ent < 0 && (k.kind == keyEnter || k.kind == keyRune && k.r == ' '):
+		sec.open = !sec.open
+	case r.ent < 0 && k.kind == keyLeft:
+		sec.open = false
+	case r.ent < 0 && k.kind == keyRight:
+		sec.open = true
+	case r.ent >= 0 && k.kind == keyRune && (k.r >= '0' && k.r <= '9' || k.r == '.'):
+		sec.entries[r.ent].text += string(k.r)
+		m.autoFill(sec)
+	case r.ent >= 0 && k.kind == keyBackspace:
+		sec.entries[r.ent].text = dropLast(sec.entries[r.ent].text)
+		m.autoFill(sec)
+	case r.ent >= 0 && k.kind == keyEnter:
+		m.calculate()
+	}
+}
+
+// pinned returns the percentages typed into sec, skipping blank entries. Entries
+// that are not numbers are returned as errors.
+func (m *model) pinned(sec *section) (map[string]float64, []string) {
+	pinned := make(map[string]float64)
+	var problems []string
+	for _, e := range sec.entries {
+		if e.text == "" {
+			continue
+		}
+		val, err := strconv.ParseFloat(e.text, 64)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("Invalid %% for %s in %s", e.name, sec.alloy.Name))
+			continue
+		}
+		pinned[e.ing.IngredientID] = val
+	}
+	return pinned, problems
+}
+
+// autoFill balances sec around the typed entries (calc.BalancePercentages) and
+// shows the result as the placeholders of the blank ones, or in hint why it cannot.
+// The entries of a path that are all blank stand for the alloy's own section and
+// stay blank.
+func (m *model) autoFill(sec *section) {
+	pinned, problems := m.pinned(sec)
+	if len(problems) > 0 {
+		sec.hint = strings.Join(problems, "; ")
+		return
+	}
+	if sec.key != sec.alloy.ID && len(pinned) == 0 {
+		for _, e := range sec.entries {
+			e.placeholder = ""
+		}
+		sec.hint = fmt.Sprintf("Leave blank to use the %s settings above.", sec.alloy.Name)
+		return
+	}
+	balanced, err := m.calc.BalancePercentages(m.ctx, sec.alloy.ID, pinned)
+	if err != nil {
+		sec.hint = err.Error()
+		return
+	}
+	for _, e := range sec.entries {
+		if e.text == "" {
+			e.placeholder = fmt.Sprintf("%.1f", balanced[e.ing.IngredientID])
+		}
+	}
+	sec.hint = ""
+}
+
+// collectPercentages returns the balanced percentages of every section the user
+// typed something into, keyed by alloy ID or path as calc.Calculate takes them.
+func (m *model) collectPercentages() (map[string]map[string]float64, []string) {
+	var perc map[string]map[string]float64
+	var problems []string
+	for _, sec := range m.sections {
+		pinned, bad := m.pinned(sec)
+		if len(bad) > 0 {
+			problems = append(problems, bad...)
+			continue
+		}
+		if len(pinned) == 0 {
+			continue
+		}
+		balanced, err := m.calc.BalancePercentages(m.ctx, sec.alloy.ID, pinned)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("Error in %% for %s: %v", sec.alloy.Name, err))
+			continue
+		}
+		if perc == nil {
+			perc = make(map[string]map[string]float64)
+		}
+		perc[sec.key] = balanced
+	}
+	return perc, problems
+}
+
+// calculate runs the calculation and fills in the status, the tree and the summary.
+func (m *model) calculate() {
+	m.tree, m.summary, m.scroll = nil, nil, 0
+	if m.alloyID == "" {
+		m.status = "Error: Alloy not selected."
+		return
+	}
+	amt, err := strconv.ParseFloat(m.amount, 64)
+	if err != nil || amt <= 0 {
+		m.status = "Error: Enter a valid positive amount."
+		return
+	}
+	perc, problems := m.collectPercentages()
+	if len(problems) > 0 {
+		m.status = "Percentage errors:\n- " + strings.Join(problems, "\n- ")
+		return
+	}
+	result, err := m.calc.Calculate(m.ctx, m.alloyID, amt, m.mode, perc)
+	if err != nil {
+		m.status = fmt.Sprintf("Calculation error:\n%v", err)
+		return
+	}
+
+	m.status = fmt.Sprintf("Calculation result for %s %.2f %s:",
+		data.GetAlloyNameByID(m.ctx, m.store, m.alloyID), amt, m.mode)
+	if len(result.Warnings) > 0 {
+		m.status += "\nWarnings:\n- " + strings.Join(result.Warnings, "\n- ")
+	}
+	m.tree = result.Root.Lines()
+	m.summary = m.summaryRows(result.TotalMB)
+}
+
+// summaryRows returns a row of name, mB and Ingots for every base material,
+// sorted by name.
+func (m *model) summaryRows(totalMB map[string]float64) [][]string {
+	var rows [][]string
+	for id, mB := range totalMB {
+		rows = append(rows, []string{
+			data.GetAlloyNameByID(m.ctx, m.store, id),
+			fmt.Sprintf("%.2f", mB),
+			fmt.Sprintf("%.3f", mB/100.0),
+		})
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i][0] < rows[j][0] })
+	return rows
+}
+
+// dropLast returns s without its last character.
+func dropLast(s string) string {
+	_, size := utf8.DecodeLastRuneInString(s)
+	return s[:len(s)-size]
+}
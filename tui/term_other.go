@@ -0,0 +1,30 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package tui
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+func makeRaw(fd int) (func(), error) {
+	return nil, errors.New("the terminal UI needs a Unix terminal")
+}
+
+func termSize(fd int) (int, int) {
+	return 80, 24
+}
+
+// readable reports that input may be there; the terminal UI does not get this far
+// without a Unix terminal.
+func readable(fd int, timeout time.Duration) (bool, error) {
+	return true, nil
+}
+
+// notifyResize returns a channel that never receives.
+func notifyResize() chan os.Signal {
+	return nil
+}
+
+func stopResize(c chan os.Signal) {}
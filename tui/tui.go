@@ -0,0 +1,107 @@
+// Package tui is a full-screen terminal front end of tfccalc for SSH sessions. It
+// has the layout of the window: an alloy list with fuzzy search, amount and mode,
+// a collapsible percentage editor per alloy and per path, and the breakdown tree
+// (in the colors of the window's tree) and summary table.
+//
+// It follows the model/update/view pattern of Bubble Tea without depending on it:
+// model holds the state, update applies a key press, and view draws the screen as
+// a string, so everything but Run works without a terminal.
+package tui
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"tfccalc/config"
+	"tfccalc/data"
+	"time"
+)
+
+// Run shows the terminal UI on the terminal of in and out until the user quits or
+// ctx is done. prefs sets the initial mode, alloy and amount, as for the window.
+func Run(ctx context.Context, store data.RecipeStore, prefs config.UI, in, out *os.File) error {
+	m, err := newModel(ctx, store, prefs)
+	if err != nil {
+		return err
+	}
+	restore, err := makeRaw(int(in.Fd()))
+	if err != nil {
+		return fmt.Errorf("cannot set up the terminal: %w", err)
+	}
+	defer restore()
+
+	w := bufio.NewWriter(out)
+	// Alternate screen, hidden cursor; undone on the way out.
+	w.WriteString("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		w.WriteString("\x1b[?25h\x1b[?1049l")
+		w.Flush()
+	}()
+
+	// The reader polls so that it notices done; it is stopped before the terminal
+	// leaves raw mode, so nothing reads the terminal after Run returns.
+	keys := make(chan []byte, 16)
+	readErr := make(chan error, 1)
+	done := make(chan struct{})
+	var reader sync.WaitGroup
+	reader.Add(1)
+	go func() {
+		defer reader.Done()
+		fd := int(in.Fd())
+		buf := make([]byte, 256)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			ok, err := readable(fd, 100*time.Millisecond)
+			if err == nil && ok {
+				var n int
+				n, err = in.Read(buf)
+				if err == nil {
+					select {
+					case keys <- append([]byte(nil), buf[:n]...):
+					case <-done:
+						return
+					}
+				}
+			}
+			if err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+	defer func() {
+		close(done)
+		reader.Wait()
+	}()
+	resized := notifyResize()
+	defer stopResize(resized)
+
+	for {
+		m.width, m.height = termSize(int(out.Fd()))
+		w.WriteString("\x1b[H")
+		w.WriteString(m.view())
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		select {
+		case b := <-keys:
+			for _, k := range parseKeys(b) {
+				if m.update(k) {
+					return nil
+				}
+			}
+		case <-resized:
+			w.WriteString("\x1b[2J")
+		case err := <-readErr:
+			return err
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
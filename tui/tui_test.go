@@ -0,0 +1,187 @@
+package tui
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"tfccalc/config"
+	"tfccalc/data"
+)
+
+var ctx = context.Background()
+
+// newTestModel returns a model on the default catalog with a 120×60 screen.
+func newTestModel(t *testing.T, prefs config.UI) *model {
+	t.Helper()
+	m, err := newModel(ctx, data.NewMemoryStore(data.DefaultAlloys()), prefs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.width, m.height = 120, 60
+	return m
+}
+
+// typeKeys feeds the terminal input s to m.
+func typeKeys(m *model, s string) {
+	for _, k := range parseKeys([]byte(s)) {
+		m.update(k)
+	}
+}
+
+var sgr = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// screen returns what view draws, without colors.
+func screen(m *model) string {
+	return sgr.ReplaceAllString(m.view(), "")
+}
+
+func TestParseKeys(t *testing.T) {
+	got := parseKeys([]byte("a\x1b[A\x1b[Z\x1b[6~é\r\x7f\t\x03\x1b"))
+	want := []key{{keyRune, 'a'}, {kind: keyUp}, {kind: keyShiftTab}, {kind: keyPgDown}, {keyRune, 'é'},
+		{kind: keyEnter}, {kind: keyBackspace}, {kind: keyTab}, {kind: keyCtrlC}, {kind: keyEsc}}
+	if len(got) != len(want) {
+		t.Fatalf("parseKeys = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("key %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestFuzzySearch(t *testing.T) {
+	m := newTestModel(t, config.UI{Mode: "Ingots"})
+	typeKeys(m, "bb")
+	var names []string
+	for _, i := range m.matches {
+		names = append(names, m.alloys[i].Name)
+	}
+	if len(names) < 2 || !strings.Contains(names[0]+names[1], "Black Bronze") || !strings.Contains(names[0]+names[1], "Bismuth Bronze") {
+		t.Errorf("matches for bb = %v, want the bronzes first", names)
+	}
+	typeKeys(m, "zz")
+	if len(m.matches) != 0 || !strings.Contains(screen(m), "(no match)") {
+		t.Errorf("matches for bbzz = %v", m.matches)
+	}
+}
+
+func TestCalculate(t *testing.T) {
+	m := newTestModel(t, config.UI{Mode: "Ingots"})
+	// Pick black bronze, 10 ingots, copper at 66%.
+	typeKeys(m, "black bron\r10\t\t\t")
+	if m.alloyID != "black_bronze" || m.focus != focusPercentages || len(m.sections) != 1 {
+		t.Fatalf("alloy %q, focus %d, %d sections", m.alloyID, m.focus, len(m.sections))
+	}
+	typeKeys(m, "\x1b[B66")
+	if e := m.sections[0].entries[1]; e.placeholder != "17.0" {
+		t.Errorf("zinc placeholder %q after copper 66, want the balanced 17.0", e.placeholder)
+	}
+	typeKeys(m, "\r")
+
+	out := screen(m)
+	for _, want := range []string{
+		"Calculation result for Black Bronze 10.00 Ingots:",
+		"└── Black Bronze (1000.00mB | 10.000Ing)",
+		"    ├── Copper (660.00mB | 6.600Ing)",
+		"Copper        660.00       6.600",
+		"Copper [50–70%]:     66",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("screen does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestTreeColors(t *testing.T) {
+	m := newTestModel(t, config.UI{Mode: "mB", Alloy: "blue_steel", Amount: 100})
+	m.calculate()
+	if len(m.tree) < 3 {
+		t.Fatalf("tree has %d lines", len(m.tree))
+	}
+	// The grandchild line: a bar in the color of depth 1, the node in that of depth 2.
+	ln := treeLine(m.tree[2])
+	if ln[1].text != "│   " || ln[1].sgr != palette[1] || ln[2].sgr != palette[2] {
+		t.Errorf("line %q = %+v", m.tree[2].Node.Label(), ln)
+	}
+	if !strings.Contains(m.view(), "\x1b["+palette[0]+"m└── Blue Steel") {
+		t.Error("root is not drawn in the first palette color")
+	}
+}
+
+func TestPercentageEditor(t *testing.T) {
+	m := newTestModel(t, config.UI{Mode: "Ingots", Alloy: "blue_steel", Amount: 1})
+	var keys []string
+	for _, sec := range m.sections {
+		keys = append(keys, sec.key)
+	}
+	// One section per alloy, then one per place of the alloys used in two places.
+	want := "raw_blue_steel,raw_black_steel,black_bronze,bismuth_bronze,sterling_silver," +
+		"blue_steel/raw_blue_steel/black_steel/raw_black_steel,blue_steel/black_steel/raw_black_steel," +
+		"blue_steel/raw_blue_steel/black_steel/raw_black_steel/black_bronze,blue_steel/black_steel/raw_black_steel/black_bronze"
+	if got := strings.Join(keys, ","); got != want {
+		t.Errorf("sections = %s, want %s", got, want)
+	}
+	if path := m.sections[5]; path.title != "Configure: Raw Black Steel in Blue Steel › Raw Blue Steel › Black Steel" ||
+		path.entries[0].placeholder != "" || !strings.HasPrefix(path.hint, "Leave blank") {
+		t.Errorf("path section = %+v", path)
+	}
+	if !m.sections[0].open || m.sections[1].open {
+		t.Error("only the first section should start open")
+	}
+
+	m.focus = focusPercentages
+	typeKeys(m, "\x1b[B99")
+	if !strings.Contains(m.sections[0].hint, "outside") && !strings.Contains(m.sections[0].hint, "maximum") {
+		t.Errorf("hint for black steel 99%% = %q", m.sections[0].hint)
+	}
+	m.calculate()
+	if !strings.HasPrefix(m.status, "Percentage errors:") || m.tree != nil {
+		t.Errorf("status = %q", m.status)
+	}
+
+	// Collapse the first section and open the second.
+	typeKeys(m, "\x1b[A\r\x1b[B ")
+	if m.sections[0].open || !m.sections[1].open {
+		t.Error("headers did not toggle")
+	}
+}
+
+func TestPathOverride(t *testing.T) {
+	m := newTestModel(t, config.UI{Mode: "Ingots", Alloy: "blue_steel", Amount: 1})
+	// Steel at 70% in the raw black steel inside raw blue steel only.
+	inner := m.sections[5]
+	for _, e := range inner.entries {
+		if e.ing.IngredientID == "steel" {
+			e.text = "70"
+		}
+	}
+	m.autoFill(inner)
+	if inner.hint != "" {
+		t.Fatalf("hint = %q", inner.hint)
+	}
+	m.calculate()
+	if strings.Contains(m.status, "Warnings") || m.tree == nil {
+		t.Fatalf("status = %q", m.status)
+	}
+	var steel []float64
+	for _, l := range m.tree {
+		if l.Node.MaterialID == "raw_black_steel" {
+			steel = append(steel, l.Node.Percentages["steel"])
+		}
+	}
+	if len(steel) != 2 || steel[0] != 70 || steel[1] == 70 {
+		t.Errorf("steel in the raw black steels = %v, want 70 in the inner one only", steel)
+	}
+}
+
+func TestNotAvailable(t *testing.T) {
+	m := newTestModel(t, config.UI{Mode: "Ingots", Alloy: "copper"})
+	if m.alloyID != "" || !strings.Contains(m.status, `"copper" is not available`) {
+		t.Errorf("alloy %q, status %q", m.alloyID, m.status)
+	}
+	m.calculate()
+	if m.status != "Error: Alloy not selected." {
+		t.Errorf("status = %q", m.status)
+	}
+}
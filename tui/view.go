@@ -0,0 +1,291 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"tfccalc/calculator"
+	"unicode/utf8"
+)
+
+// palette holds the colors of the window's tree (palette in ui/tree_renderer.go) as
+// 24-bit SGR parameters, cycled by depth.
+var palette = []string{
+	"38;2;255;102;102", // Light Red
+	"38;2;102;255;102", // Light Green
+	"38;2;102;178;255", // Light Blue
+	"38;2;255;255;102", // Light Yellow
+	"38;2;255;153;255", // Light Pink
+	"38;2;153;255;255", // Light Cyan
+}
+
+// SGR parameters of the other styles.
+const (
+	styleBold    = "1"
+	styleDim     = "2"
+	styleReverse = "7"
+	styleHint    = "38;2;255;179;102"
+)
+
+// seg is a run of text in one style; sgr is "" for the default style.
+type seg struct{ text, sgr string }
+
+// line is one line of the screen.
+type line []seg
+
+func plain(text string) line       { return line{{text, ""}} }
+func styled(text, sgr string) line { return line{{text, sgr}} }
+
+// render returns l cut or padded with spaces to width columns.
+func (l line) render(width int) string {
+	var b strings.Builder
+	n := 0
+	for _, s := range l {
+		text := s.text
+		if r := utf8.RuneCountInString(text); n+r > width {
+			text = string([]rune(text)[:width-n])
+		}
+		if text == "" {
+			continue
+		}
+		if s.sgr != "" {
+			b.WriteString("\x1b[" + s.sgr + "m" + text + "\x1b[0m")
+		} else {
+			b.WriteString(text)
+		}
+		n += utf8.RuneCountInString(text)
+	}
+	b.WriteString(strings.Repeat(" ", width-n))
+	return b.String()
+}
+
+// listRows is how many alloys the list shows at once.
+const listRows = 8
+
+// view draws the whole screen: a title, the controls on the left and the results on
+// the right as in the window, and a line of key help. It keeps m.scroll within the
+// results.
+func (m *model) view() string {
+	bodyHeight := max(m.height-2, 1)
+	leftWidth := min(max(m.width*35/100, 36), m.width)
+	rightWidth := max(m.width-leftWidth-3, 0)
+
+	left, focusLine := m.leftPanel(leftWidth)
+	leftStart := max(focusLine-bodyHeight+2, 0)
+	right := m.rightPanel(rightWidth)
+	m.scroll = max(min(m.scroll, len(right)-bodyHeight), 0)
+
+	var b strings.Builder
+	b.WriteString(styled(" TFC Alloy Calculator", styleReverse).render(m.width))
+	for i := range bodyHeight {
+		b.WriteString("\r\n")
+		var l, r line
+		if j := leftStart + i; j < len(left) {
+			l = left[j]
+		}
+		if j := m.scroll + i; j < len(right) {
+			r = right[j]
+		}
+		b.WriteString(l.render(leftWidth))
+		if rightWidth > 0 {
+			b.WriteString(styled(" │ ", styleDim).render(3))
+			b.WriteString(r.render(rightWidth))
+		}
+	}
+	b.WriteString("\r\n")
+	b.WriteString(styled(" Tab/Shift+Tab move · Enter select/calculate · Space toggle · PgUp/PgDn scroll · Esc quit", styleDim).render(m.width))
+	return b.String()
+}
+
+// leftPanel returns the lines of the controls, and the index of the line with the
+// focused control so it can be kept on screen.
+func (m *model) leftPanel(w int) ([]line, int) {
+	var lines []line
+	focusLine := 0
+	label := func(text string, f focus) {
+		if m.focus == f {
+			focusLine = len(lines)
+			lines = append(lines, styled(text, styleBold))
+		} else {
+			lines = append(lines, plain(text))
+		}
+	}
+	field := func(f focus, sgr ...string) string {
+		if m.focus == f {
+			sgr = append(sgr, styleReverse)
+		}
+		return strings.Join(sgr, ";")
+	}
+
+	label("Target Alloy:", focusAlloy)
+	search := line{{"Search: ", ""}, {m.query, ""}}
+	if m.focus == focusAlloy {
+		search = append(search, seg{" ", styleReverse})
+	}
+	lines = append(lines, search)
+	if len(m.matches) == 0 {
+		lines = append(lines, styled("  (no match)", styleDim))
+	}
+	first := min(max(m.highlight-listRows/2, 0), max(len(m.matches)-listRows, 0))
+	for i := first; i < min(first+listRows, len(m.matches)); i++ {
+		alloy := m.alloys[m.matches[i]]
+		mark := "  "
+		if alloy.ID == m.alloyID {
+			mark = "● "
+		}
+		sgr := ""
+		if i == m.highlight {
+			sgr = styleBold
+			if m.focus == focusAlloy {
+				sgr = styleReverse
+				focusLine = len(lines)
+			}
+		}
+		lines = append(lines, line{{mark, ""}, {alloy.Name, sgr}})
+	}
+	lines = append(lines, nil)
+
+	label("Amount:", focusAmount)
+	if m.amount == "" {
+		lines = append(lines, line{{"  ", ""}, {"Amount...", field(focusAmount, styleDim)}})
+	} else {
+		lines = append(lines, line{{"  ", ""}, {m.amount, field(focusAmount)}})
+	}
+	label("Mode:", focusMode)
+	radio := func(mode string) string {
+		if m.mode == mode {
+			return "(•) " + mode
+		}
+		return "( ) " + mode
+	}
+	lines = append(lines, line{{"  ", ""}, {radio("mB") + "  " + radio("Ingots"), field(focusMode)}})
+	exact := "[ ] Exact arithmetic"
+	if m.exact {
+		exact = "[x] Exact arithmetic"
+	}
+	if m.focus == focusExact {
+		focusLine = len(lines)
+	}
+	lines = append(lines, line{{exact, field(focusExact)}}, nil)
+
+	label("Percentage Settings:", focusPercentages)
+	switch {
+	case m.alloyID == "":
+		lines = append(lines, styled("  Select an alloy first.", styleDim))
+	case len(m.sections) == 0:
+		lines = append(lines, styled("  No configurable ingredients for this alloy.", styleDim))
+	}
+	for i, r := range m.rows() {
+		sec := m.sections[r.sec]
+		var sgr []string
+		if m.focus == focusPercentages && i == m.cursor {
+			sgr = append(sgr, styleReverse)
+			focusLine = len(lines)
+		}
+		if r.ent < 0 {
+			arrow := "▸ "
+			if sec.open {
+				arrow = "▾ "
+			}
+			lines = append(lines, line{{arrow + sec.title, strings.Join(sgr, ";")}})
+			continue
+		}
+		e := sec.entries[r.ent]
+		value := seg{fmt.Sprintf("%6s", e.text), strings.Join(sgr, ";")}
+		if e.text == "" {
+			value = seg{fmt.Sprintf("%6s", e.placeholder), strings.Join(append(sgr, styleDim), ";")}
+		}
+		labelWidth := 0
+		for _, other := range sec.entries {
+			labelWidth = max(labelWidth, utf8.RuneCountInString(entryLabel(other)))
+		}
+		lines = append(lines, line{{fmt.Sprintf("    %-*s ", labelWidth, entryLabel(e)), ""}, value})
+		if r.ent == len(sec.entries)-1 && sec.hint != "" {
+			for _, text := range wrap(sec.hint, w-4) {
+				lines = append(lines, styled("    "+text, styleHint))
+			}
+		}
+	}
+	lines = append(lines, nil)
+
+	if m.focus == focusCalculate {
+		focusLine = len(lines)
+	}
+	lines = append(lines, line{{"[ Calculate ]", field(focusCalculate)}})
+	return lines, focusLine
+}
+
+// entryLabel returns the label of e with its range, as the window shows it.
+func entryLabel(e *entry) string {
+	return fmt.Sprintf("%s [%.0f–%.0f%%]:", e.name, e.ing.Min, e.ing.Max)
+}
+
+// rightPanel returns the lines of the status, the tree and the summary table.
+func (m *model) rightPanel(w int) []line {
+	var lines []line
+	for _, text := range wrap(m.status, w) {
+		lines = append(lines, plain(text))
+	}
+	lines = append(lines, nil, styled("Calculation Hierarchy:", styleBold))
+	for _, ln := range m.tree {
+		lines = append(lines, treeLine(ln))
+	}
+
+	lines = append(lines, nil, styled("Final Summary (Base Materials):", styleBold))
+	nameWidth := len("Material")
+	for _, r := range m.summary {
+		nameWidth = max(nameWidth, utf8.RuneCountInString(r[0]))
+	}
+	format := fmt.Sprintf("%%-%ds  %%10s  %%10s", nameWidth)
+	lines = append(lines, styled(fmt.Sprintf(format, "Material", "mB", "Ingots"), styleBold))
+	for _, r := range m.summary {
+		lines = append(lines, plain(fmt.Sprintf(format, r[0], r[1], r[2])))
+	}
+	return lines
+}
+
+// treeLine draws ln like RenderLines in ui/tree_renderer.go: “│   ” in the color of
+// each ancestor level that has siblings below, spaces for the others, then the
+// branch and the label in the color of the node's depth.
+func treeLine(ln calculator.TreeLine) line {
+	depth := ln.Depth()
+	var l line
+	for lvl := 0; lvl < depth; lvl++ {
+		if ln.Last[lvl] {
+			l = append(l, seg{"    ", ""})
+		} else {
+			l = append(l, seg{"│   ", palette[lvl%len(palette)]})
+		}
+	}
+	branch := "├── "
+	if ln.IsLast() {
+		branch = "└── "
+	}
+	return append(l, seg{branch + ln.Node.Label(), palette[depth%len(palette)]})
+}
+
+// wrap splits text into lines of at most w columns, breaking at spaces where it
+// can and keeping the line breaks of text.
+func wrap(text string, w int) []string {
+	var lines []string
+	for _, para := range strings.Split(text, "\n") {
+		cur := ""
+		for _, word := range strings.Fields(para) {
+			switch {
+			case cur == "":
+				cur = word
+			case utf8.RuneCountInString(cur)+1+utf8.RuneCountInString(word) <= w:
+				cur += " " + word
+			default:
+				lines = append(lines, cur)
+				cur = word
+			}
+			for w > 0 && utf8.RuneCountInString(cur) > w {
+				r := []rune(cur)
+				lines = append(lines, string(r[:w]))
+				cur = string(r[w:])
+			}
+		}
+		lines = append(lines, cur)
+	}
+	return lines
+}
@@ -0,0 +1,142 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"tfccalc/calculator"
+	"tfccalc/data"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+//
+// The batch panel collects several targets (alloy + amount + percentages) and
+// calculates them together with calculator.CalculateBatch:
+// - buildBatchPanel
+// - addCurrentToBatch, refreshBatchList
+// - calculateBatch, describeShared
+//
+
+// buildBatchPanel returns the “Batch” section of the left panel: the list of targets
+// and the buttons to add, clear and calculate them.
+func buildBatchPanel() fyne.CanvasObject {
+	batchBox = container.NewVBox()
+	batchScroll := container.NewVScroll(batchBox)
+	batchScroll.SetMinSize(fyne.NewSize(0, 100))
+	refreshBatchList()
+
+	addButton := widget.NewButton("Add to Batch", addCurrentToBatch)
+	clearButton := widget.NewButton("Clear Batch", func() {
+		batchTargets = nil
+		refreshBatchList()
+	})
+	calcBatchButton := widget.NewButton("Calculate Batch", calculateBatch)
+
+	return container.NewVBox(
+		widget.NewLabelWithStyle("Batch:", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+		batchScroll,
+		container.NewGridWithColumns(2, addButton, clearButton),
+		calcBatchButton,
+	)
+}
+
+// addCurrentToBatch appends the selected alloy, amount, mode and the percentages
+// entered right now as a new batch target.
+func addCurrentToBatch() {
+	alloyID, amt, mode, ok := readTargetInputs()
+	if !ok {
+		return
+	}
+	userPercs, validationErrors := collectUserPercentages()
+	if len(validationErrors) > 0 {
+		statusLabel.SetText("Percentage errors:\n- " + strings.Join(validationErrors, "\n- "))
+		return
+	}
+	target := calculator.BatchTarget{AlloyID: alloyID, Amount: amt, Mode: mode}
+	if len(userPercs) > 0 {
+		target.Percentages = userPercs
+	}
+	batchTargets = append(batchTargets, target)
+	refreshBatchList()
+	statusLabel.SetText(fmt.Sprintf("Added %s to the batch (%d targets).",
+		data.GetAlloyNameByID(ctx, store, alloyID), len(batchTargets)))
+}
+
+// refreshBatchList redraws batchBox: one row per target with a button to remove it.
+func refreshBatchList() {
+	batchBox.Objects = nil
+	if len(batchTargets) == 0 {
+		batchBox.Add(widget.NewLabel("(empty)"))
+	}
+	for i, t := range batchTargets {
+		idx := i
+		text := fmt.Sprintf("%s: %g %s", data.GetAlloyNameByID(ctx, store, t.AlloyID), t.Amount, t.Mode)
+		if t.Percentages != nil {
+			text += " (custom %)"
+		}
+		remove := widget.NewButton("✕", func() {
+			batchTargets = append(batchTargets[:idx:idx], batchTargets[idx+1:]...)
+			refreshBatchList()
+		})
+		batchBox.Add(container.NewBorder(nil, nil, nil, remove, widget.NewLabel(text)))
+	}
+	batchBox.Refresh()
+}
+
+// calculateBatch calculates all batch targets and shows one tree per target, the
+// per-target and combined totals, and which intermediates are shared.
+func calculateBatch() {
+	if len(batchTargets) == 0 {
+		statusLabel.SetText("Error: The batch is empty. Add targets with “Add to Batch”.")
+		return
+	}
+	statusLabel.SetText("Calculating...")
+	meltLabel.Hide() // the melt plan and build order belong to a single calculation
+	clearProcessingSteps()
+	plan, err := calc.CalculateBatch(ctx, batchTargets)
+	if err != nil {
+		statusLabel.SetText(fmt.Sprintf("Calculation error:\n%v", err))
+		hierarchyContainer.Objects = nil
+		hierarchyContainer.Refresh()
+		summaryData = [][]string{{"Material", "mB", "Ingots"}}
+		summaryTable.Refresh()
+		return
+	}
+
+	var roots []*calculator.Node
+	for _, t := range plan.Targets {
+		roots = append(roots, t.Result.Root)
+	}
+	hierarchyContainer.Objects = RenderLines(calculator.TreeLines(roots...)).Objects
+	hierarchyContainer.Refresh()
+
+	status := fmt.Sprintf("Batch result for %d targets:", len(plan.Targets))
+	if shared := describeShared(plan); len(shared) > 0 {
+		status += "\nShared intermediates (make them in one go):\n- " + strings.Join(shared, "\n- ")
+	}
+	statusLabel.SetText(status)
+	UpdateBatchSummaryData(plan, summaryTable)
+}
+
+// describeShared returns one line per shared intermediate, e.g.
+// “Steel 1250.00 mB: target, Raw Black Steel (Black Steel), Raw Blue Steel (Blue Steel)”.
+func describeShared(plan *calculator.BatchPlan) []string {
+	var lines []string
+	for _, s := range plan.Shared {
+		var uses []string
+		for _, u := range s.Uses {
+			if u.ParentID == "" {
+				uses = append(uses, "target")
+				continue
+			}
+			uses = append(uses, fmt.Sprintf("%s (%s)",
+				data.GetAlloyNameByID(ctx, store, u.ParentID),
+				data.GetAlloyNameByID(ctx, store, plan.Targets[u.Target].Target.AlloyID)))
+		}
+		lines = append(lines, fmt.Sprintf("%s %.2f mB: %s",
+			data.GetAlloyNameByID(ctx, store, s.ID), s.TotalMB, strings.Join(uses, ", ")))
+	}
+	return lines
+}
@@ -0,0 +1,89 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"tfccalc/calculator"
+	"tfccalc/data"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/widget"
+)
+
+//
+// The “Container” selector and the melt plan shown under the status label:
+// - buildContainerSelect
+// - showMeltPlan, formatMeltPlan
+//
+
+// noContainer is the selector option that turns melt planning off.
+const noContainer = "None"
+
+// buildContainerSelect returns the Select listing noContainer and the container
+// presets of the calculator, with noContainer selected.
+func buildContainerSelect() *widget.Select {
+	options := []string{noContainer}
+	containers = make(map[string]calculator.Container)
+	for _, c := range calculator.Containers() {
+		label := fmt.Sprintf("%s (%.0f mB)", c.Name, c.CapacityMB)
+		options = append(options, label)
+		containers[label] = c
+	}
+	sel := widget.NewSelect(options, nil)
+	sel.SetSelected(noContainer)
+	return sel
+}
+
+// showMeltPlan fills meltLabel with the melt plan for the calculated target, or
+// hides it if no container is selected.
+func showMeltPlan(alloyID string, amount float64, mode string, percMap map[string]map[string]float64) {
+	container, ok := containers[containerSelect.Selected]
+	if !ok {
+		meltLabel.SetText("")
+		meltLabel.Hide()
+		return
+	}
+	plan, err := calc.PlanMelts(ctx, alloyID, amount, mode, percMap, container)
+	if err != nil {
+		meltLabel.SetText(fmt.Sprintf("Melt plan error: %v", err))
+	} else {
+		meltLabel.SetText(formatMeltPlan(plan))
+	}
+	meltLabel.Show()
+}
+
+// formatMeltPlan lists the melts in build order with the load of a single run.
+func formatMeltPlan(plan *calculator.MeltPlan) string {
+	if len(plan.Melts) == 0 {
+		return fmt.Sprintf("Nothing to melt in the %s.", plan.Container.Name)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Melt plan (%s, %.0f mB):", plan.Container.Name, plan.Container.CapacityMB)
+	for i, m := range plan.Melts {
+		var loads []string
+		if alloy, err := store.GetAlloyByID(ctx, m.AlloyID); err == nil {
+			for _, ing := range alloy.Ingredients {
+				loads = append(loads, fmt.Sprintf("%s %.2f mB", data.GetAlloyNameByID(ctx, store, ing.IngredientID), m.LoadMB[ing.IngredientID]))
+			}
+		}
+		runs := "1 run"
+		if m.Runs > 1 {
+			runs = fmt.Sprintf("%d runs", m.Runs)
+		}
+		name := data.GetAlloyNameByID(ctx, store, m.AlloyID)
+		if m.Path != "" {
+			name += " (for " + m.Path + ")"
+		}
+		fmt.Fprintf(&b, "\n%d. %s: %s of %.2f mB — load per run: %s",
+			i+1, name, runs, m.RunMB, strings.Join(loads, ", "))
+	}
+	return b.String()
+}
+
+// newMeltLabel returns the hidden, wrapping label that shows the melt plan.
+func newMeltLabel() *widget.Label {
+	lbl := widget.NewLabel("")
+	lbl.Wrapping = fyne.TextWrapWord
+	lbl.Hide()
+	return lbl
+}
@@ -0,0 +1,83 @@
+package ui
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"tfccalc/calculator"
+	"tfccalc/data"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+//
+// The “Optimize” row that fills the percentage entries with the optimum:
+// - buildOptimizeRow
+// - applyOptimum
+//
+
+// buildOptimizeRow returns a Select of the base metals in the catalog with
+// “Least” and “Most” buttons that set the percentages of the current alloy to use
+// as little or as much of the selected metal as possible.
+func buildOptimizeRow(allAlloys map[string]data.AlloyInfo) fyne.CanvasObject {
+	var names []string
+	baseIDs := make(map[string]string)
+	for id, alloy := range allAlloys {
+		if alloy.Type == "base" {
+			names = append(names, alloy.Name)
+			baseIDs[alloy.Name] = id
+		}
+	}
+	sort.Strings(names)
+	metalSelect := widget.NewSelect(names, nil)
+	metalSelect.PlaceHolder = "(metal)"
+
+	optimize := func(most bool) {
+		id, ok := baseIDs[metalSelect.Selected]
+		if !ok {
+			statusLabel.SetText("Select a metal to optimize for.")
+			return
+		}
+		goal := calculator.Minimize(id)
+		if most {
+			goal = calculator.Maximize(id)
+		}
+		applyOptimum(goal, metalSelect.Selected)
+	}
+	least := widget.NewButton("Least", func() { optimize(false) })
+	most := widget.NewButton("Most", func() { optimize(true) })
+	return container.NewBorder(nil, nil, nil, container.NewHBox(least, most), metalSelect)
+}
+
+// applyOptimum runs calc.OptimizePercentages for the current alloy and writes the
+// result into the percentage entries, so the next Calculate uses it. The optimum
+// has one mix per alloy, so the entries of paths are cleared.
+func applyOptimum(goal calculator.Goal, metalName string) {
+	if currentAlloyID == "" {
+		statusLabel.SetText("Select an alloy first.")
+		return
+	}
+	perc, err := calc.OptimizePercentages(ctx, currentAlloyID, goal)
+	if err != nil {
+		statusLabel.SetText(fmt.Sprintf("Error optimizing: %v", err))
+		return
+	}
+	for key, entryMap := range alloyPercentageEntries {
+		p, ok := perc[key]
+		for ingID, entry := range entryMap {
+			if ok {
+				entry.SetText(strconv.FormatFloat(math.Round(p[ingID]*1e4)/1e4, 'f', -1, 64))
+			} else if key != alloyIDOfKey(key) {
+				entry.SetText("")
+			}
+		}
+	}
+	which := "least"
+	if goal.Maximize {
+		which = "most"
+	}
+	statusLabel.SetText(fmt.Sprintf("Percentages set to use the %s %s. Press Calculate.", which, metalName))
+}
@@ -2,6 +2,8 @@ package ui
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 	"tfccalc/calculator"
 	"tfccalc/data"
 
@@ -15,14 +17,24 @@ import (
 // Functions for creating percentage‐input fields and populating the accordion:
 // - createPercentageInputsForAlloy
 // - buildAccordionItemsRecursive
+// - appendPathItems, alloyIDOfKey
+// - appendErrorItem
+// - pinnedPercentages, autoFillPercentages
+// - collectUserPercentages
 //
 
 // createPercentageInputsForAlloy builds a container (VBox or Label) showing Label+Entry
-// pairs for each ingredient of the given alloyID. If there are no ingredients, it returns
-// a simple Label saying “(No configurable ingredients).”
-func createPercentageInputsForAlloy(alloyID string) (fyne.CanvasObject, error) {
-	alloy, ok := data.GetAlloyByID(alloyID)
-	if !ok || len(alloy.Ingredients) == 0 {
+// pairs for each ingredient of the alloy behind key, an alloy ID or a path in the tree
+// (see calculator.Calculate). If there are no ingredients, it returns a simple Label
+// saying “(No configurable ingredients).” Typing in an entry auto-fills the
+// placeholders of the blank ones (see autoFillPercentages).
+func createPercentageInputsForAlloy(key string) (fyne.CanvasObject, error) {
+	alloyID := alloyIDOfKey(key)
+	alloy, err := store.GetAlloyByID(ctx, alloyID)
+	if err != nil {
+		return nil, err
+	}
+	if len(alloy.Ingredients) == 0 {
 		lbl := widget.NewLabel("  (No configurable ingredients)")
 		lbl.Wrapping = fyne.TextWrapWord
 		return lbl, nil
@@ -30,11 +42,16 @@ func createPercentageInputsForAlloy(alloyID string) (fyne.CanvasObject, error) {
 
 	vbox := container.NewVBox()
 	currentMap := make(map[string]*widget.Entry)
-	alloyPercentageEntries[alloyID] = currentMap
+	alloyPercentageEntries[key] = currentMap
+	hint := widget.NewLabel("")
+	hint.Wrapping = fyne.TextWrapWord
 
-	defaultPerc, _ := calculator.GetDefaultPercentages(alloyID)
+	defaultPerc, err := calc.GetDefaultPercentages(ctx, alloyID)
+	if err != nil {
+		return nil, err
+	}
 	for _, ing := range alloy.Ingredients {
-		ingName := data.GetAlloyNameByID(ing.IngredientID)
+		ingName := data.GetAlloyNameByID(ctx, store, ing.IngredientID)
 		label := widget.NewLabel(fmt.Sprintf("%s [%.0f–%.0f%%]:", ingName, ing.Min, ing.Max))
 		label.Wrapping = fyne.TextWrapWord
 
@@ -48,13 +65,72 @@ func createPercentageInputsForAlloy(alloyID string) (fyne.CanvasObject, error) {
 			}
 		}
 		entry.Wrapping = fyne.TextTruncate
+		entry.OnChanged = func(string) { autoFillPercentages(key, hint) }
 
 		currentMap[ing.IngredientID] = entry
 		vbox.Add(container.NewGridWithColumns(2, label, entry))
 	}
+	vbox.Add(hint)
+	if key != alloyID {
+		autoFillPercentages(key, hint)
+	}
 	return vbox, nil
 }
 
+// pinnedPercentages returns the percentages typed into entryMap, skipping blank
+// entries. Entries that are not numbers are returned as errors.
+func pinnedPercentages(alloyID string, entryMap map[string]*widget.Entry) (map[string]float64, []string) {
+	pinned := make(map[string]float64)
+	var problems []string
+	for ingID, entry := range entryMap {
+		if entry.Text == "" {
+			continue
+		}
+		val, err := strconv.ParseFloat(entry.Text, 64)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("Invalid %% for %s in %s",
+				data.GetAlloyNameByID(ctx, store, ingID),
+				data.GetAlloyNameByID(ctx, store, alloyID),
+			))
+			continue
+		}
+		pinned[ingID] = val
+	}
+	return pinned, problems
+}
+
+// autoFillPercentages balances the entries of key around the ones the user typed
+// (calc.BalancePercentages) and shows the result as the placeholders of the blank
+// entries. If the typed values cannot be balanced, hint says why. The entries of a
+// path that are all blank stand for the alloy's own entries and stay blank.
+func autoFillPercentages(key string, hint *widget.Label) {
+	alloyID := alloyIDOfKey(key)
+	entryMap := alloyPercentageEntries[key]
+	pinned, problems := pinnedPercentages(alloyID, entryMap)
+	if len(problems) > 0 {
+		hint.SetText(strings.Join(problems, "\n"))
+		return
+	}
+	if key != alloyID && len(pinned) == 0 {
+		for _, entry := range entryMap {
+			entry.SetPlaceHolder("")
+		}
+		hint.SetText(fmt.Sprintf("Leave blank to use the %s settings above.", data.GetAlloyNameByID(ctx, store, alloyID)))
+		return
+	}
+	balanced, err := calc.BalancePercentages(ctx, alloyID, pinned)
+	if err != nil {
+		hint.SetText(err.Error())
+		return
+	}
+	for ingID, entry := range entryMap {
+		if entry.Text == "" {
+			entry.SetPlaceHolder(fmt.Sprintf("%.1f", balanced[ingID]))
+		}
+	}
+	hint.SetText("")
+}
+
 // buildAccordionItemsRecursive walks the alloy → ingredients graph and appends an
 // AccordionItem for every alloy (or raw form) that has configurable ingredients.
 // It uses visited to avoid infinite cycles.
@@ -64,8 +140,9 @@ func buildAccordionItemsRecursive(alloyID string, acc *widget.Accordion, visited
 	}
 	visited[alloyID] = true
 
-	alloy, ok := data.GetAlloyByID(alloyID)
-	if !ok {
+	alloy, err := store.GetAlloyByID(ctx, alloyID)
+	if err != nil {
+		appendErrorItem(acc, alloyID, err)
 		return
 	}
 	idForInputs := alloyID
@@ -73,8 +150,9 @@ func buildAccordionItemsRecursive(alloyID string, acc *widget.Accordion, visited
 		idForInputs = alloy.RawFormID.String
 	}
 
-	currentAlloy, ok := data.GetAlloyByID(idForInputs)
-	if !ok {
+	currentAlloy, err := store.GetAlloyByID(ctx, idForInputs)
+	if err != nil {
+		appendErrorItem(acc, idForInputs, err)
 		return
 	}
 	// If this alloy/form has ingredients, add a “Configure: <Name>” item.
@@ -90,16 +168,21 @@ func buildAccordionItemsRecursive(alloyID string, acc *widget.Accordion, visited
 
 		// Recurse into each ingredient that is itself an alloy or raw_steel.
 		for _, ing := range currentAlloy.Ingredients {
-			ingAlloy, ok2 := data.GetAlloyByID(ing.IngredientID)
-			if !ok2 {
+			ingAlloy, err := store.GetAlloyByID(ctx, ing.IngredientID)
+			if err != nil {
+				appendErrorItem(acc, ing.IngredientID, err)
 				continue
 			}
 			nextID := ing.IngredientID
 			if ingAlloy.Type == "final_steel" {
 				nextID = ingAlloy.RawFormID.String
 			}
-			nextAlloy, ok3 := data.GetAlloyByID(nextID)
-			if ok3 && (nextAlloy.Type == "alloy" || nextAlloy.Type == "raw_steel") && len(nextAlloy.Ingredients) > 0 {
+			nextAlloy, err := store.GetAlloyByID(ctx, nextID)
+			if err != nil {
+				appendErrorItem(acc, nextID, err)
+				continue
+			}
+			if (nextAlloy.Type == "alloy" || nextAlloy.Type == "raw_steel") && len(nextAlloy.Ingredients) > 0 {
 				buildAccordionItemsRecursive(nextID, acc, visited)
 			}
 		}
@@ -110,3 +193,92 @@ func buildAccordionItemsRecursive(alloyID string, acc *widget.Accordion, visited
 		acc.Append(widget.NewAccordionItem(fmt.Sprintf("Configure: %s", currentAlloy.Name), lbl))
 	}
 }
+
+// appendPathItems adds a “Configure: <Name> in <path>” item for every place an
+// alloy of the targetID tree is used, if it is used in more than one place, so
+// each one can be mixed on its own. Their entries are keyed by the node's path.
+func appendPathItems(targetID string, acc *widget.Accordion) {
+	res, err := calc.Calculate(ctx, targetID, 100, "mB", nil)
+	if err != nil {
+		appendErrorItem(acc, targetID, err)
+		return
+	}
+	var ids []string
+	paths := make(map[string][]*calculator.Node)
+	res.Root.Walk(func(node, _ *calculator.Node, _ int) {
+		if node.Percentages == nil || node.MaterialID == "steel" {
+			return
+		}
+		if paths[node.MaterialID] == nil {
+			ids = append(ids, node.MaterialID)
+		}
+		paths[node.MaterialID] = append(paths[node.MaterialID], node)
+	})
+	for _, id := range ids {
+		if len(paths[id]) < 2 {
+			continue
+		}
+		for _, node := range paths[id] {
+			content, err := createPercentageInputsForAlloy(node.Path)
+			if err != nil {
+				appendErrorItem(acc, node.Path, err)
+				continue
+			}
+			parents := strings.Split(node.Path, "/")
+			names := make([]string, len(parents)-1)
+			for i, parent := range parents[:len(parents)-1] {
+				names[i] = data.GetAlloyNameByID(ctx, store, parent)
+			}
+			title := fmt.Sprintf("Configure: %s in %s", node.Name, strings.Join(names, " › "))
+			acc.Append(widget.NewAccordionItem(title, content))
+		}
+	}
+}
+
+// alloyIDOfKey returns the alloy ID a percentage key is for: the key itself, or
+// the last element of a path.
+func alloyIDOfKey(key string) string {
+	return key[strings.LastIndex(key, "/")+1:]
+}
+
+// appendErrorItem adds an accordion item telling that alloyID could not be loaded,
+// so a failing store shows up in the UI instead of silently hiding inputs.
+func appendErrorItem(acc *widget.Accordion, alloyID string, err error) {
+	lbl := widget.NewLabel(fmt.Sprintf("Error loading %s: %v", alloyID, err))
+	lbl.Wrapping = fyne.TextWrapWord
+	acc.Append(widget.NewAccordionItem(fmt.Sprintf("Error: %s", alloyID), lbl))
+}
+
+// collectUserPercentages reads every percentage entry of the accordion. For each alloy
+// it balances the blank entries around the typed ones, as the placeholders show;
+// the complete maps are returned keyed by alloy ID or path, problems as
+// human-readable messages. Alloys and paths with only blank entries are left out,
+// so they get the defaults without a map that may end up unused.
+func collectUserPercentages() (map[string]map[string]float64, []string) {
+	userPercs := make(map[string]map[string]float64)
+	var validationErrors []string
+	for key, entryMap := range alloyPercentageEntries {
+		alloyID := alloyIDOfKey(key)
+		pinned, problems := pinnedPercentages(alloyID, entryMap)
+		if len(problems) > 0 {
+			validationErrors = append(validationErrors, problems...)
+			continue
+		}
+		if len(pinned) == 0 {
+			continue
+		}
+		finalPerc, err := calc.BalancePercentages(ctx, alloyID, pinned)
+		if err != nil {
+			validationErrors = append(
+				validationErrors,
+				fmt.Sprintf("Error in %% for %s: %v",
+					data.GetAlloyNameByID(ctx, store, alloyID),
+					err,
+				),
+			)
+		} else if len(finalPerc) > 0 {
+			userPercs[key] = finalPerc
+		}
+	}
+	return userPercs, validationErrors
+}
@@ -0,0 +1,59 @@
+package ui
+
+import (
+	"fmt"
+	"strings"
+	"tfccalc/calculator"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/widget"
+)
+
+//
+// The “Build Order” tab: the processing steps of the calculated target.
+// - showProcessingSteps, clearProcessingSteps
+// - formatStep
+//
+
+// showProcessingSteps fills stepsBox with the numbered processing steps of a
+// calculation result.
+func showProcessingSteps(steps []calculator.Step) {
+	stepsBox.Objects = nil
+	for i, s := range steps {
+		lbl := widget.NewLabel(formatStep(i+1, s))
+		lbl.Wrapping = fyne.TextWrapWord
+		stepsBox.Add(lbl)
+	}
+	stepsBox.Refresh()
+}
+
+// clearProcessingSteps empties the “Build Order” tab.
+func clearProcessingSteps() {
+	stepsBox.Objects = nil
+	stepsBox.Refresh()
+}
+
+// formatStep renders a step as
+// “3. Anvil — weld: Raw Black Steel 100.00 mB + Pig Iron 100.00 mB → Weak Black Steel 100.00 mB”.
+func formatStep(n int, s calculator.Step) string {
+	var inputs []string
+	for _, in := range s.Inputs {
+		inputs = append(inputs, formatStepItem(in))
+	}
+	station := string(s.Station)
+	station = strings.ToUpper(station[:1]) + station[1:]
+	output := formatStepItem(s.Output)
+	if s.Path != "" {
+		output += " (for " + s.Path + ")"
+	}
+	return fmt.Sprintf("%d. %s — %s: %s → %s", n, station, s.Action, strings.Join(inputs, " + "), output)
+}
+
+// formatStepItem renders an item with its amount, or just its name if the amount is
+// not tracked (ore, fuel, flux).
+func formatStepItem(item calculator.StepItem) string {
+	if item.AmountMB == 0 {
+		return item.Name
+	}
+	return fmt.Sprintf("%s %.2f mB", item.Name, item.AmountMB)
+}
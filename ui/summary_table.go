@@ -3,6 +3,7 @@ package ui
 import (
 	"fmt"
 	"sort"
+	"tfccalc/calculator"
 	"tfccalc/data"
 
 	"fyne.io/fyne/v2"
@@ -14,6 +15,7 @@ import (
 // This file is responsible for initializing and updating the summary table.
 // – InitSummaryTable() returns a *widget.Table configured with three columns.
 // – UpdateSummaryData(finalMB map[string]float64, table *widget.Table) rebuilds summaryData & refreshes.
+// – UpdateBatchSummaryData(plan, table) does the same for a batch, with one column per target.
 //
 
 // InitSummaryTable constructs a *widget.Table with columns: Material | mB | Ingots.
@@ -22,9 +24,9 @@ func InitSummaryTable() *widget.Table {
 	summaryData = [][]string{{"Material", "mB", "Ingots"}}
 
 	table := widget.NewTable(
-		// Number of rows, number of columns
+		// Number of rows, number of columns (the header row decides: 3, or more for a batch)
 		func() (int, int) {
-			return len(summaryData), 3
+			return len(summaryData), len(summaryData[0])
 		},
 		// Create a new cell (a padded Label) for each cell
 		func() fyne.CanvasObject {
@@ -73,17 +75,52 @@ func UpdateSummaryData(finalMB map[string]float64, table *widget.Table) {
 		ids = append(ids, id)
 	}
 	sort.Slice(ids, func(i, j int) bool {
-		return data.GetAlloyNameByID(ids[i]) < data.GetAlloyNameByID(ids[j])
+		return data.GetAlloyNameByID(ctx, store, ids[i]) < data.GetAlloyNameByID(ctx, store, ids[j])
 	})
 
 	// Append each alloy row in sorted order
 	for _, id := range ids {
 		mbVal := finalMB[id]
 		summaryData = append(summaryData, []string{
-			data.GetAlloyNameByID(id),
+			data.GetAlloyNameByID(ctx, store, id),
 			fmt.Sprintf("%.2f", mbVal),
 			fmt.Sprintf("%.3f", mbVal/100.0),
 		})
 	}
+	// A batch may have widened the columns
+	table.SetColumnWidth(1, 100)
+	table.SetColumnWidth(2, 100)
+	table.Refresh()
+}
+
+// UpdateBatchSummaryData rebuilds summaryData from a batch plan: one mB column per
+// target followed by the combined mB and Ingots, then refreshes the table.
+func UpdateBatchSummaryData(plan *calculator.BatchPlan, table *widget.Table) {
+	header := []string{"Material"}
+	for _, t := range plan.Targets {
+		header = append(header, fmt.Sprintf("%s mB", data.GetAlloyNameByID(ctx, store, t.Target.AlloyID)))
+	}
+	header = append(header, "Total mB", "Total Ingots")
+	summaryData = [][]string{header}
+
+	var ids []string
+	for id := range plan.TotalMB {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return data.GetAlloyNameByID(ctx, store, ids[i]) < data.GetAlloyNameByID(ctx, store, ids[j])
+	})
+
+	for _, id := range ids {
+		row := []string{data.GetAlloyNameByID(ctx, store, id)}
+		for _, t := range plan.Targets {
+			row = append(row, fmt.Sprintf("%.2f", t.Result.TotalMB[id]))
+		}
+		row = append(row, fmt.Sprintf("%.2f", plan.TotalMB[id]), fmt.Sprintf("%.3f", plan.TotalIngots[id]))
+		summaryData = append(summaryData, row)
+	}
+	for col := 1; col < len(header); col++ {
+		table.SetColumnWidth(col, 140)
+	}
 	table.Refresh()
 }
@@ -2,6 +2,7 @@ package ui
 
 import (
 	"image/color"
+	"tfccalc/calculator"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/canvas"
@@ -9,8 +10,8 @@ import (
 )
 
 //
-// This file knows how to take a []lineInfo (from tree_formatter.go) and turn it into
-// a Fyne container full of colored canvas.Text segments. We draw vertical bars “│   ”,
+// This file knows how to take the []calculator.TreeLine of a tree (Node.Lines) and
+// turn it into a Fyne container full of colored canvas.Text segments. We draw vertical bars “│   ”,
 // branch symbols “├── ” / “└── ”, and the node text itself in a monospace style.
 //
 // - palette: array of colors (cycled by depth)
@@ -27,23 +28,23 @@ var palette = []color.Color{
 	color.RGBA{R: 153, G: 255, B: 255, A: 255}, // Light Cyan
 }
 
-// RenderLines accepts a slice of lineInfo and returns a *fyne.Container (VBox)
+// RenderLines accepts a slice of calculator.TreeLine and returns a *fyne.Container (VBox)
 // that lays out each line as an HBox of canvas.Text segments with the correct colors.
 //
 // Each line is composed of:
 //  1. “│   ” or “    ” segments for each ancestor level
 //  2. “├── ” or “└── ” branch symbol at the current depth
 //  3. The node text itself (e.g. “Copper (221.25mB | 2.212Ing)”).
-func RenderLines(lines []lineInfo) *fyne.Container {
+func RenderLines(lines []calculator.TreeLine) *fyne.Container {
 	box := container.NewVBox()
 
 	for _, ln := range lines {
 		var segments []fyne.CanvasObject
-		depth := len(ln.PrefixParts) - 1
+		depth := ln.Depth()
 
 		// 1) Draw vertical bars or spaces for each ancestor level.
 		for lvl := 0; lvl < depth; lvl++ {
-			if ln.PrefixParts[lvl] {
+			if ln.Last[lvl] {
 				// If the ancestor at this level was the last child, draw spaces “    ”.
 				txt := canvas.NewText("    ", color.White)
 				txt.TextStyle = fyne.TextStyle{Monospace: true}
@@ -58,7 +59,7 @@ func RenderLines(lines []lineInfo) *fyne.Container {
 
 		// 2) Draw branch symbol “├── ” or “└── ” in the color at current depth.
 		branchSymbol := "├── "
-		if ln.IsLast {
+		if ln.IsLast() {
 			branchSymbol = "└── "
 		}
 		brText := canvas.NewText(branchSymbol, palette[depth%len(palette)])
@@ -66,7 +67,7 @@ func RenderLines(lines []lineInfo) *fyne.Container {
 		segments = append(segments, brText)
 
 		// 3) Draw the node’s text in the same color.
-		nodeTxt := canvas.NewText(ln.Text, palette[depth%len(palette)])
+		nodeTxt := canvas.NewText(ln.Node.Label(), palette[depth%len(palette)])
 		nodeTxt.TextStyle = fyne.TextStyle{Monospace: true}
 		segments = append(segments, nodeTxt)
 
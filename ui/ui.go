@@ -2,16 +2,15 @@ package ui
 
 import (
 	"fmt"
-	"image/color"
 	"log"
 	"sort"
 	"strconv"
 	"strings"
 	"tfccalc/calculator"
+	"tfccalc/config"
 	"tfccalc/data"
 
 	"fyne.io/fyne/v2"
-	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/data/validation"
 	"fyne.io/fyne/v2/widget"
@@ -22,28 +21,25 @@ import (
 //  1) Alloy selector (Select dropdown)
 //  2) Amount entry (Entry) + Mode radio (RadioGroup)
 //  3) Percentage accordion
-//  4) Tree rendering (calls formatHierarchy → RenderLines)
+//  4) Tree rendering (calculator.Result → Node.Lines → RenderLines)
 //  5) Summary table updates
+//  6) Batch panel (batch.go) for calculating several targets at once
+//  7) Container selector and melt plan (melts.go)
+//  8) “Build Order” tab with the processing steps (steps.go)
 //
-// BuildUI(app) constructs a fx.Window, lays out controls on the left,
+// BuildUI(app, recipes, prefs) constructs a fx.Window, lays out controls on the left,
 // and puts status + hierarchy + summary on the right. The “Calculate”
-// callback triggers buildResultTreeRecursive → formatHierarchy → RenderLines,
+// callback runs calc.Calculate, renders its tree via Node.Lines → RenderLines,
 // then calls UpdateSummaryData() for the summary.
 //
-// Global state (alloyNames, alloyIDs, percentage entries, etc.) all come from vars.go.
+// Global state (alloyNames, alloyIDs, percentage entries, the recipe store, etc.) all come from vars.go.
 //
 
 // BuildUI creates and returns the main window of the application.
-func BuildUI(app fyne.App) fyne.Window {
-	// 0) Predefined color palette: must match the one in tree_renderer.go
-	palette := []color.Color{
-		color.RGBA{R: 255, G: 102, B: 102, A: 255}, // Light Red
-		color.RGBA{R: 102, G: 255, B: 102, A: 255}, // Light Green
-		color.RGBA{R: 102, G: 178, B: 255, A: 255}, // Light Blue
-		color.RGBA{R: 255, G: 255, B: 102, A: 255}, // Light Yellow
-		color.RGBA{R: 255, G: 153, B: 255, A: 255}, // Light Pink
-		color.RGBA{R: 153, G: 255, B: 255, A: 255}, // Light Cyan
-	}
+// All alloy data is read from recipes; prefs sets the initial mode, alloy and amount.
+func BuildUI(app fyne.App, recipes data.RecipeStore, prefs config.UI) fyne.Window {
+	store = recipes
+	calc = calculator.New(recipes)
 
 	// 1) Load icon if available
 	resIcon, err := fyne.LoadResourceFromPath("./assets/tfc_icon.png")
@@ -58,7 +54,8 @@ func BuildUI(app fyne.App) fyne.Window {
 	// 2) Initialize alloyNames + alloyIDs for the Select dropdown
 	alloyNames = []string{}
 	alloyIDs = make(map[string]string)
-	for id, alloyData := range data.GetAllAlloys() {
+	allAlloys, loadErr := store.GetAllAlloys(ctx)
+	for id, alloyData := range allAlloys {
 		if alloyData.Type == "alloy" || alloyData.Type == "final_steel" {
 			alloyNames = append(alloyNames, alloyData.Name)
 			alloyIDs[alloyData.Name] = id
@@ -80,10 +77,11 @@ func BuildUI(app fyne.App) fyne.Window {
 		// Build accordion items recursively starting from the raw form if this is final_steel.
 		visited := make(map[string]bool)
 		startID := currentAlloyID
-		if alloy, ok := data.GetAlloyByID(currentAlloyID); ok && alloy.Type == "final_steel" {
+		if alloy, err := store.GetAlloyByID(ctx, currentAlloyID); err == nil && alloy.Type == "final_steel" {
 			startID = alloy.RawFormID.String
 		}
 		buildAccordionItemsRecursive(startID, percentageAccordion, visited)
+		appendPathItems(currentAlloyID, percentageAccordion)
 		percentageAccordion.Refresh()
 		if len(percentageAccordion.Items) > 0 {
 			percentageAccordion.Open(0)
@@ -101,6 +99,9 @@ func BuildUI(app fyne.App) fyne.Window {
 
 		summaryData = [][]string{{"Material", "mB", "Ingots"}}
 		summaryTable.Refresh()
+		meltLabel.SetText("")
+		meltLabel.Hide()
+		clearProcessingSteps()
 
 		statusLabel.SetText("Select amount and mode, then press Calculate.")
 	})
@@ -110,11 +111,17 @@ func BuildUI(app fyne.App) fyne.Window {
 	amountEntry = widget.NewEntry()
 	amountEntry.PlaceHolder = "Amount..."
 	amountEntry.Validator = validation.NewRegexp(`^\d+(\.\d+)?$`, "Number > 0")
+	if prefs.Amount > 0 {
+		amountEntry.SetText(strconv.FormatFloat(prefs.Amount, 'f', -1, 64))
+	}
 
 	// 4) Mode radio group (“mB” or “Ingots”)
 	modeRadio = widget.NewRadioGroup([]string{"mB", "Ingots"}, nil)
 	modeRadio.Horizontal = true
-	modeRadio.SetSelected("Ingots")
+	modeRadio.SetSelected(prefs.Mode)
+
+	// 4.1) Container selector for splitting the job into melts
+	containerSelect = buildContainerSelect()
 
 	// 5) Status label (wrapped text)
 	statusLabel = widget.NewLabel("Enter data and press Calculate.")
@@ -136,85 +143,13 @@ func BuildUI(app fyne.App) fyne.Window {
 	// 9) Calculate button: gathers input, builds tree, renders lines, updates summary.
 	calcButton := widget.NewButton("Calculate", func() {
 		statusLabel.SetText("Calculating...")
-		selected := currentAlloyID
-		if selected == "" {
-			statusLabel.SetText("Error: Alloy not selected.")
-			return
-		}
-
-		amtStr := amountEntry.Text
-		amt, err := strconv.ParseFloat(amtStr, 64)
-		if err != nil || amt <= 0 {
-			statusLabel.SetText("Error: Enter a valid positive amount.")
-			return
-		}
-		mode := modeRadio.Selected
-		if mode == "" {
-			statusLabel.SetText("Error: Select mode (mB or Ingots).")
+		selected, amt, mode, ok := readTargetInputs()
+		if !ok {
 			return
 		}
 
 		// 9.1) Collect user‐entered percentages into userPercs
-		userPercs := make(map[string]map[string]float64)
-		var validationErrors []string
-		for alloyID, entryMap := range alloyPercentageEntries {
-			tmp := make(map[string]float64)
-			useCustom := false
-			defaultPerc, _ := calculator.GetDefaultPercentages(alloyID)
-			alloyInfo, _ := data.GetAlloyByID(alloyID)
-			for ingID, entry := range entryMap {
-				if entry.Text != "" {
-					val, err2 := strconv.ParseFloat(entry.Text, 64)
-					if err2 != nil {
-						validationErrors = append(
-							validationErrors,
-							fmt.Sprintf("Invalid %% for %s in %s",
-								data.GetAlloyNameByID(ingID),
-								data.GetAlloyNameByID(alloyID),
-							),
-						)
-						continue
-					}
-					tmp[ingID] = val
-					useCustom = true
-				}
-			}
-			if useCustom || len(alloyInfo.Ingredients) > 0 {
-				finalPerc := make(map[string]float64)
-				for k, v := range tmp {
-					finalPerc[k] = v
-				}
-				if defaultPerc != nil {
-					for _, ing := range alloyInfo.Ingredients {
-						if _, exists := finalPerc[ing.IngredientID]; !exists {
-							if defv, ok := defaultPerc[ing.IngredientID]; ok {
-								finalPerc[ing.IngredientID] = defv
-							} else {
-								validationErrors = append(
-									validationErrors,
-									fmt.Sprintf("No default for %s in %s",
-										data.GetAlloyNameByID(ing.IngredientID),
-										data.GetAlloyNameByID(alloyID),
-									),
-								)
-							}
-						}
-					}
-				}
-				valid, errv := calculator.ValidatePercentages(alloyID, finalPerc)
-				if !valid {
-					validationErrors = append(
-						validationErrors,
-						fmt.Sprintf("Error in %% for %s: %v",
-							data.GetAlloyNameByID(alloyID),
-							errv,
-						),
-					)
-				} else if len(finalPerc) > 0 {
-					userPercs[alloyID] = finalPerc
-				}
-			}
-		}
+		userPercs, validationErrors := collectUserPercentages()
 		if len(validationErrors) > 0 {
 			statusLabel.SetText("Percentage errors:\n- " + strings.Join(validationErrors, "\n- "))
 			return
@@ -224,69 +159,47 @@ func BuildUI(app fyne.App) fyne.Window {
 		if len(userPercs) > 0 {
 			percMap = userPercs
 		}
-		finalMB, _, errCalc := calculator.CalculateRequirements(selected, amt, mode, percMap)
+		result, errCalc := calc.Calculate(ctx, selected, amt, mode, percMap)
 		if errCalc != nil {
 			statusLabel.SetText(fmt.Sprintf("Calculation error:\n%v", errCalc))
 			hierarchyContainer.Objects = nil
 			hierarchyContainer.Refresh()
 			summaryData = [][]string{{"Material", "mB", "Ingots"}}
 			summaryTable.Refresh()
+			meltLabel.Hide()
+			clearProcessingSteps()
 			return
 		}
 
-		// 9.2) Build the calculation tree
-		rootMB := amt
-		if mode == "Ingots" {
-			rootMB = amt * 100.0
-		}
-		rootNode, errTree := buildResultTreeRecursive(selected, rootMB, percMap, make(map[string]int), 0, 5)
-		if errTree != nil {
-			statusLabel.SetText(fmt.Sprintf("Tree build error: %v", errTree))
-			hierarchyContainer.Objects = nil
-			hierarchyContainer.Refresh()
-		} else if rootNode != nil {
-			lines := formatHierarchy([]*calculationNode{rootNode})
+		// 9.2) Render the calculation tree
+		hierarchyContainer.Objects = RenderLines(result.Root.Lines()).Objects
+		hierarchyContainer.Refresh()
 
-			hierarchyContainer.Objects = nil
-			for _, ln := range lines {
-				var segments []fyne.CanvasObject
-				depth := len(ln.PrefixParts) - 1
-				// Draw ancestor bars/spaces
-				for lvl := 0; lvl < depth; lvl++ {
-					if ln.PrefixParts[lvl] {
-						txt := canvas.NewText("    ", color.White)
-						txt.TextStyle = fyne.TextStyle{Monospace: true}
-						segments = append(segments, txt)
-					} else {
-						txt := canvas.NewText("│   ", palette[lvl%len(palette)])
-						txt.TextStyle = fyne.TextStyle{Monospace: true}
-						segments = append(segments, txt)
-					}
-				}
-				// Draw branch symbol
-				branchSymbol := "├── "
-				if ln.IsLast {
-					branchSymbol = "└── "
-				}
-				brText := canvas.NewText(branchSymbol, palette[depth%len(palette)])
-				brText.TextStyle = fyne.TextStyle{Monospace: true}
-				segments = append(segments, brText)
-				// Draw node text
-				nodeTxt := canvas.NewText(ln.Text, palette[depth%len(palette)])
-				nodeTxt.TextStyle = fyne.TextStyle{Monospace: true}
-				segments = append(segments, nodeTxt)
-
-				hierarchyContainer.Add(container.NewHBox(segments...))
-			}
-			hierarchyContainer.Refresh()
+		status := fmt.Sprintf("Calculation result for %s %.2f %s:",
+			data.GetAlloyNameByID(ctx, store, selected), amt, mode,
+		)
+		if len(result.Warnings) > 0 {
+			status += "\nWarnings:\n- " + strings.Join(result.Warnings, "\n- ")
 		}
-
-		statusLabel.SetText(fmt.Sprintf("Calculation result for %s %.2f %s:",
-			data.GetAlloyNameByID(selected), amt, mode,
-		))
+		statusLabel.SetText(status)
 
 		// 9.3) Update summary table
-		UpdateSummaryData(finalMB, summaryTable)
+		UpdateSummaryData(result.TotalMB, summaryTable)
+
+		// 9.4) Split into melts if a container is selected
+		showMeltPlan(selected, amt, mode, percMap)
+
+		// 9.5) Build order
+		showProcessingSteps(result.Steps)
+	})
+
+	// Exact arithmetic: later calculations use a calculator.NewExact
+	exactCheck := widget.NewCheck("Exact arithmetic", func(on bool) {
+		if on {
+			calc = calculator.NewExact(store)
+		} else {
+			calc = calculator.New(store)
+		}
 	})
 
 	// 10) Left panel: Select dropdown, Amount entry, Mode radio, Accordion, Button
@@ -297,10 +210,15 @@ func BuildUI(app fyne.App) fyne.Window {
 		amountEntry,
 		widget.NewLabel("Mode:"),
 		modeRadio,
+		exactCheck,
+		widget.NewLabel("Container:"),
+		containerSelect,
+		widget.NewLabel("Optimize:"),
+		buildOptimizeRow(allAlloys),
 	)
 	leftPanel := container.NewBorder(
 		inputForm,
-		calcButton,
+		container.NewVBox(calcButton, widget.NewSeparator(), buildBatchPanel()),
 		nil,
 		nil,
 		container.NewVScroll(percentageAccordion),
@@ -309,6 +227,10 @@ func BuildUI(app fyne.App) fyne.Window {
 	// 11) Right panel: Status label, then a VSplit of hierarchy + summary
 	statusLabel = widget.NewLabel("Enter data and press Calculate.")
 	statusLabel.Wrapping = fyne.TextWrapWord
+	if loadErr != nil {
+		statusLabel.SetText(fmt.Sprintf("Error loading alloys:\n%v", loadErr))
+	}
+	meltLabel = newMeltLabel()
 
 	hierarchyLabel := widget.NewLabelWithStyle(
 		"Calculation Hierarchy:",
@@ -335,17 +257,31 @@ func BuildUI(app fyne.App) fyne.Window {
 		nil,
 		container.NewVScroll(summaryTable),
 	)
-	rightSplit := container.NewVSplit(hierarchySection, summarySection)
+	stepsBox = container.NewVBox()
+	resultTabs := container.NewAppTabs(
+		container.NewTabItem("Hierarchy", hierarchySection),
+		container.NewTabItem("Build Order", container.NewVScroll(stepsBox)),
+	)
+	rightSplit := container.NewVSplit(resultTabs, summarySection)
 	rightSplit.SetOffset(0.6)
 
 	rightContent := container.NewBorder(
-		statusLabel,
+		container.NewVBox(statusLabel, meltLabel),
 		nil,
 		nil,
 		nil,
 		rightSplit,
 	)
 
+	// Preselect the configured alloy now that every widget its callback touches exists.
+	if prefs.Alloy != "" {
+		if alloy, err := store.GetAlloyByID(ctx, prefs.Alloy); err == nil && alloyIDs[alloy.Name] == prefs.Alloy {
+			alloySelector.SetSelected(alloy.Name)
+		} else {
+			statusLabel.SetText(fmt.Sprintf("Configured alloy %q is not available.", prefs.Alloy))
+		}
+	}
+
 	// 12) Main HSplit: leftPanel | rightContent
 	mainSplit := container.NewHSplit(leftPanel, rightContent)
 	mainSplit.SetOffset(0.35)
@@ -356,3 +292,22 @@ func BuildUI(app fyne.App) fyne.Window {
 
 	return win
 }
+
+// readTargetInputs reads the selected alloy, the amount and the mode. If one of them
+// is missing or invalid it reports that in the status label and returns ok=false.
+func readTargetInputs() (alloyID string, amount float64, mode string, ok bool) {
+	if currentAlloyID == "" {
+		statusLabel.SetText("Error: Alloy not selected.")
+		return "", 0, "", false
+	}
+	amt, err := strconv.ParseFloat(amountEntry.Text, 64)
+	if err != nil || amt <= 0 {
+		statusLabel.SetText("Error: Enter a valid positive amount.")
+		return "", 0, "", false
+	}
+	if modeRadio.Selected == "" {
+		statusLabel.SetText("Error: Select mode (mB or Ingots).")
+		return "", 0, "", false
+	}
+	return currentAlloyID, amt, modeRadio.Selected, true
+}
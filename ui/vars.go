@@ -1,6 +1,10 @@
 package ui
 
 import (
+	"context"
+	"tfccalc/calculator"
+	"tfccalc/data"
+
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/widget"
 )
@@ -9,6 +13,13 @@ import (
 // файлах пакету ui. Завдяки цьому вони будуть “visible” в інших файлах.
 
 var (
+	// Сховище рецептів, передане в BuildUI, та калькулятор поверх нього
+	store data.RecipeStore
+	calc  *calculator.Calculator
+
+	// Контекст для звернень до сховища; запити з GUI не скасовуються
+	ctx = context.Background()
+
 	// Список імен сплавів та мапа name → ID
 	alloyNames []string
 	alloyIDs   map[string]string
@@ -38,4 +49,17 @@ var (
 
 	// Label для статусних повідомлень
 	statusLabel *widget.Label
+
+	// Select для вибору ємності (тигель, посудина), мапа підпис → Container
+	// та Label з планом плавок
+	containerSelect *widget.Select
+	containers      map[string]calculator.Container
+	meltLabel       *widget.Label
+
+	// VBox вкладки “Build Order” з кроками обробки
+	stepsBox *fyne.Container
+
+	// Цілі пакетного розрахунку (Batch) та VBox, у якому вони показані
+	batchTargets []calculator.BatchTarget
+	batchBox     *fyne.Container
 )
@@ -0,0 +1,252 @@
+// The page does what ui.BuildUI does in the window, through the API of tfccalc serve:
+//  1) alloy selector, filled from GET /alloys
+//  2) amount, mode and exact arithmetic
+//  3) percentage settings for the alloy and every alloy in it, auto-filled by POST /balance
+//  4) the breakdown tree of POST /calculate, colored by depth like the window's
+//  5) the summary table of the base materials
+"use strict";
+
+const depthColors = 6; // .d0 … .d5 in style.css
+
+let alloys = {};  // ID → alloy as GET /alloys returns it
+let entries = {}; // alloy ID → ingredient ID → <input>
+
+const $ = (id) => document.getElementById(id);
+
+// api sends a request to the server and returns its JSON answer, or throws the
+// error the server gave.
+async function api(method, path, body) {
+  const init = { method };
+  if (body !== undefined) {
+    init.headers = { "Content-Type": "application/json" };
+    init.body = JSON.stringify(body);
+  }
+  const res = await fetch(path, init);
+  const data = await res.json();
+  if (!res.ok) {
+    throw new Error(data.error || res.statusText);
+  }
+  return data;
+}
+
+function nameOf(id) {
+  return alloys[id] ? alloys[id].name : id;
+}
+
+function setStatus(text) {
+  $("status").textContent = text;
+}
+
+// inputsOf returns the alloy whose percentages configure id: a final steel's raw form.
+function inputsOf(id) {
+  const alloy = alloys[id];
+  return alloy && alloy.type === "final_steel" ? alloy.raw_form_id : id;
+}
+
+async function init() {
+  let list;
+  try {
+    list = await api("GET", "/alloys");
+  } catch (err) {
+    setStatus("Error loading alloys:\n" + err.message);
+    return;
+  }
+  const select = $("alloy");
+  list.forEach((a) => { alloys[a.id] = a; });
+  list.filter((a) => a.type === "alloy" || a.type === "final_steel")
+    .sort((a, b) => a.name.localeCompare(b.name))
+    .forEach((a) => select.add(new Option(a.name, a.id)));
+  select.addEventListener("change", selectAlloy);
+  $("calculate").addEventListener("click", calculate);
+}
+
+// selectAlloy rebuilds the percentage settings for the chosen alloy and clears the results.
+function selectAlloy() {
+  const box = $("percentages");
+  box.replaceChildren();
+  entries = {};
+  clearResults();
+  setStatus("Select amount and mode, then press Calculate.");
+
+  const id = $("alloy").value;
+  if (!id) {
+    return;
+  }
+  addPercentageItems(inputsOf(id), new Set());
+  const first = box.querySelector("details");
+  if (first) {
+    first.open = true;
+  } else {
+    box.textContent = "No configurable ingredients for this alloy.";
+  }
+}
+
+// addPercentageItems adds a "Configure: <Name>" section for id and, depth first,
+// for every alloy or raw steel among its ingredients.
+function addPercentageItems(id, visited) {
+  if (visited.has(id)) {
+    return;
+  }
+  visited.add(id);
+  const alloy = alloys[id];
+  if (!alloy || !alloy.ingredients) {
+    return;
+  }
+
+  const details = document.createElement("details");
+  const summary = document.createElement("summary");
+  summary.textContent = "Configure: " + alloy.name;
+  details.append(summary);
+  const hint = document.createElement("div");
+  hint.className = "hint";
+  entries[id] = {};
+  for (const ing of alloy.ingredients) {
+    const row = document.createElement("label");
+    row.className = "ingredient";
+    const input = document.createElement("input");
+    input.type = "number";
+    input.step = "any";
+    input.placeholder = alloy.default_percentages[ing.id].toFixed(1);
+    input.addEventListener("input", () => autoFill(id, hint));
+    entries[id][ing.id] = input;
+    row.append(`${nameOf(ing.id)} [${ing.min}–${ing.max}%]:`, input);
+    details.append(row);
+  }
+  details.append(hint);
+  $("percentages").append(details);
+
+  for (const ing of alloy.ingredients) {
+    const next = alloys[inputsOf(ing.id)];
+    if (next && (next.type === "alloy" || next.type === "raw_steel") && next.ingredients) {
+      addPercentageItems(next.id, visited);
+    }
+  }
+}
+
+// pinned returns the percentages typed for alloyID, or null if there are none.
+function pinned(alloyID) {
+  let result = null;
+  for (const [ingID, input] of Object.entries(entries[alloyID])) {
+    if (input.value === "") {
+      continue;
+    }
+    if (!Number.isFinite(input.valueAsNumber)) {
+      throw new Error(`Invalid % for ${nameOf(ingID)} in ${nameOf(alloyID)}`);
+    }
+    result = result || {};
+    result[ingID] = input.valueAsNumber;
+  }
+  return result;
+}
+
+// autoFill balances the entries of alloyID around the typed ones and shows the
+// result as the placeholders of the blank entries, or in hint why it cannot.
+async function autoFill(alloyID, hint) {
+  try {
+    const res = await api("POST", "/balance", { alloy_id: alloyID, pinned: pinned(alloyID) || {} });
+    for (const [ingID, input] of Object.entries(entries[alloyID])) {
+      if (input.value === "") {
+        input.placeholder = res.percentages[ingID].toFixed(1);
+      }
+    }
+    hint.textContent = "";
+  } catch (err) {
+    hint.textContent = err.message;
+  }
+}
+
+// collectPercentages returns the completed percentages of every alloy the user
+// typed something for, keyed by alloy ID as POST /calculate takes them.
+async function collectPercentages() {
+  const result = {};
+  for (const alloyID of Object.keys(entries)) {
+    const typed = pinned(alloyID);
+    if (!typed) {
+      continue;
+    }
+    try {
+      result[alloyID] = (await api("POST", "/balance", { alloy_id: alloyID, pinned: typed })).percentages;
+    } catch (err) {
+      throw new Error(`${nameOf(alloyID)}: ${err.message}`);
+    }
+  }
+  return result;
+}
+
+async function calculate() {
+  const alloyID = $("alloy").value;
+  const amount = $("amount").valueAsNumber;
+  const mode = document.querySelector("input[name=mode]:checked").value;
+  if (!alloyID) {
+    setStatus("Error: Alloy not selected.");
+    return;
+  }
+  if (!(amount > 0)) {
+    setStatus("Error: Enter a valid positive amount.");
+    return;
+  }
+  setStatus("Calculating...");
+
+  let report;
+  try {
+    const percentages = await collectPercentages();
+    report = await api("POST", "/calculate", {
+      alloy_id: alloyID, amount, mode, percentages, exact: $("exact").checked,
+    });
+  } catch (err) {
+    clearResults();
+    setStatus("Calculation error:\n" + err.message);
+    return;
+  }
+
+  let status = `Calculation result for ${nameOf(alloyID)} ${amount.toFixed(2)} ${mode}:`;
+  if (report.warnings && report.warnings.length > 0) {
+    status += "\nWarnings:\n- " + report.warnings.join("\n- ");
+  }
+  setStatus(status);
+  renderTree(report.tree);
+  renderSummary(report.summary);
+}
+
+function clearResults() {
+  $("tree").replaceChildren();
+  document.querySelector("#summary tbody").replaceChildren();
+}
+
+// renderTree draws the tree like the window's: "│   " for every ancestor that has
+// siblings below it, then "├── " or "└── " and the node, in the color of its depth.
+function renderTree(root) {
+  const tree = $("tree");
+  tree.replaceChildren();
+  const span = (text, depth) => {
+    const s = document.createElement("span");
+    s.className = "d" + (depth % depthColors);
+    s.textContent = text;
+    tree.append(s);
+  };
+  const addLines = (node, ancestorsLast, isLast) => {
+    const depth = ancestorsLast.length;
+    ancestorsLast.forEach((last, lvl) => span(last ? "    " : "│   ", lvl));
+    span(`${isLast ? "└── " : "├── "}${node.name} (${node.mb.toFixed(2)}mB | ${node.ingots.toFixed(3)}Ing)`, depth);
+    tree.append("\n");
+    const children = node.children || [];
+    children.forEach((child, i) => addLines(child, [...ancestorsLast, isLast], i === children.length - 1));
+  };
+  addLines(root, [], true);
+}
+
+// renderSummary fills the table with the base materials, sorted by name.
+function renderSummary(summary) {
+  const body = document.querySelector("#summary tbody");
+  body.replaceChildren();
+  Object.values(summary)
+    .sort((a, b) => a.name.localeCompare(b.name))
+    .forEach((a) => {
+      const row = body.insertRow();
+      row.insertCell().textContent = a.name;
+      row.insertCell().textContent = a.mb.toFixed(2);
+      row.insertCell().textContent = a.ingots.toFixed(3);
+    });
+}
+
+init();
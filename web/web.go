@@ -0,0 +1,23 @@
+// Package web is the browser front end of tfccalc: a single page, embedded in the
+// binary, that does what the window does (alloy, amount and mode, percentage
+// settings, the colored breakdown tree and the summary table) through the API of
+// package server. "tfccalc serve" serves it at /.
+package web
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var static embed.FS
+
+// Handler serves the page and its scripts.
+func Handler() http.Handler {
+	files, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err) // the directory is embedded, so this cannot happen
+	}
+	return http.FileServerFS(files)
+}
@@ -0,0 +1,37 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	for _, tc := range []struct {
+		path, contentType, contains string
+	}{
+		{"/", "text/html", `<script src="app.js">`},
+		{"/app.js", "text/javascript", `api("POST", "/calculate"`},
+		{"/style.css", "text/css", ".d5"},
+	} {
+		rec := httptest.NewRecorder()
+		Handler().ServeHTTP(rec, httptest.NewRequest("GET", tc.path, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("GET %s = %d", tc.path, rec.Code)
+			continue
+		}
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, tc.contentType) {
+			t.Errorf("GET %s: Content-Type %q, want %s", tc.path, ct, tc.contentType)
+		}
+		if !strings.Contains(rec.Body.String(), tc.contains) {
+			t.Errorf("GET %s does not contain %q", tc.path, tc.contains)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/missing.js", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET /missing.js = %d, want 404", rec.Code)
+	}
+}